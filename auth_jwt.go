@@ -6,7 +6,7 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
@@ -22,6 +22,7 @@ import (
 
 const (
 	tokenContextKey         = "JWT_TOKEN"
+	errorContextKey         = "JWT_ERROR"
 	algRS256                = "RS256"
 	keyCode                 = "code"
 	keyMessage              = "message"
@@ -84,6 +85,16 @@ type GinJWTMiddleware struct {
 	// User can define own Unauthorized func.
 	Unauthorized func(c *gin.Context, code int, message string)
 
+	// ErrorHandler, when set, replaces HTTPStatusMessageFunc and Unauthorized for every failure
+	// of the middleware and the handlers. It receives the classified error and writes
+	// the response with any status code. The WWW-Authenticate header is already set.
+	ErrorHandler func(c *gin.Context, err *AuthError)
+
+	// ProblemDetails makes the default Unauthorized func reply with an RFC 9457
+	// application/problem+json body carrying a stable error code.
+	// Ignored when Unauthorized is set. Optional, default is false.
+	ProblemDetails bool
+
 	// User can define own LoginResponse func.
 	LoginResponse func(c *gin.Context, token *core.Token)
 
@@ -116,8 +127,18 @@ type GinJWTMiddleware struct {
 
 	// HTTP Status messages for when something in the JWT middleware fails.
 	// Check error (e) to determine the appropriate error message.
+	// Optional, default is ErrorMessage, which localizes the message.
 	HTTPStatusMessageFunc func(c *gin.Context, e error) string
 
+	// Messages adds or overrides localized messages, keyed by locale then error kind.
+	// Entries are merged over the built-in en, zh-CN and zh-TW catalogs.
+	Messages map[string]MessageCatalog
+
+	// LocaleFunc returns the language tag used to pick the message catalog.
+	// Optional, by default the best supported locale of the Accept-Language header.
+	// Without a matching locale, messages are the English error strings.
+	LocaleFunc func(c *gin.Context) string
+
 	// Private key file for asymmetric algorithms
 	PrivKeyFile string
 
@@ -173,6 +194,20 @@ type GinJWTMiddleware struct {
 	// CookieSameSite allow use http.SameSite cookie param
 	CookieSameSite http.SameSite
 
+	// AccessTokenCookie overrides the cookie options above for the access token cookie.
+	// Optional, defaults to CookieName, CookieDomain, CookieSameSite, SecureCookie and CookieHTTPOnly.
+	AccessTokenCookie *CookiePolicy
+
+	// RefreshTokenCookie overrides the cookie options above for the refresh token cookie,
+	// e.g. to scope it to the refresh endpoint or to allow plain HTTP in development.
+	// Optional, defaults to RefreshTokenCookieName, CookieDomain, CookieSameSite, Secure and HttpOnly.
+	RefreshTokenCookie *CookiePolicy
+
+	// CookieChunkSize is the largest access token value stored in a single cookie. Larger tokens
+	// are split across <name>.0, <name>.1, ... cookies and reassembled by the cookie lookup.
+	// Optional, defaults to 3800 bytes.
+	CookieChunkSize int
+
 	// ParseOptions allow to modify jwt's parser methods.
 	// WithTimeFunc is always added to ensure the TimeFunc is propagated to the validator
 	ParseOptions []jwt.ParserOption
@@ -184,10 +219,111 @@ type GinJWTMiddleware struct {
 	// Defaults to 30 days if not set
 	RefreshTokenTimeout time.Duration
 
+	// RefreshTimeoutFunc overrides RefreshTokenTimeout per login, e.g. per user or client.
+	// The lifetime it returns is kept by the refresh tokens replacing the one of the login.
+	// Optional, defaults to RefreshTokenTimeout.
+	RefreshTimeoutFunc func(c *gin.Context, data any) time.Duration
+
+	// EnableRememberMe gives logins without the RememberMeField flag a browser-session refresh
+	// token: its cookie has no Max-Age and it is stored for SessionRefreshTimeout only.
+	// Logins with the flag get a refresh token for RefreshTimeoutFunc.
+	EnableRememberMe bool
+
+	// RememberMeField is the form or JSON login parameter of the remember me flag,
+	// e.g. "true" or a checked checkbox. Optional, defaults to "remember_me".
+	RememberMeField string
+
+	// SessionRefreshTimeout is how long the store keeps browser-session refresh tokens.
+	// Optional, defaults to 24 hours.
+	SessionRefreshTimeout time.Duration
+
+	// RefreshTokenIdleTimeout revokes a refresh token that was not used for this long.
+	// Every refresh issues a new refresh token, which restarts the clock.
+	// It should be shorter than RefreshTokenTimeout, which removes the token from the store.
+	// RefreshTokenStore must implement core.DataStore, as the memory and Redis stores do.
+	// Optional, defaults to 0 (disabled).
+	RefreshTokenIdleTimeout time.Duration
+
+	// RefreshTokenMaxLifetime limits how long refresh tokens can be renewed after the login,
+	// however often they are used; the user then has to log in again.
+	// RefreshTokenStore must implement core.DataStore, as the memory and Redis stores do.
+	// Optional, defaults to 0 (disabled).
+	RefreshTokenMaxLifetime time.Duration
+
+	// MaxSessionsPerUser limits how many sessions, i.e. refresh tokens, a user can have.
+	// A login beyond it evicts the oldest sessions or is refused, see SessionLimitPolicy.
+	// RefreshTokenStore must implement core.SessionStore and core.DataStore,
+	// as the memory and Redis stores do. Optional, defaults to 0 (unlimited).
+	MaxSessionsPerUser int
+
+	// SessionLimitPolicy decides what a login beyond MaxSessionsPerUser does.
+	// Optional, defaults to SessionLimitEvictOldest.
+	SessionLimitPolicy SessionLimitPolicy
+
+	// SubjectFunc returns the user a refresh token belongs to, for MaxSessionsPerUser.
+	// Optional, defaults to the IdentityKey claim of PayloadFunc, or the user data itself
+	// when it is a string. Access tokens are matched to their user by their sub claim, or
+	// their IdentityKey claim without one, so PayloadFunc should set sub to the subject when
+	// SubjectFunc returns something else.
+	SubjectFunc func(data any) string
+
+	// EnableSessionMetadata stores the user agent, client IP, device name, last use and
+	// refresh count of the session with every refresh token. RefreshTokenStore must
+	// implement core.DataStore, as the memory and Redis stores do. Optional, defaults to false.
+	EnableSessionMetadata bool
+
+	// DeviceNameHeader is the request header in which clients name their device, at login
+	// or refresh. Optional, defaults to DefaultDeviceNameHeader.
+	DeviceNameHeader string
+
+	// SessionMetadataFunc decides what is recorded about the session at login and refresh.
+	// It receives the metadata captured from c, and returns it, changed, e.g. to drop the
+	// client IP or add Extra values, or nil to record nothing. Optional.
+	SessionMetadataFunc func(c *gin.Context, metadata *core.SessionMetadata) *core.SessionMetadata
+
+	// EnableSessionHandlers indexes refresh tokens by user, for ListSessionsHandler and the
+	// other session management handlers. Access tokens of the sessions they revoke are
+	// refused, which costs a store lookup per request. RefreshTokenStore must implement
+	// core.SessionStore, as the memory and Redis stores do. Optional, defaults to false.
+	EnableSessionHandlers bool
+
+	// User can define own SessionsResponse func, replying to ListSessionsHandler and
+	// AdminListSessionsHandler.
+	SessionsResponse func(c *gin.Context, sessions []SessionInfo)
+
+	// User can define own SessionsRevokedResponse func, replying to the session revocation
+	// handlers with the IDs of the revoked sessions.
+	SessionsRevokedResponse func(c *gin.Context, sessionIDs []string)
+
+	// SessionAdminAuthorizer allows the caller of the admin session handlers, such as
+	// AdminListSessionsHandler, to act on the sessions of any user. data is the
+	// IdentityHandler value of the caller. Optional, the admin handlers refuse every caller
+	// when it is nil.
+	SessionAdminAuthorizer func(c *gin.Context, data any) bool
+
+	// EnableRevocationWatermark refuses the access and refresh tokens issued before the
+	// revocation watermark of their user, or the global one, set by RevokeTokensIssuedBefore.
+	// Every request reads the watermark from RefreshTokenStore, which must implement
+	// core.WatermarkStore and core.DataStore, as the memory and Redis stores do.
+	// Optional, defaults to false.
+	EnableRevocationWatermark bool
+
+	// User can define own TokensRevokedResponse func, replying to AdminRevokeTokensHandler
+	// and AdminRevokeAllTokensHandler. subject is empty for every user.
+	TokensRevokedResponse func(c *gin.Context, subject string, watermark time.Time)
+
 	// RefreshTokenStore interface for storing and retrieving refresh tokens
 	// If nil, an in-memory store will be used
 	RefreshTokenStore core.TokenStore
 
+	// RefreshTokenGracePeriod keeps a rotated refresh token for a while: a refresh repeated
+	// with it, e.g. by another browser tab, gets the same pair instead of ErrInvalidRefreshToken.
+	// Pairs bound to DPoP keys or, with EnableFingerprint, to a fingerprint are not handed out
+	// again. RefreshTokenStore must implement core.RotationStore, as the memory and Redis
+	// stores do.
+	// Optional, defaults to 0, which revokes rotated tokens at once.
+	RefreshTokenGracePeriod time.Duration
+
 	// RefreshTokenLength specifies the byte length of refresh tokens (default: 32)
 	RefreshTokenLength int
 
@@ -199,6 +335,187 @@ type GinJWTMiddleware struct {
 	// If nil when UseRedisStore is true, will use default Redis configuration
 	RedisConfig *store.RedisConfig
 
+	// MFAVerifier verifies the second authentication factor (TOTP, backup codes, ...).
+	// When set, LoginHandler returns a short-lived mfa_pending token instead of a token pair,
+	// which must be exchanged together with a valid code through MFAHandler.
+	// Optional, by default login is single-factor.
+	MFAVerifier MFAVerifier
+
+	// MFARequired decides whether the authenticated user must pass the second factor.
+	// Optional, by default every user must when MFAVerifier is set.
+	MFARequired func(c *gin.Context, data any) bool
+
+	// MFATimeout specifies how long an mfa_pending token is valid. Optional, defaults to 5 minutes.
+	MFATimeout time.Duration
+
+	// User can define own MFAPendingResponse func, called when a login needs the second factor.
+	MFAPendingResponse func(c *gin.Context, mfaToken string, expire time.Time)
+
+	// MaxLoginAttempts enables brute-force protection of LoginHandler: once a username or
+	// client IP reaches this number of failed logins it is temporarily locked out. Wrong
+	// codes sent to MFAHandler count as failed logins.
+	// Optional, defaults to 0 meaning unlimited attempts.
+	MaxLoginAttempts int
+
+	// LoginAttemptWindow is how long failures are remembered after the last one.
+	// Optional, defaults to one hour.
+	LoginAttemptWindow time.Duration
+
+	// LoginLockoutDuration is the first lockout, doubled for every further failure.
+	// Optional, defaults to one minute.
+	LoginLockoutDuration time.Duration
+
+	// MaxLoginLockoutDuration caps the exponential lockout. Optional, defaults to 15 minutes.
+	MaxLoginLockoutDuration time.Duration
+
+	// LoginAttemptKeys returns the keys a login request is tracked by.
+	// Optional, by default the client IP and the "username" field of the request body,
+	// see LoginAttemptIPKey and LoginAttemptUserKey.
+	LoginAttemptKeys func(c *gin.Context) []string
+
+	// LoginAttemptStore stores the failed login counters.
+	// If nil, a Redis store is used when the refresh token store is Redis, in-memory otherwise.
+	LoginAttemptStore core.LoginAttemptStore
+
+	// LoginLockoutFunc is called whenever a key gets locked out.
+	LoginLockoutFunc func(c *gin.Context, key string, until time.Time)
+
+	// LoginAttemptFailClosed refuses logins with 503 while LoginAttemptStore cannot tell
+	// whether they are locked out, instead of letting them through unprotected.
+	// Store errors are logged and emitted as EventLoginAttemptStoreError either way.
+	// Optional, defaults to false.
+	LoginAttemptFailClosed bool
+
+	// EventHandler receives authentication lifecycle events such as logins, refreshes,
+	// rejected tokens and store fallbacks, e.g. to feed an audit log.
+	// Optional, by default events are discarded.
+	EventHandler EventHandler
+
+	// RequestIDFunc returns the request ID attached to events.
+	// Optional, defaults to the X-Request-ID header.
+	RequestIDFunc func(c *gin.Context) string
+
+	// Logger receives the diagnostic logs of the middleware and of the Redis stores it creates.
+	// Records carry realm, store and error_kind attributes and never contain token values.
+	// Optional, defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Metrics receives counters for every outcome of the middleware and the handlers,
+	// store latency histograms and a refresh token gauge. See the metrics package
+	// for an expvar and Prometheus text exporter. Optional, by default nothing is recorded.
+	Metrics MetricsRecorder
+
+	// Tracer creates spans around token parsing, KeyFunc, signing, TokenGenerator
+	// and every RefreshTokenStore call, as children of the request context.
+	// Optional, by default no spans are created.
+	Tracer Tracer
+
+	// EnableDPoP enables sender-constrained tokens (RFC 9449). When the client sends a DPoP proof
+	// to LoginHandler or RefreshHandler, the issued tokens are bound to its public key through
+	// the cnf.jkt claim, and the middleware then requires the DPoP authorization scheme
+	// together with a fresh proof signed by the same key. Optional, defaults to false.
+	EnableDPoP bool
+
+	// DPoPRequired rejects logins, refreshes and access tokens without a DPoP binding,
+	// e.g. when all clients are public clients. Only used when EnableDPoP is true.
+	DPoPRequired bool
+
+	// DPoPAlgorithms lists the accepted proof signing algorithms.
+	// Optional, defaults to the ES, RS, PS families and EdDSA.
+	DPoPAlgorithms []string
+
+	// DPoPProofMaxAge is how far the iat of a proof may be from the server time.
+	// Optional, defaults to one minute.
+	DPoPProofMaxAge time.Duration
+
+	// DPoPReplayStore remembers the jti of accepted proofs.
+	// If nil, a Redis store is used when the refresh token store is Redis, in-memory otherwise.
+	DPoPReplayStore core.ReplayStore
+
+	// DPoPURLFunc returns the request URL compared with the htu claim of a proof.
+	// Optional, defaults to the scheme (TLS or X-Forwarded-Proto), host and path of the request.
+	DPoPURLFunc func(c *gin.Context) string
+
+	// EnableCertificateBinding binds access tokens to the TLS client certificate presented to
+	// LoginHandler or RefreshHandler through the cnf x5t#S256 claim (RFC 8705). The middleware
+	// then rejects such tokens unless the request presents the same certificate.
+	// Optional, defaults to false.
+	EnableCertificateBinding bool
+
+	// EnableFingerprint protects tokens against sidejacking (OWASP JWT cheat sheet): LoginHandler
+	// and RefreshHandler send a random value in a __Host- prefixed HttpOnly cookie and embed
+	// its SHA-256 in the fgp claim of the access token. The middleware then rejects tokens
+	// whose fgp claim does not match the cookie, so a token stolen through XSS is useless
+	// outside the browser. Requires HTTPS. Optional, defaults to false.
+	EnableFingerprint bool
+
+	// FingerprintCookieName is the name of the fingerprint cookie, it must start with "__Host-".
+	// Optional, defaults to "__Host-Fgp".
+	FingerprintCookieName string
+
+	// EnableCSRF protects cookie-based tokens against cross-site request forgery with a signed
+	// double-submit token: SetCookie also sends a CSRF cookie readable by JavaScript, bound to
+	// the access token. Unsafe requests whose token came from a cookie must echo it in
+	// CSRFHeaderName or CSRFFormField. Optional, defaults to false.
+	EnableCSRF bool
+
+	// CSRFCookieName is the name of the CSRF cookie. Optional, defaults to "csrf_token".
+	CSRFCookieName string
+
+	// CSRFHeaderName is the request header carrying the CSRF token.
+	// Optional, defaults to "X-CSRF-Token".
+	CSRFHeaderName string
+
+	// CSRFFormField is the form field carrying the CSRF token when the header is absent.
+	// Optional, defaults to "csrf_token".
+	CSRFFormField string
+
+	// CSRFKey signs the CSRF tokens. Optional, derived from Key by default,
+	// random for public key algorithms.
+	CSRFKey []byte
+
+	// CSRFExempt skips the CSRF check for a request, e.g. for webhooks.
+	CSRFExempt func(c *gin.Context) bool
+
+	// EnableSlidingSession renews access tokens of active users: when a valid token expires
+	// within SlidingWindow, the middleware issues a new one with the same claims, returned in
+	// SlidingTokenHeader and, with SendCookie, in the access token cookie. Sessions still end
+	// SessionMaxAge after the login. Renewed tokens keep the lifetime of the token they
+	// replace and get an iat claim. When RefreshTokenStore indexes sessions, as the memory
+	// and Redis stores do, tokens of a session without a valid refresh token, e.g. after a
+	// logout, are no longer renewed.
+	// Optional, defaults to false.
+	EnableSlidingSession bool
+
+	// SlidingWindow is how long before expiry a token is renewed.
+	// Optional, defaults to half of Timeout.
+	SlidingWindow time.Duration
+
+	// SessionMaxAge is the absolute lifetime of a sliding session, counted from the orig_iat
+	// claim set at login. Renewed tokens never expire after it.
+	// Optional, defaults to 24 hours.
+	SessionMaxAge time.Duration
+
+	// SlidingTokenHeader is the response header carrying a renewed access token.
+	// Optional, defaults to "X-Renewed-Token".
+	SlidingTokenHeader string
+
+	// EnableTransparentRefresh lets the middleware refresh an expired access token by itself when
+	// the request carries a refresh token cookie: the refresh token is rotated, both cookies are
+	// set on the response and the request goes on with the new access token. Concurrent requests
+	// with the same refresh token share one rotation. Requires SendCookie.
+	// Optional, defaults to false.
+	EnableTransparentRefresh bool
+
+	// refreshCalls de-duplicates transparent refreshes
+	refreshCalls *refreshGroup
+
+	// messages are the built-in catalogs merged with Messages
+	messages map[string]MessageCatalog
+
+	// locales are the keys of messages, sorted
+	locales []string
+
 	// inMemoryStore internal fallback refresh token store
 	inMemoryStore *store.InMemoryRefreshTokenStore
 }
@@ -274,6 +591,131 @@ var (
 
 	// ErrRefreshTokenNotFound indicates the refresh token was not found in storage
 	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+	// ErrRefreshTokenIdle indicates the refresh token was unused for RefreshTokenIdleTimeout
+	ErrRefreshTokenIdle = errors.New("refresh token idle timeout exceeded")
+
+	// ErrRefreshSessionExpired indicates RefreshTokenMaxLifetime has passed since the login
+	ErrRefreshSessionExpired = errors.New("session lifetime exceeded, please log in again")
+
+	// ErrMissingMFAVerifier indicates MFAHandler is used without an MFAVerifier
+	ErrMissingMFAVerifier = errors.New("ginJWTMiddleware.MFAVerifier is undefined")
+
+	// ErrMissingMFAValues indicates the mfa_token or code parameter is missing
+	ErrMissingMFAValues = errors.New("missing mfa_token or code parameter")
+
+	// ErrInvalidMFAToken indicates the mfa_pending token is invalid, expired or already used
+	ErrInvalidMFAToken = errors.New("invalid or expired mfa token")
+
+	// ErrInvalidMFACode indicates the second-factor code was rejected
+	ErrInvalidMFACode = errors.New("invalid mfa code")
+
+	// ErrLoginLocked indicates too many failed logins, the client must wait for Retry-After
+	ErrLoginLocked = errors.New("too many failed login attempts, try again later")
+
+	// ErrLoginAttemptStore indicates LoginAttemptStore failed to read or record login attempts
+	ErrLoginAttemptStore = errors.New("failed to access the login attempt store")
+
+	// ErrMFAPendingToken indicates an mfa_pending token was presented to a protected route
+	ErrMFAPendingToken = errors.New("multi-factor authentication is not complete")
+
+	// ErrMissingDPoPProof indicates a DPoP proof is required but the DPoP header is missing
+	ErrMissingDPoPProof = errors.New("missing DPoP proof")
+
+	// ErrInvalidDPoPProof indicates the DPoP proof is malformed, badly signed or does not match the request
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+
+	// ErrDPoPProofReplayed indicates the jti of the DPoP proof was already used
+	ErrDPoPProofReplayed = errors.New("DPoP proof has already been used")
+
+	// ErrDPoPKeyMismatch indicates the DPoP proof is signed by another key than the token is bound to
+	ErrDPoPKeyMismatch = errors.New("DPoP proof key does not match the token binding")
+
+	// ErrDPoPSchemeMismatch indicates a DPoP-bound token sent as a bearer token, or the reverse
+	ErrDPoPSchemeMismatch = errors.New("authorization scheme does not match the token binding")
+
+	// ErrDPoPRequired indicates a token without DPoP binding while DPoPRequired is set
+	ErrDPoPRequired = errors.New("DPoP-bound token required")
+
+	// ErrCertificateMismatch indicates a certificate-bound token presented without its client certificate
+	ErrCertificateMismatch = errors.New("client certificate does not match the token binding")
+
+	// ErrFingerprintMismatch indicates the fingerprint cookie is missing or does not match the token
+	ErrFingerprintMismatch = errors.New("token fingerprint does not match")
+
+	// ErrRotationNotSupported indicates RefreshTokenGracePeriod is set but RefreshTokenStore
+	// does not implement core.RotationStore
+	ErrRotationNotSupported = errors.New("refresh token store does not support rotation")
+
+	// ErrRefreshLifetimeNotSupported indicates RefreshTokenIdleTimeout or
+	// RefreshTokenMaxLifetime is set but RefreshTokenStore does not implement core.DataStore
+	ErrRefreshLifetimeNotSupported = errors.New(
+		"refresh token store does not support refresh token lifetimes",
+	)
+
+	// ErrMetricsRegistration indicates the refresh token gauge could not read
+	// RefreshTokenStore.Count when Metrics was set
+	ErrMetricsRegistration = errors.New("failed to register metrics")
+
+	// ErrSessionLimitNotSupported indicates MaxSessionsPerUser is set but RefreshTokenStore
+	// does not implement core.SessionStore and core.DataStore
+	ErrSessionLimitNotSupported = errors.New("refresh token store does not support session limits")
+
+	// ErrSessionLimitReached indicates a login refused by SessionLimitReject
+	ErrSessionLimitReached = errors.New("maximum number of sessions reached")
+
+	// ErrSessionMetadataNotSupported indicates EnableSessionMetadata is set but
+	// RefreshTokenStore does not implement core.DataStore
+	ErrSessionMetadataNotSupported = errors.New(
+		"refresh token store does not support session metadata",
+	)
+
+	// ErrSessionsNotSupported indicates EnableSessionHandlers is not set, or RefreshTokenStore
+	// does not implement core.SessionStore
+	ErrSessionsNotSupported = errors.New("refresh token store does not support listing sessions")
+
+	// ErrFailedSessionOperation indicates the store failed to list or revoke sessions
+	ErrFailedSessionOperation = errors.New("failed to access sessions")
+
+	// ErrSessionNotFound indicates the session to revoke does not exist or belongs to another user
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrTokenRevoked indicates a token issued before the revocation watermark of its user,
+	// or an access token of a revoked session
+	ErrTokenRevoked = errors.New("token has been revoked")
+
+	// ErrRevocationCheckFailed indicates the store failed to return the revocation watermark,
+	// or whether the session of a token was revoked
+	ErrRevocationCheckFailed = errors.New("failed to check token revocation")
+
+	// ErrRevocationWatermarkNotSupported indicates EnableRevocationWatermark is set but
+	// RefreshTokenStore does not implement core.WatermarkStore and core.DataStore
+	ErrRevocationWatermarkNotSupported = errors.New(
+		"refresh token store does not support revocation watermarks",
+	)
+
+	// ErrMissingSubject indicates an admin handler is routed without the SubjectParam parameter,
+	// or called with an empty one
+	ErrMissingSubject = errors.New("missing subject")
+
+	// ErrMissingSessionID indicates the access token does not identify its session, e.g. it
+	// was issued by an earlier version
+	ErrMissingSessionID = errors.New("token does not identify its session")
+
+	// ErrTransparentRefreshWithoutCookie indicates EnableTransparentRefresh lacks SendCookie
+	ErrTransparentRefreshWithoutCookie = errors.New("transparent refresh requires SendCookie")
+
+	// ErrInvalidFingerprintCookieName indicates FingerprintCookieName lacks the __Host- prefix
+	ErrInvalidFingerprintCookieName = errors.New("fingerprint cookie name must start with __Host-")
+
+	// ErrInvalidCookiePolicy indicates a cookie policy violates its name prefix or Partitioned rules
+	ErrInvalidCookiePolicy = errors.New("invalid cookie policy")
+
+	// ErrCookieTooLarge indicates the access token was split across several cookies
+	ErrCookieTooLarge = errors.New("access token exceeds the cookie size")
+
+	// ErrInvalidCSRFToken indicates an unsafe request with a cookie token lacks a valid CSRF token
+	ErrInvalidCSRFToken = errors.New("missing or invalid CSRF token")
 )
 
 // New creates and initializes a new GinJWTMiddleware instance
@@ -308,7 +750,11 @@ func (mw *GinJWTMiddleware) privateKey() error {
 		filecontent, err = os.ReadFile(mw.PrivKeyFile)
 		if err != nil {
 			// Log detailed error for debugging but don't expose to client
-			log.Printf("Failed to read private key file %s: %v", mw.PrivKeyFile, err)
+			mw.logger().Error("failed to read private key file",
+				logKeyFile, mw.PrivKeyFile,
+				logKeyErrorKind, errorKindKeyFile,
+				logKeyError, err,
+			)
 			return ErrNoPrivKeyFile
 		}
 		keyData = filecontent
@@ -352,7 +798,11 @@ func (mw *GinJWTMiddleware) publicKey() error {
 		filecontent, err := os.ReadFile(mw.PubKeyFile)
 		if err != nil {
 			// Log detailed error for debugging but don't expose to client
-			log.Printf("Failed to read public key file %s: %v", mw.PubKeyFile, err)
+			mw.logger().Error("failed to read public key file",
+				logKeyFile, mw.PubKeyFile,
+				logKeyErrorKind, errorKindKeyFile,
+				logKeyError, err,
+			)
 			return ErrNoPubKeyFile
 		}
 		keyData = filecontent
@@ -398,6 +848,10 @@ func (mw *GinJWTMiddleware) MiddlewareInit() error {
 		mw.TimeFunc = time.Now
 	}
 
+	if mw.Logger == nil {
+		mw.Logger = slog.Default()
+	}
+
 	mw.TokenHeadName = strings.TrimSpace(mw.TokenHeadName)
 	if mw.TokenHeadName == "" {
 		mw.TokenHeadName = "Bearer"
@@ -409,6 +863,10 @@ func (mw *GinJWTMiddleware) MiddlewareInit() error {
 		}
 	}
 
+	if mw.Unauthorized == nil && mw.ProblemDetails {
+		mw.Unauthorized = mw.problemResponse
+	}
+
 	if mw.Unauthorized == nil {
 		mw.Unauthorized = func(c *gin.Context, code int, message string) {
 			c.JSON(code, gin.H{
@@ -451,10 +909,14 @@ func (mw *GinJWTMiddleware) MiddlewareInit() error {
 		}
 	}
 
+	mw.initializeMessages()
+
+	if mw.LocaleFunc == nil {
+		mw.LocaleFunc = mw.acceptLanguage
+	}
+
 	if mw.HTTPStatusMessageFunc == nil {
-		mw.HTTPStatusMessageFunc = func(c *gin.Context, e error) string {
-			return e.Error()
-		}
+		mw.HTTPStatusMessageFunc = mw.ErrorMessage
 	}
 
 	if mw.Realm == "" {
@@ -473,14 +935,41 @@ func (mw *GinJWTMiddleware) MiddlewareInit() error {
 		mw.RefreshTokenCookieName = defaultRefreshTokenName
 	}
 
+	if mw.CookieChunkSize <= 0 {
+		mw.CookieChunkSize = DefaultCookieChunkSize
+	}
+
+	if err := mw.initializeCookiePolicies(); err != nil {
+		return err
+	}
+
 	if mw.ExpField == "" {
 		mw.ExpField = claimExp
 	}
 
+	if mw.RequestIDFunc == nil {
+		mw.RequestIDFunc = defaultRequestID
+	}
+
+	if mw.MFATimeout == 0 {
+		mw.MFATimeout = 5 * time.Minute
+	}
+
+	if mw.MFAPendingResponse == nil {
+		mw.MFAPendingResponse = func(c *gin.Context, mfaToken string, expire time.Time) {
+			c.JSON(http.StatusOK, gin.H{
+				"mfa_required": true,
+				keyMFAToken:    mfaToken,
+				"expires_in":   int64(expire.Sub(mw.TimeFunc()).Seconds()),
+			})
+		}
+	}
+
 	// Initialize refresh token settings (RFC 6749 compliant by default)
 	if mw.RefreshTokenTimeout == 0 {
 		mw.RefreshTokenTimeout = 30 * 24 * time.Hour // 30 days default
 	}
+	mw.initializeRememberMe()
 	if mw.RefreshTokenLength == 0 {
 		mw.RefreshTokenLength = 32 // 256 bits default
 	}
@@ -497,6 +986,74 @@ func (mw *GinJWTMiddleware) MiddlewareInit() error {
 		}
 	}
 
+	if err := mw.registerMetrics(); err != nil {
+		return err
+	}
+
+	if mw.MaxLoginAttempts > 0 {
+		if mw.LoginAttemptWindow == 0 {
+			mw.LoginAttemptWindow = time.Hour
+		}
+		if mw.LoginLockoutDuration == 0 {
+			mw.LoginLockoutDuration = time.Minute
+		}
+		if mw.MaxLoginLockoutDuration == 0 {
+			mw.MaxLoginLockoutDuration = 15 * time.Minute
+		}
+		if mw.LoginAttemptKeys == nil {
+			mw.LoginAttemptKeys = mw.defaultLoginAttemptKeys
+		}
+		mw.initializeLoginAttemptStore()
+	}
+
+	mw.initializeDPoP()
+	mw.initializeSlidingSession()
+
+	if err := mw.initializeTransparentRefresh(); err != nil {
+		return err
+	}
+
+	if err := mw.initializeMFA(); err != nil {
+		return err
+	}
+
+	if err := mw.initializeRotation(); err != nil {
+		return err
+	}
+
+	if err := mw.initializeRefreshLifetime(); err != nil {
+		return err
+	}
+
+	if err := mw.initializeSessionLimit(); err != nil {
+		return err
+	}
+
+	if err := mw.initializeSessionMetadata(); err != nil {
+		return err
+	}
+
+	if err := mw.initializeSessionHandlers(); err != nil {
+		return err
+	}
+
+	if err := mw.initializeRevocationWatermark(); err != nil {
+		return err
+	}
+
+	if err := mw.initializeCSRF(); err != nil {
+		return err
+	}
+
+	if mw.EnableFingerprint {
+		if mw.FingerprintCookieName == "" {
+			mw.FingerprintCookieName = DefaultFingerprintCookieName
+		}
+		if !validFingerprintCookieName(mw.FingerprintCookieName) {
+			return ErrInvalidFingerprintCookieName
+		}
+	}
+
 	// bypass other key settings if KeyFunc is set
 	if mw.KeyFunc != nil {
 		return nil
@@ -527,17 +1084,87 @@ func (mw *GinJWTMiddleware) MiddlewareFunc() gin.HandlerFunc {
 
 func (mw *GinJWTMiddleware) middlewareImpl(c *gin.Context) {
 	claims, err := mw.GetClaimsFromJWT(c)
+
+	// An expired token with a refresh cookie goes through the checks below, then gets refreshed
+	var expiredErr error
+	if mw.EnableTransparentRefresh && errors.Is(err, jwt.ErrTokenExpired) {
+		if expiredClaims := mw.refreshableClaims(c); expiredClaims != nil {
+			claims, expiredErr, err = expiredClaims, err, nil
+		}
+	}
+
 	if err != nil {
+		mw.logger().Debug("token rejected", logKeyReason, errorReason(err))
+		mw.emit(c, EventTokenRejected, nil, err)
+		mw.countOutcome(MetricAuthRequests, OutcomeRejected, err)
 		mw.handleTokenError(c, err)
 		return
 	}
 
 	// For backwards compatibility since technically exp is not required in the spec but has been in gin-jwt
 	if claims[claimExp] == nil {
-		mw.unauthorized(c, http.StatusBadRequest, mw.HTTPStatusMessageFunc(c, ErrMissingExpField))
+		mw.emit(c, EventTokenRejected, nil, ErrMissingExpField)
+		mw.countOutcome(MetricAuthRequests, OutcomeRejected, ErrMissingExpField)
+		mw.unauthorized(c, PhaseParse, http.StatusBadRequest, ErrMissingExpField)
+		return
+	}
+
+	// mfa_pending tokens can only be exchanged through MFAHandler
+	if isMFAPendingToken(claims) {
+		mw.emit(c, EventTokenRejected, nil, ErrMFAPendingToken)
+		mw.countOutcome(MetricAuthRequests, OutcomeRejected, ErrMFAPendingToken)
+		mw.unauthorized(c, PhaseParse, http.StatusUnauthorized, ErrMFAPendingToken)
 		return
 	}
 
+	// The raw token saved by ParseToken, which the CSRF and DPoP tokens are bound to
+	accessToken := GetToken(c)
+
+	if mw.EnableCSRF {
+		if err := mw.checkCSRF(c, accessToken); err != nil {
+			mw.emit(c, EventTokenRejected, nil, err)
+			mw.countOutcome(MetricAuthRequests, OutcomeRejected, err)
+			mw.unauthorized(c, PhaseParse, http.StatusForbidden, err)
+			return
+		}
+	}
+
+	if mw.EnableDPoP {
+		if err := mw.checkDPoP(c, accessToken, claims); err != nil {
+			mw.emit(c, EventTokenRejected, nil, err)
+			mw.countOutcome(MetricAuthRequests, OutcomeRejected, err)
+			mw.unauthorized(c, PhaseParse, http.StatusUnauthorized, err)
+			return
+		}
+	}
+
+	if mw.EnableFingerprint {
+		if err := mw.checkFingerprint(c, claims); err != nil {
+			mw.emit(c, EventTokenRejected, nil, err)
+			mw.countOutcome(MetricAuthRequests, OutcomeRejected, err)
+			mw.unauthorized(c, PhaseParse, http.StatusUnauthorized, err)
+			return
+		}
+	}
+
+	if mw.EnableCertificateBinding {
+		if err := mw.checkCertificateBinding(c, claims); err != nil {
+			mw.emit(c, EventTokenRejected, nil, err)
+			mw.countOutcome(MetricAuthRequests, OutcomeRejected, err)
+			mw.unauthorized(c, PhaseParse, http.StatusUnauthorized, err)
+			return
+		}
+	}
+
+	if expiredErr != nil {
+		if claims, err = mw.transparentRefresh(c); err != nil {
+			mw.emit(c, EventTokenRejected, nil, expiredErr)
+			mw.countOutcome(MetricAuthRequests, OutcomeRejected, expiredErr)
+			mw.handleTokenError(c, expiredErr)
+			return
+		}
+	}
+
 	c.Set("JWT_PAYLOAD", claims)
 	identity := mw.IdentityHandler(c)
 
@@ -545,11 +1172,36 @@ func (mw *GinJWTMiddleware) middlewareImpl(c *gin.Context) {
 		c.Set(mw.IdentityKey, identity)
 	}
 
+	if mw.EnableRevocationWatermark {
+		if err := mw.checkAccessWatermark(c.Request.Context(), claims); err != nil {
+			mw.emit(c, EventTokenRejected, identity, err)
+			mw.countOutcome(MetricAuthRequests, OutcomeRejected, err)
+			mw.unauthorized(c, PhaseParse, http.StatusUnauthorized, err)
+			return
+		}
+	}
+
+	if mw.revokesSessions() {
+		if err := mw.checkSessionRevoked(c.Request.Context(), claims); err != nil {
+			mw.emit(c, EventTokenRejected, identity, err)
+			mw.countOutcome(MetricAuthRequests, OutcomeRejected, err)
+			mw.unauthorized(c, PhaseParse, http.StatusUnauthorized, err)
+			return
+		}
+	}
+
 	if !mw.Authorizer(c, identity) {
-		mw.unauthorized(c, http.StatusForbidden, mw.HTTPStatusMessageFunc(c, ErrForbidden))
+		mw.emit(c, EventAuthorizationDenied, identity, ErrForbidden)
+		mw.countOutcome(MetricAuthRequests, OutcomeForbidden, ErrForbidden)
+		mw.unauthorized(c, PhaseAuthorize, http.StatusForbidden, ErrForbidden)
 		return
 	}
 
+	if mw.EnableSlidingSession {
+		mw.renewAccessToken(c, claims, identity)
+	}
+
+	mw.countOutcome(MetricAuthRequests, OutcomeSuccess, nil)
 	c.Next()
 }
 
@@ -582,41 +1234,119 @@ func (mw *GinJWTMiddleware) GetClaimsFromJWT(c *gin.Context) (jwt.MapClaims, err
 // Reply will be of the form {"token": "TOKEN"}.
 func (mw *GinJWTMiddleware) LoginHandler(c *gin.Context) {
 	if mw.Authenticator == nil {
-		mw.unauthorized(
-			c,
-			http.StatusInternalServerError,
-			mw.HTTPStatusMessageFunc(c, ErrMissingAuthenticatorFunc),
-		)
+		mw.countOutcome(MetricLogins, OutcomeError, ErrMissingAuthenticatorFunc)
+		mw.unauthorized(c, PhaseLogin, http.StatusInternalServerError, ErrMissingAuthenticatorFunc)
 		return
 	}
 
+	var attemptKeys []string
+	if mw.loginProtectionEnabled() {
+		attemptKeys = mw.LoginAttemptKeys(c)
+		until, err := mw.loginLockedUntil(c, attemptKeys)
+		if err != nil {
+			mw.emit(c, EventLoginFailure, nil, err)
+			mw.countOutcome(MetricLogins, OutcomeError, err)
+			mw.unauthorized(c, PhaseLogin, http.StatusServiceUnavailable, ErrLoginAttemptStore)
+			return
+		}
+		if !until.IsZero() {
+			mw.emit(c, EventLoginFailure, nil, ErrLoginLocked)
+			mw.countOutcome(MetricLogins, OutcomeLocked, ErrLoginLocked)
+			mw.loginLocked(c, until)
+			return
+		}
+	}
+
+	mw.readRememberMe(c)
 	data, err := mw.Authenticator(c)
 	if err != nil {
-		mw.unauthorized(c, http.StatusUnauthorized, mw.HTTPStatusMessageFunc(c, err))
+		if mw.loginProtectionEnabled() {
+			mw.registerLoginFailure(c, attemptKeys)
+		}
+		mw.emit(c, EventLoginFailure, nil, err)
+		mw.countOutcome(MetricLogins, OutcomeFailure, err)
+		mw.unauthorized(c, PhaseLogin, http.StatusUnauthorized, err)
 		return
 	}
 
+	// Second factor required: hand out an mfa_pending token instead of a token pair.
+	// The failure counters are only cleared once the second factor is verified.
+	if mw.mfaRequired(c, data) {
+		mfaToken, expire, err := mw.generateMFAPendingToken(c, data, attemptKeys)
+		if err != nil {
+			mw.emit(c, EventLoginFailure, data, err)
+			mw.countOutcome(MetricLogins, OutcomeError, err)
+			mw.unauthorized(c, PhaseLogin, http.StatusInternalServerError, ErrFailedTokenCreation)
+			return
+		}
+		mw.countOutcome(MetricLogins, OutcomeMFARequired, nil)
+		mw.MFAPendingResponse(c, mfaToken, expire)
+		return
+	}
+
+	if mw.loginProtectionEnabled() {
+		mw.clearLoginFailures(c.Request.Context(), attemptKeys)
+	}
+	mw.issueTokenPair(c, data)
+}
+
+// issueTokenPair generates a token pair for data, sets the cookies and sends the login response.
+func (mw *GinJWTMiddleware) issueTokenPair(c *gin.Context, data any) {
+	ctx := c.Request.Context()
+	if mw.EnableDPoP {
+		var err error
+		if ctx, err = mw.dpopTokenContext(c, ""); err != nil {
+			mw.emit(c, EventLoginFailure, data, err)
+			mw.countOutcome(MetricLogins, OutcomeFailure, err)
+			mw.unauthorized(c, PhaseLogin, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ctx, fingerprint, err := mw.fingerprintContext(mw.certificateContext(ctx, c))
+	if err == nil {
+		err = mw.enforceSessionLimit(ctx, c, data)
+	}
+	if errors.Is(err, ErrSessionLimitReached) {
+		mw.emit(c, EventLoginFailure, data, err)
+		mw.countOutcome(MetricLogins, OutcomeFailure, err)
+		mw.unauthorized(c, PhaseLogin, http.StatusForbidden, err)
+		return
+	}
+
+	policy := mw.loginRefreshPolicy(c, data)
+	c.Set(refreshPolicyContextKey, policy)
+	ctx = withSessionMetadata(ctx, mw.sessionMetadata(c, nil))
+
 	// Generate complete token pair
-	tokenPair, err := mw.TokenGenerator(c.Request.Context(), data)
+	var tokenPair *core.Token
+	if err == nil {
+		tokenPair, err = mw.TokenGenerator(withRefreshPolicy(ctx, policy), data)
+	}
 	if err != nil {
-		mw.unauthorized(
-			c,
-			http.StatusInternalServerError,
-			mw.HTTPStatusMessageFunc(c, ErrFailedTokenCreation),
-		)
+		mw.emit(c, EventLoginFailure, data, err)
+		mw.countOutcome(MetricLogins, OutcomeError, err)
+		mw.unauthorized(c, PhaseLogin, http.StatusInternalServerError, ErrFailedTokenCreation)
 		return
 	}
 
+	mw.emit(c, EventLoginSuccess, data, nil)
+	mw.countOutcome(MetricLogins, OutcomeSuccess, nil)
+	mw.emit(c, EventTokenIssued, data, nil)
+
 	// Set cookies
 	mw.SetCookie(c, tokenPair.AccessToken)
 	mw.SetRefreshTokenCookie(c, tokenPair.RefreshToken)
+	if fingerprint != "" {
+		mw.setFingerprintCookie(c, fingerprint)
+	}
 
 	mw.LoginResponse(c, tokenPair)
 }
 
 func (mw *GinJWTMiddleware) extractRefreshToken(c *gin.Context) string {
 	// Try to get refresh token from cookie first (most common for browser-based apps)
-	token, _ := c.Cookie(mw.RefreshTokenCookieName)
+	token, _ := c.Cookie(mw.refreshTokenCookiePolicy().Name)
 	if token != "" {
 		return token
 	}
@@ -653,56 +1383,57 @@ func (mw *GinJWTMiddleware) extractRefreshToken(c *gin.Context) string {
 func (mw *GinJWTMiddleware) LogoutHandler(c *gin.Context) {
 	// Extract JWT claims to make them available in LogoutResponse
 	// This allows developers to access user information during logout
+	var identity any
 	claims, err := mw.GetClaimsFromJWT(c)
 	if err == nil {
 		c.Set("JWT_PAYLOAD", claims)
-		identity := mw.IdentityHandler(c)
+		identity = mw.IdentityHandler(c)
 		if identity != nil {
 			c.Set(mw.IdentityKey, identity)
 		}
 	}
 
 	// Handle refresh token revocation (RFC 6749 compliant)
+	logoutOutcome := OutcomeSuccess
 	refreshToken := mw.extractRefreshToken(c)
 	if refreshToken != "" {
 		if err := mw.revokeRefreshToken(c.Request.Context(), refreshToken); err != nil {
-			log.Printf("Failed to revoke refresh token on logout: %v", err)
+			logoutOutcome = OutcomeError
+			mw.logger().Warn("failed to revoke refresh token on logout",
+				logKeyStore, storeType(mw.RefreshTokenStore),
+				logKeyErrorKind, errorKindStore,
+				logKeyError, err,
+			)
+		} else {
+			mw.emit(c, EventRefreshTokenRevoked, identity, nil)
 		}
 	}
 
+	mw.emit(c, EventLogout, identity, nil)
+	mw.countOutcome(MetricLogouts, logoutOutcome, nil)
+
 	// delete auth cookies
 	if mw.SendCookie {
-		if mw.CookieSameSite != 0 {
-			c.SetSameSite(mw.CookieSameSite)
-		}
-
-		// Delete access token cookie
-		c.SetCookie(
-			mw.CookieName,
-			"",
-			-1,
-			"/",
-			mw.CookieDomain,
-			mw.SecureCookie,
-			mw.CookieHTTPOnly,
-		)
-
-		// Delete refresh token cookie
-		c.SetCookie(
-			mw.RefreshTokenCookieName,
-			"",
-			-1,
-			"/",
-			mw.CookieDomain,
-			true, // Must match the secure flag used when setting the cookie
-			true,
-		)
+		// The attributes must match the ones used when setting the cookies
+		mw.writeChunkedCookie(c, mw.accessTokenCookiePolicy(), "", -1)
+		writeCookie(c, mw.refreshTokenCookiePolicy(), "", -1)
+
+		if mw.EnableCSRF {
+			writeCookie(c, mw.csrfCookiePolicy(), "", -1)
+		}
+	}
+
+	if mw.EnableFingerprint {
+		mw.setFingerprintCookie(c, "")
 	}
 
 	mw.LogoutResponse(c)
 }
 
-func (mw *GinJWTMiddleware) signedString(token *jwt.Token) (string, error) {
+func (mw *GinJWTMiddleware) signedString(ctx context.Context, token *jwt.Token) (string, error) {
+	_, span := mw.startSpan(ctx, SpanSignToken)
+	span.SetAttribute(SpanAttrAlgorithm, token.Method.Alg())
+
 	var tokenString string
 	var err error
 	if mw.usingPublicKeyAlgo() {
@@ -710,6 +1441,7 @@ func (mw *GinJWTMiddleware) signedString(token *jwt.Token) (string, error) {
 	} else {
 		tokenString, err = token.SignedString(mw.Key)
 	}
+	endSpan(span, err)
 	return tokenString, err
 }
 
@@ -723,9 +1455,9 @@ func (mw *GinJWTMiddleware) generateRefreshToken() (string, error) {
 }
 
 // refreshTokenExpiry returns the effective expiry time for a refresh token,
-// capped to min(RefreshTokenTimeout, MaxRefresh) when MaxRefresh is set.
-func (mw *GinJWTMiddleware) refreshTokenExpiry(now time.Time) time.Time {
-	expiry := now.Add(mw.RefreshTokenTimeout)
+// capped to min(timeout, MaxRefresh) when MaxRefresh is set.
+func (mw *GinJWTMiddleware) refreshTokenExpiry(now time.Time, timeout time.Duration) time.Time {
+	expiry := now.Add(timeout)
 	if mw.MaxRefresh > 0 {
 		maxRefreshExpiry := now.Add(mw.MaxRefresh)
 		if maxRefreshExpiry.Before(expiry) {
@@ -741,25 +1473,51 @@ func (mw *GinJWTMiddleware) storeRefreshToken(
 	token string,
 	userData any,
 ) error {
-	expiry := mw.refreshTokenExpiry(mw.TimeFunc())
-	return mw.RefreshTokenStore.Set(ctx, token, userData, expiry)
+	if store, ok := mw.dataStore(); ok {
+		return mw.storeSetData(ctx, store, token, mw.refreshTokenRecord(ctx, userData))
+	}
+	policy := mw.refreshPolicyFromContext(ctx)
+	expiry := mw.refreshTokenExpiry(mw.TimeFunc(), policy.timeout)
+	return mw.storeSet(ctx, token, userData, expiry)
 }
 
-// validateRefreshToken validates a refresh token and returns associated user data
-func (mw *GinJWTMiddleware) validateRefreshToken(ctx context.Context, token string) (any, error) {
-	userData, err := mw.RefreshTokenStore.Get(ctx, token)
+// validateRefreshToken validates a refresh token, including its idle timeout and
+// session lifetime, and returns the data stored with it
+func (mw *GinJWTMiddleware) validateRefreshToken(
+	ctx context.Context,
+	token string,
+) (*core.RefreshTokenData, error) {
+	if isStoreRecordKey(token) {
+		return nil, ErrInvalidRefreshToken
+	}
+	data, err := mw.refreshTokenData(ctx, token)
 	if err != nil {
 		if err == core.ErrRefreshTokenNotFound {
 			return nil, ErrInvalidRefreshToken
 		}
 		return nil, err
 	}
-	return userData, nil
+	// Pending MFA logins and DPoP bindings share the store, but are not refresh tokens
+	if data.Kind != "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err := mw.checkRefreshLifetime(data); err != nil {
+		return nil, err
+	}
+	if mw.EnableRevocationWatermark {
+		if err := mw.checkRefreshWatermark(ctx, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
 }
 
 // revokeRefreshToken removes a refresh token from storage
 func (mw *GinJWTMiddleware) revokeRefreshToken(ctx context.Context, token string) error {
-	return mw.RefreshTokenStore.Delete(ctx, token)
+	if err := mw.deleteDPoPBinding(ctx, token); err != nil {
+		return err
+	}
+	return mw.storeDelete(ctx, token)
 }
 
 // RefreshHandler can be used to refresh a token using RFC 6749 compliant refresh tokens.
@@ -769,31 +1527,79 @@ func (mw *GinJWTMiddleware) RefreshHandler(c *gin.Context) {
 	// Extract refresh token from request
 	refreshToken := mw.extractRefreshToken(c)
 	if refreshToken == "" {
-		mw.unauthorized(
-			c,
-			http.StatusBadRequest,
-			mw.HTTPStatusMessageFunc(c, ErrMissingRefreshToken),
-		)
+		mw.emit(c, EventRefreshFailure, nil, ErrMissingRefreshToken)
+		mw.countOutcome(MetricRefreshes, OutcomeFailure, ErrMissingRefreshToken)
+		mw.unauthorized(c, PhaseRefresh, http.StatusBadRequest, ErrMissingRefreshToken)
 		return
 	}
 
 	// Validate refresh token
-	userData, err := mw.validateRefreshToken(c.Request.Context(), refreshToken)
+	data, err := mw.validateRefreshToken(c.Request.Context(), refreshToken)
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		if tokenPair := mw.rotatedTokenPair(c.Request.Context(), refreshToken); tokenPair != nil {
+			mw.replayRotation(c, tokenPair)
+			return
+		}
+	}
 	if err != nil {
-		mw.unauthorized(c, http.StatusUnauthorized, mw.HTTPStatusMessageFunc(c, err))
+		mw.emit(c, EventRefreshFailure, nil, err)
+		mw.countOutcome(MetricRefreshes, OutcomeFailure, err)
+		mw.unauthorized(c, PhaseRefresh, http.StatusUnauthorized, err)
 		return
 	}
+	userData := data.UserData
 
-	// Generate new token pair and revoke old refresh token
-	tokenPair, err := mw.TokenGeneratorWithRevocation(c.Request.Context(), userData, refreshToken)
+	// A DPoP-bound refresh token requires a proof from the same key
+	ctx := mw.refreshContext(c.Request.Context(), c, data)
+	if mw.EnableDPoP {
+		boundJKT, err := mw.refreshTokenBinding(ctx, refreshToken)
+		if err == nil {
+			ctx, err = mw.dpopTokenContext(c, boundJKT)
+		}
+		if err != nil {
+			mw.emit(c, EventRefreshFailure, userData, err)
+			mw.countOutcome(MetricRefreshes, OutcomeFailure, err)
+			mw.unauthorized(c, PhaseRefresh, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	ctx, fingerprint, err := mw.fingerprintContext(mw.certificateContext(ctx, c))
+
+	// Exchange the refresh token for a new token pair, only once
+	var tokenPair *core.Token
+	var replayed bool
+	if err == nil {
+		tokenPair, replayed, err = mw.exchangeRefreshToken(ctx, userData, refreshToken)
+	}
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		mw.emit(c, EventRefreshFailure, userData, err)
+		mw.countOutcome(MetricRefreshes, OutcomeFailure, err)
+		mw.unauthorized(c, PhaseRefresh, http.StatusUnauthorized, err)
+		return
+	}
 	if err != nil {
-		mw.unauthorized(c, http.StatusInternalServerError, mw.HTTPStatusMessageFunc(c, err))
+		mw.emit(c, EventRefreshFailure, userData, err)
+		mw.countOutcome(MetricRefreshes, OutcomeError, err)
+		mw.unauthorized(c, PhaseRefresh, http.StatusInternalServerError, err)
+		return
+	}
+	if replayed {
+		mw.replayRotation(c, tokenPair)
 		return
 	}
 
+	mw.emit(c, EventRefreshTokenRevoked, userData, nil)
+	mw.emit(c, EventTokenIssued, userData, nil)
+	mw.emit(c, EventRefreshSuccess, userData, nil)
+	mw.countOutcome(MetricRefreshes, OutcomeSuccess, nil)
+
 	// Set cookies
 	mw.SetCookie(c, tokenPair.AccessToken)
 	mw.SetRefreshTokenCookie(c, tokenPair.RefreshToken)
+	if fingerprint != "" {
+		mw.setFingerprintCookie(c, fingerprint)
+	}
 
 	mw.RefreshResponse(c, tokenPair)
 }
@@ -836,7 +1642,10 @@ func (mw *GinJWTMiddleware) CheckIfTokenExpire(c *gin.Context) (jwt.MapClaims, e
 }
 
 // generateAccessToken method that clients can use to get a jwt token.
-func (mw *GinJWTMiddleware) generateAccessToken(data any) (string, time.Time, error) {
+func (mw *GinJWTMiddleware) generateAccessToken(
+	ctx context.Context,
+	data any,
+) (string, time.Time, error) {
 	// 1. Validate signing algorithm
 	signingMethod := jwt.GetSigningMethod(mw.SigningAlgorithm)
 	if signingMethod == nil {
@@ -858,25 +1667,57 @@ func (mw *GinJWTMiddleware) generateAccessToken(data any) (string, time.Time, er
 		"orig_iat": true, // Framework uses this for refresh mechanism
 	}
 
-	// 3. Safely add custom payload, avoiding framework-controlled field overwrites
-	if mw.PayloadFunc != nil {
-		for key, value := range mw.PayloadFunc(data) {
-			if !frameworkClaims[key] {
-				claims[key] = value
-			}
+	// 3. Safely add custom payload, avoiding framework-controlled field overwrites.
+	// A renewed token keeps the claims of the token it replaces.
+	payload := jwt.MapClaims(nil)
+	renewed := renewalFromContext(ctx)
+	if renewed != nil {
+		payload = renewed.claims
+		frameworkClaims[mw.ExpField] = true
+	} else if mw.PayloadFunc != nil {
+		payload = mw.PayloadFunc(data)
+	}
+	for key, value := range payload {
+		if !frameworkClaims[key] {
+			claims[key] = value
 		}
 	}
 
 	// 4. Calculate expiration time using original data instead of claims
-	expire := mw.TimeFunc().Add(mw.TimeoutFunc(data))
+	now := mw.TimeFunc()
+	var expire time.Time
+	if renewed != nil {
+		expire = now.Add(renewed.lifetime)
+	} else {
+		expire = now.Add(mw.TimeoutFunc(data))
+	}
 
 	// 5. Set required system claims
-	now := mw.TimeFunc()
+	origIat := now
+	if renewed != nil {
+		// A sliding session keeps its login time and never outlives SessionMaxAge
+		origIat = renewed.sessionStart
+		if expire.After(renewed.sessionEnd) {
+			expire = renewed.sessionEnd
+		}
+		claims["iat"] = now.Unix()
+	}
 	claims[mw.ExpField] = expire.Unix()
-	claims["orig_iat"] = now.Unix()
+	claims["orig_iat"] = origIat.Unix()
+	if sessionID := sessionIDFromContext(ctx); sessionID != "" {
+		claims[claimSessionID] = sessionID
+	}
+
+	// Bind the token to the DPoP key (RFC 9449) or certificate (RFC 8705) of the client
+	if cnf := confirmationClaim(ctx); cnf != nil {
+		claims[claimConfirmation] = cnf
+	}
+	if fgp := fingerprintClaim(ctx); fgp != "" {
+		claims[claimFingerprint] = fgp
+	}
 
 	// 6. Sign the token
-	tokenString, err := mw.signedString(token)
+	tokenString, err := mw.signedString(ctx, token)
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -885,9 +1726,15 @@ func (mw *GinJWTMiddleware) generateAccessToken(data any) (string, time.Time, er
 }
 
 // TokenGenerator generates a complete token pair (access + refresh) with RFC 6749 compliance
-func (mw *GinJWTMiddleware) TokenGenerator(ctx context.Context, data any) (*core.Token, error) {
+func (mw *GinJWTMiddleware) TokenGenerator(ctx context.Context, data any) (_ *core.Token, err error) {
+	ctx, span := mw.startSpan(ctx, SpanTokenGenerator)
+	defer func() { endSpan(span, err) }()
+
+	// The access token and the refresh token identify the same session
+	ctx = withSessionID(ctx)
+
 	// Generate access token
-	accessToken, expire, err := mw.generateAccessToken(data)
+	accessToken, expire, err := mw.generateAccessToken(ctx, data)
 	if err != nil {
 		return nil, err
 	}
@@ -903,10 +1750,21 @@ func (mw *GinJWTMiddleware) TokenGenerator(ctx context.Context, data any) (*core
 		return nil, err
 	}
 
+	tokenType := "Bearer"
+	if jkt := dpopThumbprint(ctx); jkt != "" {
+		policy := mw.refreshPolicyFromContext(ctx)
+		expiry := mw.refreshTokenExpiry(mw.TimeFunc(), policy.timeout)
+		key := dpopBindingKey(refreshToken)
+		if err := mw.setStoreRecord(ctx, core.KindDPoPBinding, key, jkt, expiry); err != nil {
+			return nil, err
+		}
+		tokenType = dpopScheme
+	}
+
 	now := mw.TimeFunc()
 	return &core.Token{
 		AccessToken:  accessToken,
-		TokenType:    "Bearer",
+		TokenType:    tokenType,
 		RefreshToken: refreshToken,
 		ExpiresAt:    expire.Unix(),
 		CreatedAt:    now.Unix(),
@@ -925,6 +1783,15 @@ func (mw *GinJWTMiddleware) TokenGeneratorWithRevocation(
 		return nil, err
 	}
 
+	// Within a grace period, the old refresh token keeps pointing to the new pair
+	if rotation, ok := mw.rotationStore(); ok {
+		if err := mw.rotateRefreshToken(ctx, rotation, oldRefreshToken, tokenPair); err != nil &&
+			!errors.Is(err, core.ErrRefreshTokenNotFound) {
+			return nil, err
+		}
+		return tokenPair, nil
+	}
+
 	// Revoke old refresh token, ignore if token already doesn't exist
 	if err := mw.revokeRefreshToken(ctx, oldRefreshToken); err != nil &&
 		!errors.Is(err, core.ErrRefreshTokenNotFound) {
@@ -942,9 +1809,11 @@ func (mw *GinJWTMiddleware) jwtFromHeader(c *gin.Context, key string) (string, e
 	}
 
 	parts := strings.SplitN(authHeader, " ", 2)
-	if len(parts) != 2 || parts[0] != mw.TokenHeadName {
+	if len(parts) != 2 ||
+		(parts[0] != mw.TokenHeadName && (!mw.EnableDPoP || parts[0] != dpopScheme)) {
 		return "", ErrInvalidAuthHeader
 	}
+	c.Set(authSchemeContextKey, parts[0])
 
 	return parts[1], nil
 }
@@ -960,12 +1829,13 @@ func (mw *GinJWTMiddleware) jwtFromQuery(c *gin.Context, key string) (string, er
 }
 
 func (mw *GinJWTMiddleware) jwtFromCookie(c *gin.Context, key string) (string, error) {
-	cookie, _ := c.Cookie(key)
+	cookie := readChunkedCookie(c, key)
 
 	if cookie == "" {
 		return "", ErrEmptyCookieToken
 	}
 
+	c.Set(tokenSourceContextKey, tokenLookupCookie)
 	return cookie, nil
 }
 
@@ -1020,9 +1890,25 @@ func (mw *GinJWTMiddleware) ParseToken(c *gin.Context) (*jwt.Token, error) {
 		return nil, err
 	}
 
+	ctx, span := mw.startSpan(c.Request.Context(), SpanParseToken)
+	parsed, err := mw.parseToken(ctx, c, token)
+	if parsed != nil && parsed.Method != nil {
+		span.SetAttribute(SpanAttrAlgorithm, parsed.Method.Alg())
+	}
+	endSpan(span, err)
+
+	return parsed, err
+}
+
+// parseToken verifies token and saves it in c once the key is resolved.
+func (mw *GinJWTMiddleware) parseToken(
+	ctx context.Context,
+	c *gin.Context,
+	token string,
+) (*jwt.Token, error) {
 	if mw.KeyFunc != nil {
 		return jwt.Parse(token, func(t *jwt.Token) (any, error) {
-			key, err := mw.KeyFunc(t)
+			key, err := mw.tracedKeyFunc(ctx, t)
 			if err != nil {
 				return nil, err
 			}
@@ -1038,24 +1924,27 @@ func (mw *GinJWTMiddleware) ParseToken(c *gin.Context) (*jwt.Token, error) {
 		if jwt.GetSigningMethod(mw.SigningAlgorithm) != t.Method {
 			return nil, ErrInvalidSigningAlgorithm
 		}
-		if mw.usingPublicKeyAlgo() {
-			return mw.pubKey, nil
-		}
 
-		// save token string if valid
+		// save token string if valid, for the DPoP and CSRF checks too
 		c.Set(tokenContextKey, token)
 
+		if mw.usingPublicKeyAlgo() {
+			return mw.pubKey, nil
+		}
 		return mw.Key, nil
 	}, mw.ParseOptions...)
 }
 
 // ParseTokenString parse jwt token string
 func (mw *GinJWTMiddleware) ParseTokenString(token string) (*jwt.Token, error) {
-	if mw.KeyFunc != nil {
-		return jwt.Parse(token, mw.KeyFunc, mw.ParseOptions...)
-	}
+	return mw.parseTokenString(context.Background(), token)
+}
 
-	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
+// parseTokenString parses token inside a span that is a child of ctx.
+func (mw *GinJWTMiddleware) parseTokenString(ctx context.Context, token string) (*jwt.Token, error) {
+	ctx, span := mw.startSpan(ctx, SpanParseToken)
+
+	keyFunc := func(t *jwt.Token) (any, error) {
 		if jwt.GetSigningMethod(mw.SigningAlgorithm) != t.Method {
 			return nil, ErrInvalidSigningAlgorithm
 		}
@@ -1064,27 +1953,49 @@ func (mw *GinJWTMiddleware) ParseTokenString(token string) (*jwt.Token, error) {
 		}
 
 		return mw.Key, nil
-	}, mw.ParseOptions...)
+	}
+	if mw.KeyFunc != nil {
+		keyFunc = func(t *jwt.Token) (any, error) {
+			return mw.tracedKeyFunc(ctx, t)
+		}
+	}
+
+	parsed, err := jwt.Parse(token, keyFunc, mw.ParseOptions...)
+	if parsed != nil && parsed.Method != nil {
+		span.SetAttribute(SpanAttrAlgorithm, parsed.Method.Alg())
+	}
+	endSpan(span, err)
+
+	return parsed, err
 }
 
 // unauthorized handles unauthorized requests by setting the WWW-Authenticate header
-// and calling the user-defined Unauthorized callback.
+// and calling ErrorHandler, or the user-defined Unauthorized callback with the message of err.
 //
 // According to RFC 6750 (OAuth 2.0 Bearer Token Usage) and RFC 7235 (HTTP Authentication),
 // a 401 Unauthorized response must include a WWW-Authenticate header with the Bearer scheme.
 // This ensures compatibility with standard HTTP clients and authentication frameworks.
+// The error and error_description attributes tell clients why the token was refused.
 //
 // See:
 //   - https://tools.ietf.org/html/rfc6750
 //   - https://tools.ietf.org/html/rfc7235
 //   - https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/401
-func (mw *GinJWTMiddleware) unauthorized(c *gin.Context, code int, message string) {
-	c.Header("WWW-Authenticate", "Bearer realm=\""+mw.Realm+"\"")
+func (mw *GinJWTMiddleware) unauthorized(c *gin.Context, phase Phase, code int, err error) {
+	authErr := newAuthError(phase, code, err)
+
+	c.Header("WWW-Authenticate", mw.bearerChallenge(authErr))
+	c.Set(errorContextKey, authErr)
 	if !mw.DisabledAbort {
 		c.Abort()
 	}
 
-	mw.Unauthorized(c, code, message)
+	if mw.ErrorHandler != nil {
+		mw.ErrorHandler(c, authErr)
+		return
+	}
+
+	mw.Unauthorized(c, code, mw.HTTPStatusMessageFunc(c, err))
 }
 
 // ExtractClaims help to extract the JWT claims
@@ -1139,19 +2050,14 @@ func (mw *GinJWTMiddleware) SetCookie(c *gin.Context, token string) {
 		expireCookie := mw.TimeFunc().Add(mw.CookieMaxAge)
 		maxage := int(expireCookie.Unix() - mw.TimeFunc().Unix())
 
-		if mw.CookieSameSite != 0 {
-			c.SetSameSite(mw.CookieSameSite)
+		chunks := mw.writeChunkedCookie(c, mw.accessTokenCookiePolicy(), token, maxage)
+		if chunks > 0 {
+			mw.reportOversizedCookie(c, len(token), chunks)
 		}
 
-		c.SetCookie(
-			mw.CookieName,
-			token,
-			maxage,
-			"/",
-			mw.CookieDomain,
-			mw.SecureCookie,
-			mw.CookieHTTPOnly,
-		)
+		if mw.EnableCSRF {
+			mw.setCSRFCookie(c, token, maxage)
+		}
 	}
 }
 
@@ -1159,25 +2065,18 @@ func (mw *GinJWTMiddleware) SetCookie(c *gin.Context, token string) {
 func (mw *GinJWTMiddleware) SetRefreshTokenCookie(c *gin.Context, refreshToken string) {
 	if mw.SendCookie {
 		now := mw.TimeFunc()
-		expireCookie := mw.refreshTokenExpiry(now)
+		expireCookie, session := mw.refreshCookieExpiry(c, refreshToken, now)
+		if session {
+			writeCookie(c, mw.refreshTokenCookiePolicy(), refreshToken, 0)
+			return
+		}
+
 		maxage := int(expireCookie.Sub(now).Seconds())
 		if maxage <= 0 && expireCookie.After(now) {
 			maxage = 1 // round up sub-second positive durations
 		}
 
-		if mw.CookieSameSite != 0 {
-			c.SetSameSite(mw.CookieSameSite)
-		}
-
-		c.SetCookie(
-			mw.RefreshTokenCookieName,
-			refreshToken,
-			maxage,
-			"/",
-			mw.CookieDomain,
-			true, // Always secure for refresh tokens (HTTPS only)
-			true, // Always httpOnly for security
-		)
+		writeCookie(c, mw.refreshTokenCookiePolicy(), refreshToken, maxage)
 	}
 }
 
@@ -1185,13 +2084,13 @@ func (mw *GinJWTMiddleware) SetRefreshTokenCookie(c *gin.Context, refreshToken s
 func (mw *GinJWTMiddleware) handleTokenError(c *gin.Context, err error) {
 	switch {
 	case errors.Is(err, jwt.ErrTokenExpired):
-		mw.unauthorized(c, http.StatusUnauthorized, mw.HTTPStatusMessageFunc(c, ErrExpiredToken))
+		mw.unauthorized(c, PhaseParse, http.StatusUnauthorized, ErrExpiredToken)
 	case errors.Is(err, jwt.ErrInvalidType) && strings.Contains(err.Error(), "exp is invalid"):
-		mw.unauthorized(c, http.StatusBadRequest, mw.HTTPStatusMessageFunc(c, ErrWrongFormatOfExp))
+		mw.unauthorized(c, PhaseParse, http.StatusBadRequest, ErrWrongFormatOfExp)
 	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing) && strings.Contains(err.Error(), "exp claim is required"):
-		mw.unauthorized(c, http.StatusBadRequest, mw.HTTPStatusMessageFunc(c, ErrMissingExpField))
+		mw.unauthorized(c, PhaseParse, http.StatusBadRequest, ErrMissingExpField)
 	default:
-		mw.unauthorized(c, http.StatusUnauthorized, mw.HTTPStatusMessageFunc(c, err))
+		mw.unauthorized(c, PhaseParse, http.StatusUnauthorized, err)
 	}
 }
 
@@ -0,0 +1,222 @@
+package jwt
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cookie name prefixes enforced by browsers (RFC 6265bis section 4.1.3)
+const (
+	// CookiePrefixHost requires Secure, Path "/" and no Domain
+	CookiePrefixHost = "__Host-"
+	// CookiePrefixSecure requires Secure
+	CookiePrefixSecure = "__Secure-"
+)
+
+// DefaultCookieChunkSize keeps a cookie, name and value, under the 4096 bytes browsers accept
+const DefaultCookieChunkSize = 3800
+
+// CookiePolicy describes how a cookie written by the middleware is scoped and protected.
+type CookiePolicy struct {
+	// Name of the cookie. Optional, defaults to CookieName or RefreshTokenCookieName.
+	Name string
+
+	// Path of the cookie. Optional, defaults to "/".
+	// Scoping the refresh token cookie to the refresh endpoint keeps it out of other requests.
+	Path string
+
+	// Domain of the cookie. Empty means host-only.
+	Domain string
+
+	// SameSite attribute of the cookie. Zero omits the attribute.
+	SameSite http.SameSite
+
+	// Secure restricts the cookie to HTTPS
+	Secure bool
+
+	// HttpOnly hides the cookie from JavaScript
+	HttpOnly bool
+
+	// Partitioned stores the cookie per top-level site (CHIPS), for embedded third-party use.
+	// Requires Secure.
+	Partitioned bool
+}
+
+// Validate checks the attributes required by the name prefix and by Partitioned.
+func (p CookiePolicy) Validate() error {
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("%w: missing name", ErrInvalidCookiePolicy)
+	case strings.HasPrefix(p.Name, CookiePrefixHost) && (!p.Secure || p.Path != "/" || p.Domain != ""):
+		return fmt.Errorf("%w: %s cookie %q must be Secure with Path \"/\" and no Domain",
+			ErrInvalidCookiePolicy, CookiePrefixHost, p.Name)
+	case strings.HasPrefix(p.Name, CookiePrefixSecure) && !p.Secure:
+		return fmt.Errorf("%w: %s cookie %q must be Secure",
+			ErrInvalidCookiePolicy, CookiePrefixSecure, p.Name)
+	case p.Partitioned && !p.Secure:
+		return fmt.Errorf("%w: partitioned cookie %q must be Secure", ErrInvalidCookiePolicy, p.Name)
+	}
+	return nil
+}
+
+// withDefaults fills the name and path of p.
+func (p CookiePolicy) withDefaults(name string) CookiePolicy {
+	if p.Name == "" {
+		p.Name = name
+	}
+	if p.Path == "" {
+		p.Path = "/"
+	}
+	return p
+}
+
+// accessTokenCookiePolicy returns AccessTokenCookie, or the policy built from the
+// flat cookie fields when it is nil.
+func (mw *GinJWTMiddleware) accessTokenCookiePolicy() CookiePolicy {
+	if mw.AccessTokenCookie != nil {
+		return mw.AccessTokenCookie.withDefaults(mw.CookieName)
+	}
+
+	return CookiePolicy{
+		Name:     mw.CookieName,
+		Path:     "/",
+		Domain:   mw.CookieDomain,
+		SameSite: mw.CookieSameSite,
+		Secure:   mw.SecureCookie,
+		HttpOnly: mw.CookieHTTPOnly,
+	}
+}
+
+// refreshTokenCookiePolicy returns RefreshTokenCookie, or the policy built from the
+// flat cookie fields when it is nil. That policy is always Secure and HttpOnly.
+func (mw *GinJWTMiddleware) refreshTokenCookiePolicy() CookiePolicy {
+	if mw.RefreshTokenCookie != nil {
+		return mw.RefreshTokenCookie.withDefaults(mw.RefreshTokenCookieName)
+	}
+
+	return CookiePolicy{
+		Name:     mw.RefreshTokenCookieName,
+		Path:     "/",
+		Domain:   mw.CookieDomain,
+		SameSite: mw.CookieSameSite,
+		Secure:   true,
+		HttpOnly: true,
+	}
+}
+
+// initializeCookiePolicies validates the cookie policies in use.
+func (mw *GinJWTMiddleware) initializeCookiePolicies() error {
+	if !mw.SendCookie {
+		return nil
+	}
+
+	if err := mw.accessTokenCookiePolicy().Validate(); err != nil {
+		return err
+	}
+	return mw.refreshTokenCookiePolicy().Validate()
+}
+
+// writeCookie sets a cookie following p. A negative maxAge deletes the cookie.
+// The value is escaped like gin.Context.SetCookie, so c.Cookie reads it back unchanged.
+func writeCookie(c *gin.Context, p CookiePolicy, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:        p.Name,
+		Value:       url.QueryEscape(value),
+		Path:        p.Path,
+		Domain:      p.Domain,
+		MaxAge:      maxAge,
+		SameSite:    p.SameSite,
+		Secure:      p.Secure,
+		HttpOnly:    p.HttpOnly,
+		Partitioned: p.Partitioned,
+	})
+}
+
+// cookieChunkName returns the name of the i-th chunk of a cookie, e.g. jwt.0.
+func cookieChunkName(name string, i int) string {
+	return name + "." + strconv.Itoa(i)
+}
+
+// writeChunkedCookie writes value in one cookie, or split across name.0, name.1, ... when
+// it exceeds CookieChunkSize. The cookies of the other layout and the chunks left over from a
+// larger value are deleted. It returns the number of chunks, 0 when value fits one cookie.
+func (mw *GinJWTMiddleware) writeChunkedCookie(
+	c *gin.Context,
+	p CookiePolicy,
+	value string,
+	maxAge int,
+) int {
+	size := mw.CookieChunkSize
+	if size <= 0 {
+		size = DefaultCookieChunkSize
+	}
+
+	if len(value) <= size {
+		writeCookie(c, p, value, maxAge)
+		deleteCookieChunks(c, p, 0)
+		return 0
+	}
+
+	chunks := 0
+	for start := 0; start < len(value); start += size {
+		chunk := p
+		chunk.Name = cookieChunkName(p.Name, chunks)
+		writeCookie(c, chunk, value[start:min(start+size, len(value))], maxAge)
+		chunks++
+	}
+
+	if hasCookie(c, p.Name) {
+		writeCookie(c, p, "", -1)
+	}
+	deleteCookieChunks(c, p, chunks)
+	return chunks
+}
+
+// reportOversizedCookie warns that an access token of size bytes was split into chunks cookies.
+func (mw *GinJWTMiddleware) reportOversizedCookie(c *gin.Context, size, chunks int) {
+	err := fmt.Errorf("%w: %d bytes split into %d cookies", ErrCookieTooLarge, size, chunks)
+	mw.logger().Warn("access token exceeds the cookie size", logKeyError, err)
+	mw.emit(c, EventCookieOversized, nil, err)
+}
+
+// deleteCookieChunks deletes the chunks of p the request carries, starting at index from.
+func deleteCookieChunks(c *gin.Context, p CookiePolicy, from int) {
+	for i := from; ; i++ {
+		chunk := p
+		chunk.Name = cookieChunkName(p.Name, i)
+		if !hasCookie(c, chunk.Name) {
+			return
+		}
+		writeCookie(c, chunk, "", -1)
+	}
+}
+
+// hasCookie reports whether the request carries the named cookie.
+func hasCookie(c *gin.Context, name string) bool {
+	if c.Request == nil {
+		return false
+	}
+	_, err := c.Request.Cookie(name)
+	return err == nil
+}
+
+// readChunkedCookie returns the value of a cookie, reassembled from its chunks if needed.
+func readChunkedCookie(c *gin.Context, name string) string {
+	if value, _ := c.Cookie(name); value != "" {
+		return value
+	}
+
+	var value strings.Builder
+	for i := 0; ; i++ {
+		chunk, _ := c.Cookie(cookieChunkName(name, i))
+		if chunk == "" {
+			return value.String()
+		}
+		value.WriteString(chunk)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -643,6 +644,216 @@ func TestExtractRefreshTokenContentType(t *testing.T) {
 	})
 }
 
+func TestCookiePolicyValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy CookiePolicy
+		valid  bool
+	}{
+		{"plain", CookiePolicy{Name: "jwt", Path: "/"}, true},
+		{"missing name", CookiePolicy{Path: "/"}, false},
+		{"host", CookiePolicy{Name: "__Host-jwt", Path: "/", Secure: true}, true},
+		{"host not secure", CookiePolicy{Name: "__Host-jwt", Path: "/"}, false},
+		{"host with domain", CookiePolicy{
+			Name: "__Host-jwt", Path: "/", Domain: "example.com", Secure: true,
+		}, false},
+		{"host with path", CookiePolicy{Name: "__Host-jwt", Path: "/auth", Secure: true}, false},
+		{"secure", CookiePolicy{Name: "__Secure-jwt", Path: "/auth", Secure: true}, true},
+		{"secure not secure", CookiePolicy{Name: "__Secure-jwt", Path: "/"}, false},
+		{"partitioned", CookiePolicy{Name: "jwt", Path: "/", Secure: true, Partitioned: true}, true},
+		{"partitioned not secure", CookiePolicy{Name: "jwt", Path: "/", Partitioned: true}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.policy.Validate()
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidCookiePolicy)
+			}
+		})
+	}
+}
+
+func TestCookiePolicyValidatedByNew(t *testing.T) {
+	_, err := New(&GinJWTMiddleware{
+		Key:           key,
+		Authenticator: validAuthenticator,
+		SendCookie:    true,
+		AccessTokenCookie: &CookiePolicy{
+			Name:   "__Host-jwt",
+			Domain: "example.com",
+			Secure: true,
+		},
+	})
+	assert.ErrorIs(t, err, ErrInvalidCookiePolicy)
+}
+
+func TestCookiePolicies(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: validAuthenticator,
+		SendCookie:    true,
+		AccessTokenCookie: &CookiePolicy{
+			Name:        "__Host-jwt",
+			SameSite:    http.SameSiteNoneMode,
+			Secure:      true,
+			HttpOnly:    true,
+			Partitioned: true,
+		},
+		// Plain HTTP in development, only sent to the refresh endpoint
+		RefreshTokenCookie: &CookiePolicy{
+			Path:     "/auth/refresh_token",
+			SameSite: http.SameSiteStrictMode,
+			HttpOnly: true,
+		},
+	})
+	require.NoError(t, err)
+
+	handler := ginHandler(authMiddleware)
+
+	gofight.New().POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": testPassword}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			require.Equal(t, http.StatusOK, r.Code)
+
+			access := findCookie(r, "__Host-jwt")
+			require.NotNil(t, access)
+			assert.Equal(t, "/", access.Path)
+			assert.True(t, access.Secure)
+			assert.True(t, access.HttpOnly)
+			assert.True(t, access.Partitioned)
+			assert.Equal(t, http.SameSiteNoneMode, access.SameSite)
+
+			refresh := findCookie(r, "refresh_token")
+			require.NotNil(t, refresh)
+			assert.Equal(t, "/auth/refresh_token", refresh.Path)
+			assert.False(t, refresh.Secure)
+			assert.True(t, refresh.HttpOnly)
+			assert.Equal(t, http.SameSiteStrictMode, refresh.SameSite)
+			value, err := url.QueryUnescape(refresh.Value)
+			require.NoError(t, err)
+			assert.Equal(t, gjson.Get(r.Body.String(), "refresh_token").String(), value)
+		})
+
+	gofight.New().POST("/logout").
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			refresh := findCookie(r, "refresh_token")
+			require.NotNil(t, refresh)
+			assert.Equal(t, "/auth/refresh_token", refresh.Path)
+			assert.Negative(t, refresh.MaxAge)
+
+			access := findCookie(r, "__Host-jwt")
+			require.NotNil(t, access)
+			assert.Negative(t, access.MaxAge)
+		})
+}
+
+func TestCookieChunks(t *testing.T) {
+	var events []*Event
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:           "test zone",
+		Key:             key,
+		Timeout:         time.Hour,
+		Authenticator:   validAuthenticator,
+		SendCookie:      true,
+		TokenLookup:     "cookie:jwt",
+		CookieChunkSize: 100,
+		EventHandler: EventHandlerFunc(func(ctx context.Context, event *Event) {
+			events = append(events, event)
+		}),
+	})
+	require.NoError(t, err)
+
+	handler := ginHandler(authMiddleware)
+	var chunks []*http.Cookie
+
+	gofight.New().POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": testPassword}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			require.Equal(t, http.StatusOK, r.Code)
+			assert.Nil(t, findCookie(r, "jwt"))
+
+			token := gjson.Get(r.Body.String(), "access_token").String()
+			var value strings.Builder
+			for i := 0; findCookie(r, cookieChunkName("jwt", i)) != nil; i++ {
+				chunk := findCookie(r, cookieChunkName("jwt", i))
+				assert.LessOrEqual(t, len(chunk.Value), 100)
+				chunks = append(chunks, chunk)
+				value.WriteString(chunk.Value)
+			}
+			assert.Len(t, chunks, (len(token)+99)/100)
+			assert.Equal(t, token, value.String())
+		})
+
+	require.NotEmpty(t, events)
+	oversized := events[len(events)-1]
+	for _, event := range events {
+		if event.Type == EventCookieOversized {
+			oversized = event
+		}
+	}
+	assert.Equal(t, EventCookieOversized, oversized.Type)
+	assert.Equal(t, ReasonCookieTooLarge, oversized.Reason)
+	assert.ErrorIs(t, oversized.Err, ErrCookieTooLarge)
+
+	cookies := make(map[string]string, len(chunks))
+	for _, chunk := range chunks {
+		cookies[chunk.Name] = chunk.Value
+	}
+
+	gofight.New().GET("/auth/hello").
+		SetCookie(cookies).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	// Stale chunks and the unchunked cookie are deleted when the token shrinks
+	stale := make(map[string]string, len(cookies)+2)
+	for name, value := range cookies {
+		stale[name] = value
+	}
+	stale["jwt"] = "old"
+	stale[cookieChunkName("jwt", len(chunks))] = "old"
+	stale[cookieChunkName("jwt", len(chunks)+1)] = "old"
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+	for name, value := range stale {
+		c.Request.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	authMiddleware.SetCookie(c, strings.Repeat("a", 150))
+
+	written := make(map[string]*http.Cookie)
+	for _, cookie := range w.Result().Cookies() {
+		written[cookie.Name] = cookie
+	}
+	require.Contains(t, written, "jwt")
+	assert.Negative(t, written["jwt"].MaxAge)
+	assert.Equal(t, strings.Repeat("a", 100), written["jwt.0"].Value)
+	assert.Equal(t, strings.Repeat("a", 50), written["jwt.1"].Value)
+	assert.Positive(t, written["jwt.1"].MaxAge)
+	for i := 2; i < len(chunks)+2; i++ {
+		name := cookieChunkName("jwt", i)
+		require.Contains(t, written, name)
+		assert.Negative(t, written[name].MaxAge)
+	}
+
+	gofight.New().POST("/logout").
+		SetCookie(cookies).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			for name := range cookies {
+				cookie := findCookie(r, name)
+				require.NotNil(t, cookie)
+				assert.Negative(t, cookie.MaxAge)
+			}
+		})
+}
+
 // Helper function to check if a string contains a substring
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) &&
@@ -0,0 +1,148 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Default names of the CSRF cookie, header and form field
+const (
+	DefaultCSRFCookieName = "csrf_token"
+	DefaultCSRFHeaderName = "X-CSRF-Token"
+	DefaultCSRFFormField  = "csrf_token"
+)
+
+const (
+	tokenSourceContextKey = "JWT_TOKEN_SOURCE"
+	csrfTokenLength       = 32
+)
+
+// initializeCSRF sets the CSRF defaults. Without CSRFKey, the key is derived from Key
+// so that CSRF tokens survive restarts, or random for public key algorithms.
+func (mw *GinJWTMiddleware) initializeCSRF() error {
+	if !mw.EnableCSRF {
+		return nil
+	}
+
+	if mw.CSRFCookieName == "" {
+		mw.CSRFCookieName = DefaultCSRFCookieName
+	}
+	if mw.CSRFHeaderName == "" {
+		mw.CSRFHeaderName = DefaultCSRFHeaderName
+	}
+	if mw.CSRFFormField == "" {
+		mw.CSRFFormField = DefaultCSRFFormField
+	}
+	if len(mw.CSRFKey) > 0 {
+		return nil
+	}
+
+	if len(mw.Key) > 0 {
+		mac := hmac.New(sha256.New, mw.Key)
+		mac.Write([]byte("gin-jwt csrf"))
+		mw.CSRFKey = mac.Sum(nil)
+		return nil
+	}
+
+	mw.CSRFKey = make([]byte, csrfTokenLength)
+	_, err := rand.Read(mw.CSRFKey)
+	return err
+}
+
+// csrfSignature binds a CSRF nonce to the access token it was issued with.
+func (mw *GinJWTMiddleware) csrfSignature(nonce []byte, accessToken string) []byte {
+	tokenHash := sha256.Sum256([]byte(accessToken))
+	mac := hmac.New(sha256.New, mw.CSRFKey)
+	mac.Write(nonce)
+	mac.Write(tokenHash[:])
+	return mac.Sum(nil)
+}
+
+// newCSRFToken returns a signed double-submit token for accessToken.
+func (mw *GinJWTMiddleware) newCSRFToken(accessToken string) (string, error) {
+	nonce := make([]byte, csrfTokenLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(nonce) + "." +
+		base64.RawURLEncoding.EncodeToString(mw.csrfSignature(nonce, accessToken)), nil
+}
+
+// validCSRFToken reports whether csrfToken was issued together with accessToken.
+func (mw *GinJWTMiddleware) validCSRFToken(csrfToken, accessToken string) bool {
+	encodedNonce, encodedSignature, ok := strings.Cut(csrfToken, ".")
+	if !ok {
+		return false
+	}
+	nonce, err := base64.RawURLEncoding.DecodeString(encodedNonce)
+	if err != nil {
+		return false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(signature, mw.csrfSignature(nonce, accessToken))
+}
+
+// setCSRFCookie issues the CSRF cookie alongside the access token cookie.
+// The cookie is readable by JavaScript, which echoes it in CSRFHeaderName.
+func (mw *GinJWTMiddleware) setCSRFCookie(c *gin.Context, accessToken string, maxAge int) {
+	csrfToken, err := mw.newCSRFToken(accessToken)
+	if err != nil {
+		mw.logger().Error("failed to generate CSRF token", logKeyError, err)
+		return
+	}
+
+	writeCookie(c, mw.csrfCookiePolicy(), csrfToken, maxAge)
+}
+
+// csrfCookiePolicy scopes the CSRF cookie like the access token cookie, but readable by JavaScript.
+func (mw *GinJWTMiddleware) csrfCookiePolicy() CookiePolicy {
+	p := mw.accessTokenCookiePolicy()
+	p.Name = mw.CSRFCookieName
+	p.HttpOnly = false
+	return p
+}
+
+// isSafeMethod reports whether method is safe per RFC 9110 section 9.2.1.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// checkCSRF validates the CSRF token of unsafe requests whose access token came from a cookie.
+// accessToken is the token parsed from the request, which the CSRF token is derived from.
+func (mw *GinJWTMiddleware) checkCSRF(c *gin.Context, accessToken string) error {
+	if c.GetString(tokenSourceContextKey) != tokenLookupCookie || isSafeMethod(c.Request.Method) {
+		return nil
+	}
+	if mw.CSRFExempt != nil && mw.CSRFExempt(c) {
+		return nil
+	}
+
+	submitted := c.GetHeader(mw.CSRFHeaderName)
+	if submitted == "" {
+		submitted = c.PostForm(mw.CSRFFormField)
+	}
+	cookie, _ := c.Cookie(mw.CSRFCookieName)
+
+	if submitted == "" || cookie == "" ||
+		subtle.ConstantTimeCompare([]byte(submitted), []byte(cookie)) != 1 ||
+		!mw.validCSRFToken(cookie, accessToken) {
+		return ErrInvalidCSRFToken
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package jwt
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newCSRFHandler(
+	t *testing.T,
+	exempt func(c *gin.Context) bool,
+) (*gin.Engine, *GinJWTMiddleware) {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: validAuthenticator,
+		SendCookie:    true,
+		TokenLookup:   "header:Authorization, cookie:jwt",
+		EnableCSRF:    true,
+		CSRFExempt:    exempt,
+	})
+	require.NoError(t, err)
+
+	handler := ginHandler(authMiddleware)
+	handler.POST("/auth/hello", authMiddleware.MiddlewareFunc(), helloHandler)
+	handler.POST("/webhook", authMiddleware.MiddlewareFunc(), helloHandler)
+	return handler, authMiddleware
+}
+
+// csrfLogin returns the access token and CSRF cookie values of a login.
+func csrfLogin(t *testing.T, handler *gin.Engine) (string, string) {
+	t.Helper()
+
+	r := testLogin(t, handler, testAdmin, nil)
+	cookie := findCookie(r, DefaultCSRFCookieName)
+	require.NotNil(t, cookie)
+	assert.False(t, cookie.HttpOnly)
+	return gjson.Get(r.Body.String(), "access_token").String(), cookie.Value
+}
+
+func TestCSRFCookieToken(t *testing.T) {
+	handler, _ := newCSRFHandler(t, nil)
+	accessToken, csrfToken := csrfLogin(t, handler)
+	cookies := gofight.H{"jwt": accessToken, DefaultCSRFCookieName: csrfToken}
+
+	gofight.New().POST("/auth/hello").
+		SetCookie(cookies).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusForbidden, r.Code)
+			assert.Equal(t, ErrInvalidCSRFToken.Error(),
+				gjson.Get(r.Body.String(), "message").String())
+		})
+
+	gofight.New().POST("/auth/hello").
+		SetCookie(cookies).
+		SetHeader(gofight.H{DefaultCSRFHeaderName: csrfToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	gofight.New().POST("/auth/hello").
+		SetCookie(cookies).
+		SetForm(gofight.H{DefaultCSRFFormField: csrfToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	// Safe methods are not checked
+	gofight.New().GET("/auth/hello").
+		SetCookie(gofight.H{"jwt": accessToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	// Header tokens cannot be sent by a cross-site form
+	gofight.New().POST("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + accessToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+}
+
+func TestCSRFCookieTokenAsymmetricKey(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:            "test zone",
+		SigningAlgorithm: "RS256",
+		PrivKeyFile:      "testdata/jwtRS256.key",
+		PubKeyFile:       "testdata/jwtRS256.key.pub",
+		Timeout:          time.Hour,
+		Authenticator:    validAuthenticator,
+		SendCookie:       true,
+		TokenLookup:      "header:Authorization, cookie:jwt",
+		EnableCSRF:       true,
+	})
+	require.NoError(t, err)
+	handler := ginHandler(authMiddleware)
+	handler.POST("/auth/hello", authMiddleware.MiddlewareFunc(), helloHandler)
+
+	accessToken, csrfToken := csrfLogin(t, handler)
+	gofight.New().POST("/auth/hello").
+		SetCookie(gofight.H{"jwt": accessToken, DefaultCSRFCookieName: csrfToken}).
+		SetHeader(gofight.H{DefaultCSRFHeaderName: csrfToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+}
+
+func TestCSRFTokenBoundToAccessToken(t *testing.T) {
+	handler, authMiddleware := newCSRFHandler(t, nil)
+	accessToken, _ := csrfLogin(t, handler)
+	otherCSRFToken, err := authMiddleware.newCSRFToken(makeTokenString("HS256", testAdmin))
+	require.NoError(t, err)
+
+	// A CSRF token issued with another access token is rejected even if both copies match
+	gofight.New().POST("/auth/hello").
+		SetCookie(gofight.H{"jwt": accessToken, DefaultCSRFCookieName: otherCSRFToken}).
+		SetHeader(gofight.H{DefaultCSRFHeaderName: otherCSRFToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusForbidden, r.Code)
+		})
+}
+
+func TestCSRFExempt(t *testing.T) {
+	handler, _ := newCSRFHandler(t, func(c *gin.Context) bool {
+		return c.Request.URL.Path == "/webhook"
+	})
+	accessToken, _ := csrfLogin(t, handler)
+
+	gofight.New().POST("/webhook").
+		SetCookie(gofight.H{"jwt": accessToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	gofight.New().POST("/auth/hello").
+		SetCookie(gofight.H{"jwt": accessToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusForbidden, r.Code)
+		})
+}
+
+func TestCSRFLogoutDeletesCookie(t *testing.T) {
+	handler, _ := newCSRFHandler(t, nil)
+
+	gofight.New().POST("/logout").
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			cookie := findCookie(r, DefaultCSRFCookieName)
+			require.NotNil(t, cookie)
+			assert.Negative(t, cookie.MaxAge)
+		})
+}
@@ -0,0 +1,433 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/appleboy/gin-jwt/v3/store"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	dpopHeader           = "DPoP"
+	dpopScheme           = "DPoP"
+	dpopProofType        = "dpop+jwt"
+	dpopBindingKeyPrefix = "dpop_jkt:"
+	claimConfirmation    = "cnf"
+	claimJKT             = "jkt"
+	authSchemeContextKey = "JWT_AUTH_SCHEME"
+	minDPoPRSAKeyBits    = 2048
+)
+
+// defaultDPoPAlgorithms are the asymmetric algorithms accepted for DPoP proofs
+var defaultDPoPAlgorithms = []string{
+	"ES256", "ES384", "ES512",
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"EdDSA",
+}
+
+type dpopContextKey struct{}
+
+// WithDPoPThumbprint returns a context that makes TokenGenerator bind the token pair
+// to the JWK SHA-256 thumbprint jkt (RFC 7638) of the client's DPoP key.
+func WithDPoPThumbprint(ctx context.Context, jkt string) context.Context {
+	return context.WithValue(ctx, dpopContextKey{}, jkt)
+}
+
+// dpopThumbprint returns the key thumbprint set by WithDPoPThumbprint.
+func dpopThumbprint(ctx context.Context) string {
+	jkt, _ := ctx.Value(dpopContextKey{}).(string)
+	return jkt
+}
+
+// dpopBindingKey returns the store key holding the thumbprint a refresh token is bound to.
+func dpopBindingKey(refreshToken string) string {
+	return dpopBindingKeyPrefix + refreshToken
+}
+
+// initializeDPoP sets the DPoP defaults and the replay store, preferring Redis
+// when the refresh tokens are stored in Redis.
+func (mw *GinJWTMiddleware) initializeDPoP() {
+	if !mw.EnableDPoP {
+		return
+	}
+
+	if len(mw.DPoPAlgorithms) == 0 {
+		mw.DPoPAlgorithms = defaultDPoPAlgorithms
+	}
+	if mw.DPoPProofMaxAge == 0 {
+		mw.DPoPProofMaxAge = time.Minute
+	}
+	if mw.DPoPURLFunc == nil {
+		mw.DPoPURLFunc = defaultDPoPURL
+	}
+	if mw.DPoPReplayStore != nil {
+		return
+	}
+
+	if _, ok := mw.RefreshTokenStore.(*store.RedisRefreshTokenStore); ok {
+		redisConfig := mw.RedisConfig
+		if redisConfig == nil {
+			redisConfig = store.DefaultRedisConfig()
+		}
+
+		replayStore, err := store.NewRedisReplayStore(redisConfig)
+		if err == nil {
+			mw.DPoPReplayStore = replayStore
+			return
+		}
+
+		mw.logger().Warn("failed to create Redis replay store, falling back to in-memory store",
+			logKeyStore, string(store.RedisStore),
+			logKeyErrorKind, errorKindRedis,
+			logKeyError, err,
+		)
+	}
+
+	mw.DPoPReplayStore = store.NewInMemoryReplayStore()
+}
+
+// defaultDPoPURL rebuilds the request URL without query and fragment, as expected in htu.
+func defaultDPoPURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	} else if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme, _, _ = strings.Cut(proto, ",")
+		scheme = strings.TrimSpace(scheme)
+	}
+
+	return scheme + "://" + c.Request.Host + c.Request.URL.Path
+}
+
+// sameDPoPURL compares two URLs ignoring query, fragment, case and default ports
+// (RFC 9449 section 4.3).
+func sameDPoPURL(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	normalizeHost := func(u *url.URL) string {
+		host := strings.ToLower(u.Host)
+		scheme := strings.ToLower(u.Scheme)
+		if (scheme == "https" && strings.HasSuffix(host, ":443")) ||
+			(scheme == "http" && strings.HasSuffix(host, ":80")) {
+			host = host[:strings.LastIndex(host, ":")]
+		}
+		return host
+	}
+	normalizePath := func(u *url.URL) string {
+		if u.EscapedPath() == "" {
+			return "/"
+		}
+		return u.EscapedPath()
+	}
+
+	return strings.EqualFold(ua.Scheme, ub.Scheme) &&
+		normalizeHost(ua) == normalizeHost(ub) &&
+		normalizePath(ua) == normalizePath(ub)
+}
+
+// dpopAccessTokenHash returns the ath value of an access token.
+func dpopAccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// validateDPoPProof validates the DPoP header of the request and returns the JWK thumbprint
+// of the proof key. accessToken is empty at the token endpoints, otherwise ath must match it.
+func (mw *GinJWTMiddleware) validateDPoPProof(c *gin.Context, accessToken string) (string, error) {
+	values := c.Request.Header.Values(dpopHeader)
+	if len(values) == 0 {
+		return "", ErrMissingDPoPProof
+	}
+	if len(values) > 1 {
+		return "", fmt.Errorf("%w: more than one DPoP header", ErrInvalidDPoPProof)
+	}
+
+	var jkt string
+	token, err := jwt.Parse(values[0], func(t *jwt.Token) (any, error) {
+		if typ, _ := t.Header["typ"].(string); !strings.EqualFold(typ, dpopProofType) {
+			return nil, errors.New("typ must be dpop+jwt")
+		}
+		jwk, ok := t.Header["jwk"].(map[string]any)
+		if !ok {
+			return nil, errors.New("missing jwk header")
+		}
+
+		key, thumbprint, err := parseDPoPJWK(jwk)
+		if err != nil {
+			return nil, err
+		}
+		jkt = thumbprint
+		return key, nil
+	}, jwt.WithValidMethods(mw.DPoPAlgorithms), jwt.WithTimeFunc(mw.TimeFunc))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidDPoPProof, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", fmt.Errorf("%w: invalid claims", ErrInvalidDPoPProof)
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", fmt.Errorf("%w: missing jti", ErrInvalidDPoPProof)
+	}
+	if htm, _ := claims["htm"].(string); htm != c.Request.Method {
+		return "", fmt.Errorf("%w: htm does not match the request method", ErrInvalidDPoPProof)
+	}
+	if htu, _ := claims["htu"].(string); !sameDPoPURL(htu, mw.DPoPURLFunc(c)) {
+		return "", fmt.Errorf("%w: htu does not match the request URL", ErrInvalidDPoPProof)
+	}
+
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return "", fmt.Errorf("%w: missing iat", ErrInvalidDPoPProof)
+	}
+	now := mw.TimeFunc()
+	if iat.Before(now.Add(-mw.DPoPProofMaxAge)) || iat.After(now.Add(mw.DPoPProofMaxAge)) {
+		return "", fmt.Errorf("%w: iat is outside the accepted window", ErrInvalidDPoPProof)
+	}
+
+	if accessToken != "" {
+		if ath, _ := claims["ath"].(string); ath != dpopAccessTokenHash(accessToken) {
+			return "", fmt.Errorf("%w: ath does not match the access token", ErrInvalidDPoPProof)
+		}
+	}
+
+	// Checked last so that an invalid proof does not burn its jti
+	replayKey := sha256.Sum256([]byte(jkt + "." + jti))
+	fresh, err := mw.DPoPReplayStore.Use(
+		c.Request.Context(),
+		"dpop:"+base64.RawURLEncoding.EncodeToString(replayKey[:]),
+		iat.Add(mw.DPoPProofMaxAge),
+	)
+	if err != nil {
+		return "", err
+	}
+	if !fresh {
+		return "", ErrDPoPProofReplayed
+	}
+
+	return jkt, nil
+}
+
+// parseDPoPJWK parses the public JWK of a DPoP proof and computes its
+// RFC 7638 SHA-256 thumbprint.
+func parseDPoPJWK(jwk map[string]any) (any, string, error) {
+	member := func(name string) string {
+		v, _ := jwk[name].(string)
+		return v
+	}
+	decode := func(name string) ([]byte, error) {
+		b, err := base64.RawURLEncoding.DecodeString(member(name))
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid jwk member %q", name)
+		}
+		return b, nil
+	}
+
+	if _, ok := jwk["d"]; ok {
+		return nil, "", errors.New("jwk must not contain a private key")
+	}
+
+	var key any
+	var canonical string
+
+	switch member("kty") {
+	case "EC":
+		var curve elliptic.Curve
+		switch member("crv") {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, "", errors.New("unsupported jwk curve")
+		}
+
+		x, err := decode("x")
+		if err != nil {
+			return nil, "", err
+		}
+		y, err := decode("y")
+		if err != nil {
+			return nil, "", err
+		}
+
+		point := append([]byte{4}, append(x, y...)...)
+		pub, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid jwk EC key: %w", err)
+		}
+
+		key = pub
+		canonical = `{"crv":"` + member("crv") + `","kty":"EC","x":"` + member("x") +
+			`","y":"` + member("y") + `"}`
+	case "RSA":
+		n, err := decode("n")
+		if err != nil {
+			return nil, "", err
+		}
+		e, err := decode("e")
+		if err != nil {
+			return nil, "", err
+		}
+
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, "", errors.New("invalid jwk RSA exponent")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		if pub.N.BitLen() < minDPoPRSAKeyBits {
+			return nil, "", errors.New("jwk RSA key is too small")
+		}
+
+		key = pub
+		canonical = `{"e":"` + member("e") + `","kty":"RSA","n":"` + member("n") + `"}`
+	case "OKP":
+		if member("crv") != "Ed25519" {
+			return nil, "", errors.New("unsupported jwk curve")
+		}
+
+		x, err := decode("x")
+		if err != nil {
+			return nil, "", err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, "", errors.New("invalid jwk Ed25519 key")
+		}
+
+		key = ed25519.PublicKey(x)
+		canonical = `{"crv":"Ed25519","kty":"OKP","x":"` + member("x") + `"}`
+	default:
+		return nil, "", errors.New("unsupported jwk key type")
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return key, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// confirmationThumbprint returns the cnf.jkt claim of a DPoP-bound token.
+func confirmationThumbprint(claims jwt.MapClaims) string {
+	cnf, _ := claims[claimConfirmation].(map[string]any)
+	jkt, _ := cnf[claimJKT].(string)
+	return jkt
+}
+
+// checkDPoP enforces the DPoP binding of an access token presented to the middleware.
+func (mw *GinJWTMiddleware) checkDPoP(
+	c *gin.Context,
+	accessToken string,
+	claims jwt.MapClaims,
+) error {
+	scheme := c.GetString(authSchemeContextKey)
+	jkt := confirmationThumbprint(claims)
+
+	if jkt == "" {
+		if scheme == dpopScheme {
+			return ErrDPoPSchemeMismatch
+		}
+		if mw.DPoPRequired {
+			return ErrDPoPRequired
+		}
+		return nil
+	}
+
+	// A bound token sent as a bearer token is a downgrade attempt (RFC 9449 section 7.2)
+	if scheme != "" && scheme != dpopScheme {
+		return ErrDPoPSchemeMismatch
+	}
+	// The proof must be checked against the access token (ath), never skipped
+	if accessToken == "" {
+		return fmt.Errorf("%w: ath cannot be checked", ErrInvalidDPoPProof)
+	}
+
+	proofJKT, err := mw.validateDPoPProof(c, accessToken)
+	if err != nil {
+		return err
+	}
+	if proofJKT != jkt {
+		return ErrDPoPKeyMismatch
+	}
+
+	return nil
+}
+
+// dpopTokenContext validates the proof sent to a token endpoint and returns a context
+// binding the new tokens to its key. boundJKT is the binding of the presented refresh token.
+func (mw *GinJWTMiddleware) dpopTokenContext(
+	c *gin.Context,
+	boundJKT string,
+) (context.Context, error) {
+	ctx := c.Request.Context()
+
+	if len(c.Request.Header.Values(dpopHeader)) == 0 {
+		if boundJKT != "" || mw.DPoPRequired {
+			return nil, ErrMissingDPoPProof
+		}
+		return ctx, nil
+	}
+
+	jkt, err := mw.validateDPoPProof(c, "")
+	if err != nil {
+		return nil, err
+	}
+	if boundJKT != "" && jkt != boundJKT {
+		return nil, ErrDPoPKeyMismatch
+	}
+
+	return WithDPoPThumbprint(ctx, jkt), nil
+}
+
+// deleteDPoPBinding removes the DPoP key binding of a refresh token, if any.
+func (mw *GinJWTMiddleware) deleteDPoPBinding(ctx context.Context, refreshToken string) error {
+	if !mw.EnableDPoP {
+		return nil
+	}
+	err := mw.storeDelete(ctx, dpopBindingKey(refreshToken))
+	if errors.Is(err, core.ErrRefreshTokenNotFound) {
+		return nil
+	}
+	return err
+}
+
+// refreshTokenBinding returns the thumbprint a refresh token is bound to, if any.
+func (mw *GinJWTMiddleware) refreshTokenBinding(
+	ctx context.Context,
+	refreshToken string,
+) (string, error) {
+	data, err := mw.storeRecord(ctx, core.KindDPoPBinding, dpopBindingKey(refreshToken))
+	if errors.Is(err, core.ErrRefreshTokenNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	jkt, _ := data.(string)
+	return jkt, nil
+}
@@ -0,0 +1,397 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+const dpopTestHost = "http://example.com"
+
+// dpopClient signs DPoP proofs with its own P-256 key
+type dpopClient struct {
+	key *ecdsa.PrivateKey
+	jwk map[string]any
+	jkt string
+}
+
+func newDPoPClient(t *testing.T) *dpopClient {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+
+	jwk := map[string]any{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(x),
+		"y":   base64.RawURLEncoding.EncodeToString(y),
+	}
+	_, jkt, err := parseDPoPJWK(jwk)
+	require.NoError(t, err)
+
+	return &dpopClient{key: key, jwk: jwk, jkt: jkt}
+}
+
+// proof returns a DPoP proof for the request, bound to accessToken when not empty.
+func (d *dpopClient) proof(t *testing.T, method, path, accessToken string) string {
+	t.Helper()
+
+	claims := jwt.MapClaims{
+		"jti": rand.Text(),
+		"htm": method,
+		"htu": dpopTestHost + path,
+		"iat": time.Now().Unix(),
+	}
+	if accessToken != "" {
+		claims["ath"] = dpopAccessTokenHash(accessToken)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = dpopProofType
+	token.Header["jwk"] = d.jwk
+
+	proof, err := token.SignedString(d.key)
+	require.NoError(t, err)
+	return proof
+}
+
+func newDPoPMiddleware(t *testing.T, required bool) *GinJWTMiddleware {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: validAuthenticator,
+		EnableDPoP:    true,
+		DPoPRequired:  required,
+	})
+	require.NoError(t, err)
+	return authMiddleware
+}
+
+// dpopLogin logs in with a proof of client and returns the response body.
+func dpopLogin(t *testing.T, handler http.Handler, client *dpopClient) string {
+	t.Helper()
+
+	proof := client.proof(t, http.MethodPost, "/login", "")
+	r := testLoginAt(t, handler, dpopTestHost+"/login", testAdmin, gofight.H{"DPoP": proof})
+	return r.Body.String()
+}
+
+func TestDPoPLoginBindsTokens(t *testing.T) {
+	authMiddleware := newDPoPMiddleware(t, false)
+	client := newDPoPClient(t)
+
+	body := dpopLogin(t, ginHandler(authMiddleware), client)
+	assert.Equal(t, dpopScheme, gjson.Get(body, "token_type").String())
+
+	token, err := authMiddleware.ParseTokenString(gjson.Get(body, "access_token").String())
+	require.NoError(t, err)
+	assert.Equal(t, client.jkt, confirmationThumbprint(ExtractClaimsFromToken(token)))
+
+	jkt, err := authMiddleware.refreshTokenBinding(
+		t.Context(), gjson.Get(body, "refresh_token").String())
+	require.NoError(t, err)
+	assert.Equal(t, client.jkt, jkt)
+}
+
+func TestDPoPLoginWithoutProofIssuesBearerTokens(t *testing.T) {
+	handler := ginHandler(newDPoPMiddleware(t, false))
+
+	r := testLoginAt(t, handler, dpopTestHost+"/login", testAdmin, nil)
+	assert.Equal(t, "Bearer", gjson.Get(r.Body.String(), "token_type").String())
+}
+
+func TestDPoPRequiredLogin(t *testing.T) {
+	handler := ginHandler(newDPoPMiddleware(t, true))
+
+	gofight.New().POST(dpopTestHost+"/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": testPassword}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+			assert.Equal(t, ErrMissingDPoPProof.Error(),
+				gjson.Get(r.Body.String(), "message").String())
+		})
+
+	gofight.New().GET(dpopTestHost+"/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + makeTokenString("HS256", testAdmin)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ErrDPoPRequired.Error(),
+				gjson.Get(r.Body.String(), "message").String())
+		})
+}
+
+func TestDPoPProtectedRoute(t *testing.T) {
+	authMiddleware := newDPoPMiddleware(t, false)
+	handler := ginHandler(authMiddleware)
+	client := newDPoPClient(t)
+	accessToken := gjson.Get(dpopLogin(t, handler, client), "access_token").String()
+
+	proof := client.proof(t, http.MethodGet, "/auth/hello", accessToken)
+	gofight.New().GET(dpopTestHost+"/auth/hello").
+		SetHeader(gofight.H{"Authorization": "DPoP " + accessToken, "DPoP": proof}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	// The same proof cannot be used twice
+	gofight.New().GET(dpopTestHost+"/auth/hello").
+		SetHeader(gofight.H{"Authorization": "DPoP " + accessToken, "DPoP": proof}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ErrDPoPProofReplayed.Error(),
+				gjson.Get(r.Body.String(), "message").String())
+			//nolint:staticcheck
+			challenge := r.HeaderMap.Get("WWW-Authenticate")
+			assert.Contains(t, challenge, `DPoP realm="test zone", algs="ES256`)
+			assert.Contains(t, challenge, `error="invalid_dpop_proof"`)
+		})
+}
+
+func TestDPoPProtectedRouteAsymmetricKey(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:            "test zone",
+		SigningAlgorithm: "RS256",
+		PrivKeyFile:      "testdata/jwtRS256.key",
+		PubKeyFile:       "testdata/jwtRS256.key.pub",
+		Timeout:          time.Hour,
+		Authenticator:    validAuthenticator,
+		EnableDPoP:       true,
+	})
+	require.NoError(t, err)
+	handler := ginHandler(authMiddleware)
+	client := newDPoPClient(t)
+	accessToken := gjson.Get(dpopLogin(t, handler, client), "access_token").String()
+
+	// The ath of the proof is checked against the access token
+	proof := client.proof(t, http.MethodGet, "/auth/hello", makeTokenString("RS256", testAdmin))
+	gofight.New().GET(dpopTestHost+"/auth/hello").
+		SetHeader(gofight.H{"Authorization": "DPoP " + accessToken, "DPoP": proof}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Contains(t, gjson.Get(r.Body.String(), "message").String(),
+				"ath does not match the access token")
+		})
+
+	proof = client.proof(t, http.MethodGet, "/auth/hello", accessToken)
+	gofight.New().GET(dpopTestHost+"/auth/hello").
+		SetHeader(gofight.H{"Authorization": "DPoP " + accessToken, "DPoP": proof}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+}
+
+func TestDPoPProtectedRouteRejections(t *testing.T) {
+	authMiddleware := newDPoPMiddleware(t, false)
+	handler := ginHandler(authMiddleware)
+	client := newDPoPClient(t)
+	accessToken := gjson.Get(dpopLogin(t, handler, client), "access_token").String()
+
+	testCases := []struct {
+		name    string
+		headers gofight.H
+		message string
+	}{
+		{
+			name:    "missing proof",
+			headers: gofight.H{"Authorization": "DPoP " + accessToken},
+			message: ErrMissingDPoPProof.Error(),
+		},
+		{
+			name: "bearer downgrade",
+			headers: gofight.H{
+				"Authorization": "Bearer " + accessToken,
+				"DPoP":          client.proof(t, http.MethodGet, "/auth/hello", accessToken),
+			},
+			message: ErrDPoPSchemeMismatch.Error(),
+		},
+		{
+			name: "ath mismatch",
+			headers: gofight.H{
+				"Authorization": "DPoP " + accessToken,
+				"DPoP":          client.proof(t, http.MethodGet, "/auth/hello", "other"),
+			},
+			message: "ath does not match the access token",
+		},
+		{
+			name: "htm mismatch",
+			headers: gofight.H{
+				"Authorization": "DPoP " + accessToken,
+				"DPoP":          client.proof(t, http.MethodPost, "/auth/hello", accessToken),
+			},
+			message: "htm does not match the request method",
+		},
+		{
+			name: "htu mismatch",
+			headers: gofight.H{
+				"Authorization": "DPoP " + accessToken,
+				"DPoP":          client.proof(t, http.MethodGet, "/login", accessToken),
+			},
+			message: "htu does not match the request URL",
+		},
+		{
+			name: "other key",
+			headers: gofight.H{
+				"Authorization": "DPoP " + accessToken,
+				"DPoP": newDPoPClient(t).
+					proof(t, http.MethodGet, "/auth/hello", accessToken),
+			},
+			message: ErrDPoPKeyMismatch.Error(),
+		},
+		{
+			name: "unbound token with DPoP scheme",
+			headers: gofight.H{
+				"Authorization": "DPoP " + makeTokenString("HS256", testAdmin),
+				"DPoP":          client.proof(t, http.MethodGet, "/auth/hello", ""),
+			},
+			message: ErrDPoPSchemeMismatch.Error(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gofight.New().GET(dpopTestHost+"/auth/hello").
+				SetHeader(tc.headers).
+				Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+					assert.Equal(t, http.StatusUnauthorized, r.Code)
+					assert.Contains(t, gjson.Get(r.Body.String(), "message").String(), tc.message)
+				})
+		})
+	}
+}
+
+func TestDPoPProofExpired(t *testing.T) {
+	authMiddleware := newDPoPMiddleware(t, false)
+	handler := ginHandler(authMiddleware)
+	client := newDPoPClient(t)
+
+	authMiddleware.TimeFunc = func() time.Time { return time.Now().Add(2 * time.Minute) }
+
+	gofight.New().POST(dpopTestHost+"/login").
+		SetHeader(gofight.H{"DPoP": client.proof(t, http.MethodPost, "/login", "")}).
+		SetJSON(gofight.D{"username": testAdmin, "password": testPassword}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+			assert.Contains(t, gjson.Get(r.Body.String(), "message").String(), "iat")
+		})
+}
+
+func TestDPoPRefresh(t *testing.T) {
+	authMiddleware := newDPoPMiddleware(t, false)
+	handler := ginHandler(authMiddleware)
+	client := newDPoPClient(t)
+	refreshToken := gjson.Get(dpopLogin(t, handler, client), "refresh_token").String()
+
+	// A bound refresh token needs a proof from the same key
+	gofight.New().POST(dpopTestHost+"/refresh").
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+			assert.Equal(t, ErrMissingDPoPProof.Error(),
+				gjson.Get(r.Body.String(), "message").String())
+		})
+
+	gofight.New().POST(dpopTestHost+"/refresh").
+		SetHeader(gofight.H{
+			"DPoP": newDPoPClient(t).proof(t, http.MethodPost, "/refresh", ""),
+		}).
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+			assert.Equal(t, ErrDPoPKeyMismatch.Error(),
+				gjson.Get(r.Body.String(), "message").String())
+		})
+
+	var newRefreshToken string
+	gofight.New().POST(dpopTestHost+"/refresh").
+		SetHeader(gofight.H{"DPoP": client.proof(t, http.MethodPost, "/refresh", "")}).
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Equal(t, dpopScheme, gjson.Get(r.Body.String(), "token_type").String())
+			newRefreshToken = gjson.Get(r.Body.String(), "refresh_token").String()
+		})
+
+	// The binding follows the rotated refresh token
+	jkt, err := authMiddleware.refreshTokenBinding(t.Context(), newRefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, client.jkt, jkt)
+
+	jkt, err = authMiddleware.refreshTokenBinding(t.Context(), refreshToken)
+	require.NoError(t, err)
+	assert.Empty(t, jkt)
+}
+
+func TestDPoPRefreshRejectsBinding(t *testing.T) {
+	handler := ginHandler(newDPoPMiddleware(t, false))
+	client := newDPoPClient(t)
+	refreshToken := gjson.Get(dpopLogin(t, handler, client), "refresh_token").String()
+
+	// The key binding is not a refresh token, even with a valid proof
+	gofight.New().POST(dpopTestHost+"/refresh").
+		SetHeader(gofight.H{"DPoP": client.proof(t, http.MethodPost, "/refresh", "")}).
+		SetJSON(gofight.D{"refresh_token": dpopBindingKey(refreshToken)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ErrInvalidRefreshToken.Error(),
+				gjson.Get(r.Body.String(), "message").String())
+		})
+}
+
+func TestSameDPoPURL(t *testing.T) {
+	assert.True(t, sameDPoPURL("https://Example.com:443/a", "https://example.com/a"))
+	assert.True(t, sameDPoPURL("https://example.com/a?x=1#f", "https://example.com/a"))
+	assert.True(t, sameDPoPURL("http://example.com", "http://example.com/"))
+	assert.False(t, sameDPoPURL("http://example.com/a", "https://example.com/a"))
+	assert.False(t, sameDPoPURL("https://example.com/a", "https://example.com/b"))
+	assert.False(t, sameDPoPURL("https://example.com:8443/a", "https://example.com/a"))
+}
+
+func TestParseDPoPJWK(t *testing.T) {
+	// RFC 7638 section 3.1 example
+	_, jkt, err := parseDPoPJWK(map[string]any{
+		"kty": "RSA",
+		"n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxu" +
+			"hDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6C" +
+			"f0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n9" +
+			"1CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44" +
+			"-csFCur-kEgU8awapJzKnqDKgw",
+		"e":   "AQAB",
+		"alg": "RS256",
+		"kid": "2011-04-29",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jkt)
+
+	_, _, err = parseDPoPJWK(map[string]any{"kty": "EC", "crv": "P-256", "x": "AA", "y": "AA"})
+	assert.Error(t, err)
+
+	_, _, err = parseDPoPJWK(map[string]any{"kty": "oct", "k": "c2VjcmV0"})
+	assert.Error(t, err)
+
+	client := newDPoPClient(t)
+	private := map[string]any{"d": "secret"}
+	for k, v := range client.jwk {
+		private[k] = v
+	}
+	_, _, err = parseDPoPJWK(private)
+	assert.Error(t, err)
+}
@@ -0,0 +1,63 @@
+package jwt
+
+import "github.com/gin-gonic/gin"
+
+// Phase is the step of the authentication flow in which an error happened
+type Phase string
+
+const (
+	// PhaseParse covers extracting and validating the token in the middleware
+	PhaseParse Phase = "parse"
+	// PhaseAuthorize covers the Authorizer check in the middleware
+	PhaseAuthorize Phase = "authorize"
+	// PhaseLogin covers LoginHandler and MFAHandler
+	PhaseLogin Phase = "login"
+	// PhaseRefresh covers RefreshHandler
+	PhaseRefresh Phase = "refresh"
+	// PhaseSessions covers the session handlers, such as ListSessionsHandler
+	PhaseSessions Phase = "sessions"
+)
+
+// AuthError is the error passed to ErrorHandler.
+// It wraps the error returned by the middleware, so errors.Is and errors.As
+// work on it as well as on the underlying cause.
+type AuthError struct {
+	// Kind is a stable, machine-readable cause with the same values as Event.Reason
+	Kind string
+
+	// Phase is the step of the flow that failed
+	Phase Phase
+
+	// Status is the HTTP status code the middleware would have replied with
+	Status int
+
+	// Err is the underlying error, e.g. ErrExpiredToken or the Authenticator error
+	Err error
+}
+
+// Error returns the message of the underlying error.
+func (e *AuthError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// newAuthError classifies err raised during phase.
+func newAuthError(phase Phase, status int, err error) *AuthError {
+	return &AuthError{
+		Kind:   errorReason(err),
+		Phase:  phase,
+		Status: status,
+		Err:    err,
+	}
+}
+
+// ExtractAuthError returns the error of a request refused by the middleware or the handlers,
+// e.g. from a custom Unauthorized func. It returns nil when no error happened.
+func ExtractAuthError(c *gin.Context) *AuthError {
+	authErr, _ := c.Value(errorContextKey).(*AuthError)
+	return authErr
+}
@@ -0,0 +1,178 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestAuthErrorUnwrap(t *testing.T) {
+	authErr := newAuthError(PhaseParse, http.StatusUnauthorized, ErrExpiredToken)
+	assert.Equal(t, ReasonExpired, authErr.Kind)
+	assert.Equal(t, ErrExpiredToken.Error(), authErr.Error())
+	assert.ErrorIs(t, authErr, ErrExpiredToken)
+
+	wrapped := fmt.Errorf("request failed: %w", authErr)
+	var target *AuthError
+	require.ErrorAs(t, wrapped, &target)
+	assert.Equal(t, PhaseParse, target.Phase)
+	assert.Equal(t, http.StatusUnauthorized, target.Status)
+}
+
+func TestErrorHandler(t *testing.T) {
+	var received []*AuthError
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: defaultAuthenticator,
+		Authorizer: func(c *gin.Context, data any) bool {
+			return data == testAdmin
+		},
+		ErrorHandler: func(c *gin.Context, err *AuthError) {
+			received = append(received, err)
+
+			status := err.Status
+			if err.Kind == ReasonInvalidClaims {
+				status = http.StatusUnauthorized
+			}
+			c.JSON(status, gin.H{
+				"error": err.Kind,
+				"phase": err.Phase,
+			})
+		},
+	})
+	require.NoError(t, err)
+
+	handler := ginHandler(authMiddleware)
+
+	noExp := jwt.New(jwt.SigningMethodHS256)
+	noExp.Claims.(jwt.MapClaims)["identity"] = testAdmin
+	noExpToken, err := noExp.SignedString(key)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		request func() *gofight.RequestConfig
+		status  int
+		kind    string
+		phase   Phase
+		cause   error
+	}{
+		{
+			name: "missing exp",
+			request: func() *gofight.RequestConfig {
+				return gofight.New().GET("/auth/hello").
+					SetHeader(gofight.H{"Authorization": "Bearer " + noExpToken})
+			},
+			status: http.StatusUnauthorized,
+			kind:   ReasonInvalidClaims,
+			phase:  PhaseParse,
+			cause:  ErrMissingExpField,
+		},
+		{
+			name: "expired",
+			request: func() *gofight.RequestConfig {
+				expired := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+					"identity": testAdmin,
+					"exp":      time.Now().Add(-time.Hour).Unix(),
+				})
+				tokenString, _ := expired.SignedString(key)
+				return gofight.New().GET("/auth/hello").
+					SetHeader(gofight.H{"Authorization": "Bearer " + tokenString})
+			},
+			status: http.StatusUnauthorized,
+			kind:   ReasonExpired,
+			phase:  PhaseParse,
+			cause:  ErrExpiredToken,
+		},
+		{
+			name: "forbidden",
+			request: func() *gofight.RequestConfig {
+				return gofight.New().GET("/auth/hello").
+					SetHeader(gofight.H{"Authorization": "Bearer " + makeTokenString("HS256", testUser)})
+			},
+			status: http.StatusForbidden,
+			kind:   ReasonForbidden,
+			phase:  PhaseAuthorize,
+			cause:  ErrForbidden,
+		},
+		{
+			name: "login",
+			request: func() *gofight.RequestConfig {
+				return gofight.New().POST("/login").
+					SetJSON(gofight.D{"username": testAdmin, "password": "wrong"})
+			},
+			status: http.StatusUnauthorized,
+			kind:   ReasonInvalidCredentials,
+			phase:  PhaseLogin,
+			cause:  ErrFailedAuthentication,
+		},
+		{
+			name: "refresh",
+			request: func() *gofight.RequestConfig {
+				return gofight.New().POST("/refresh")
+			},
+			status: http.StatusBadRequest,
+			kind:   ReasonMissingToken,
+			phase:  PhaseRefresh,
+			cause:  ErrMissingRefreshToken,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			received = nil
+			tc.request().Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+				assert.Equal(t, tc.status, r.Code)
+				assert.Equal(t, tc.kind, gjson.Get(r.Body.String(), "error").String())
+				assert.Equal(t, string(tc.phase), gjson.Get(r.Body.String(), "phase").String())
+				assert.NotEmpty(t, r.HeaderMap.Get("WWW-Authenticate")) //nolint:staticcheck
+			})
+
+			require.Len(t, received, 1)
+			assert.Equal(t, tc.phase, received[0].Phase)
+			assert.ErrorIs(t, received[0], tc.cause)
+		})
+	}
+}
+
+func TestExtractAuthError(t *testing.T) {
+	errCustom := errors.New("account disabled")
+	var extracted *AuthError
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(c *gin.Context) (any, error) {
+			return nil, errCustom
+		},
+		Unauthorized: func(c *gin.Context, code int, message string) {
+			extracted = ExtractAuthError(c)
+			c.String(code, message)
+		},
+	})
+	require.NoError(t, err)
+
+	gofight.New().POST("/login").
+		Run(ginHandler(authMiddleware), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, errCustom.Error(), r.Body.String())
+			//nolint:staticcheck
+			assert.Equal(t, `Bearer realm="test zone"`, r.HeaderMap.Get("WWW-Authenticate"))
+		})
+
+	require.NotNil(t, extracted)
+	assert.Equal(t, PhaseLogin, extracted.Phase)
+	assert.Equal(t, ReasonInvalid, extracted.Kind)
+	assert.ErrorIs(t, extracted, errCustom)
+
+	assert.Nil(t, ExtractAuthError(&gin.Context{}))
+}
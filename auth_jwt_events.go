@@ -0,0 +1,301 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EventType identifies an authentication lifecycle event
+type EventType string
+
+const (
+	// EventLoginSuccess is emitted when Authenticator accepts the credentials
+	EventLoginSuccess EventType = "login_success"
+	// EventLoginFailure is emitted when a login is refused
+	EventLoginFailure EventType = "login_failure"
+	// EventLoginLockout is emitted when a username or client IP gets locked out,
+	// Identity holds the locked key
+	EventLoginLockout EventType = "login_lockout"
+	// EventLoginAttemptStoreError is emitted when LoginAttemptStore fails to read or record
+	// the attempts of a key, Identity holds the key
+	EventLoginAttemptStoreError EventType = "login_attempt_store_error"
+	// EventTokenIssued is emitted when a token pair is handed out by a handler
+	EventTokenIssued EventType = "token_issued"
+	// EventTokenRenewed is emitted when a sliding session renews an access token in the middleware
+	EventTokenRenewed EventType = "token_renewed"
+	// EventRefreshSuccess is emitted when a refresh token is exchanged for a new token pair
+	EventRefreshSuccess EventType = "refresh_success"
+	// EventRefreshFailure is emitted when RefreshHandler refuses a request
+	EventRefreshFailure EventType = "refresh_failure"
+	// EventRefreshTokenRevoked is emitted when a refresh token is revoked by rotation or logout
+	EventRefreshTokenRevoked EventType = "refresh_token_revoked"
+	// EventLogout is emitted by LogoutHandler
+	EventLogout EventType = "logout"
+	// EventTokenRejected is emitted when the middleware refuses an access token
+	EventTokenRejected EventType = "token_rejected"
+	// EventAuthorizationDenied is emitted when Authorizer refuses a valid token
+	EventAuthorizationDenied EventType = "authorization_denied"
+	// EventStoreFallback is emitted when Redis is unavailable and the in-memory store is used
+	EventStoreFallback EventType = "store_fallback"
+	// EventCookieOversized is emitted when SetCookie splits an access token across several cookies
+	EventCookieOversized EventType = "cookie_oversized"
+	// EventSessionEvicted is emitted when a login revokes the oldest session of its user to
+	// stay within MaxSessionsPerUser. SessionID identifies the evicted session.
+	EventSessionEvicted EventType = "session_evicted"
+	// EventSessionRevoked is emitted when a session handler revokes a session.
+	// SessionID identifies the revoked session.
+	EventSessionRevoked EventType = "session_revoked"
+	// EventTokensRevoked is emitted when an admin handler sets a revocation watermark.
+	// Identity is the admin, and Subject the user whose tokens are revoked, empty for all.
+	EventTokensRevoked EventType = "tokens_revoked"
+)
+
+// Reasons reported in Event.Reason when a token or a request is rejected.
+// They are also used as the code of problem+json responses.
+const (
+	ReasonMissingToken        = "missing_token"
+	ReasonInvalidHeader       = "invalid_header"
+	ReasonMalformed           = "malformed"
+	ReasonInvalidSignature    = "invalid_signature"
+	ReasonInvalidAlgorithm    = "invalid_algorithm"
+	ReasonExpired             = "expired"
+	ReasonNotValidYet         = "not_valid_yet"
+	ReasonInvalidClaims       = "invalid_claims"
+	ReasonMFAPending          = "mfa_pending"
+	ReasonForbidden           = "forbidden"
+	ReasonLocked              = "locked"
+	ReasonMissingCredentials  = "missing_credentials"
+	ReasonInvalidCredentials  = "invalid_credentials"
+	ReasonInvalidRefreshToken = "invalid_refresh_token"
+	ReasonInvalidMFAToken     = "invalid_mfa_token"
+	ReasonMissingMFAValues    = "missing_mfa_values"
+	ReasonInvalidMFACode      = "invalid_mfa_code"
+	ReasonServerError         = "server_error"
+	ReasonInvalidDPoPProof    = "invalid_dpop_proof"
+	ReasonDPoPRequired        = "dpop_required"
+	ReasonCertificateMismatch = "certificate_mismatch"
+	ReasonFingerprintMismatch = "fingerprint_mismatch"
+	ReasonInvalidCSRFToken    = "invalid_csrf_token"
+	ReasonCookieTooLarge      = "cookie_too_large"
+	ReasonRefreshTokenIdle    = "refresh_token_idle"
+	ReasonSessionExpired      = "session_expired"
+	ReasonSessionLimit        = "session_limit"
+	ReasonSessionNotFound     = "session_not_found"
+	ReasonMissingSubject      = "missing_subject"
+	ReasonRevoked             = "revoked"
+	ReasonInvalid             = "invalid"
+)
+
+// Event describes something the middleware did.
+// Request fields are empty for events that happen outside of a request, such as EventStoreFallback.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// Identity is the IdentityHandler value for token-bearing requests,
+	// and the Authenticator user data for login and refresh.
+	Identity any
+
+	ClientIP  string
+	UserAgent string
+	RequestID string
+
+	// SessionID identifies the session the event is about, such as the evicted one.
+	SessionID string
+
+	// Subject is the user an admin action is about, such as a revocation.
+	Subject string
+
+	// Reason is a stable, machine-readable cause for rejections and failures.
+	Reason string
+
+	// Err is the underlying error, if any. It never contains token material.
+	Err error
+}
+
+// EventHandler receives authentication lifecycle events.
+// It is called synchronously from the request, so implementations should return quickly.
+type EventHandler interface {
+	HandleEvent(ctx context.Context, event *Event)
+}
+
+// EventHandlerFunc is an adapter to allow the use of ordinary functions as EventHandler.
+type EventHandlerFunc func(ctx context.Context, event *Event)
+
+// HandleEvent calls f(ctx, event).
+func (f EventHandlerFunc) HandleEvent(ctx context.Context, event *Event) {
+	f(ctx, event)
+}
+
+// defaultRequestID reads the conventional X-Request-ID header.
+func defaultRequestID(c *gin.Context) string {
+	return c.GetHeader("X-Request-ID")
+}
+
+// emit sends an event about the current request to the EventHandler.
+func (mw *GinJWTMiddleware) emit(c *gin.Context, eventType EventType, identity any, err error) {
+	if mw.EventHandler == nil {
+		return
+	}
+
+	mw.EventHandler.HandleEvent(c.Request.Context(), mw.newEvent(c, eventType, identity, err))
+}
+
+// emitSession sends an event about a session of the user identified by identity.
+func (mw *GinJWTMiddleware) emitSession(
+	c *gin.Context,
+	eventType EventType,
+	identity any,
+	sessionID string,
+) {
+	if mw.EventHandler == nil {
+		return
+	}
+
+	event := mw.newEvent(c, eventType, identity, nil)
+	event.SessionID = sessionID
+	mw.EventHandler.HandleEvent(c.Request.Context(), event)
+}
+
+// emitRevocation emits EventTokensRevoked for the revocation watermark of subject set by
+// identity.
+func (mw *GinJWTMiddleware) emitRevocation(c *gin.Context, identity any, subject string) {
+	if mw.EventHandler == nil {
+		return
+	}
+
+	event := mw.newEvent(c, EventTokensRevoked, identity, nil)
+	event.Subject = subject
+	mw.EventHandler.HandleEvent(c.Request.Context(), event)
+}
+
+// newEvent builds an event carrying the request metadata of c.
+func (mw *GinJWTMiddleware) newEvent(c *gin.Context, eventType EventType, identity any, err error) *Event {
+	event := &Event{
+		Type:      eventType,
+		Time:      mw.TimeFunc(),
+		Identity:  identity,
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: mw.RequestIDFunc(c),
+		Err:       err,
+	}
+	if err != nil {
+		event.Reason = errorReason(err)
+	}
+
+	return event
+}
+
+// emitBackground sends an event that is not tied to a request.
+func (mw *GinJWTMiddleware) emitBackground(eventType EventType, err error) {
+	if mw.EventHandler == nil {
+		return
+	}
+
+	event := &Event{
+		Type: eventType,
+		Time: mw.TimeFunc(),
+		Err:  err,
+	}
+	if err != nil {
+		event.Reason = errorReason(err)
+	}
+
+	mw.EventHandler.HandleEvent(context.Background(), event)
+}
+
+// errorReason maps an error to a stable reason string.
+func errorReason(err error) string {
+	switch {
+	// Checked first, as an invalid proof wraps the jwt error that made it invalid
+	case errors.Is(err, ErrMissingDPoPProof),
+		errors.Is(err, ErrInvalidDPoPProof),
+		errors.Is(err, ErrDPoPProofReplayed),
+		errors.Is(err, ErrDPoPKeyMismatch):
+		return ReasonInvalidDPoPProof
+	case errors.Is(err, ErrDPoPSchemeMismatch), errors.Is(err, ErrDPoPRequired):
+		return ReasonDPoPRequired
+	case errors.Is(err, ErrCertificateMismatch):
+		return ReasonCertificateMismatch
+	case errors.Is(err, ErrFingerprintMismatch):
+		return ReasonFingerprintMismatch
+	case errors.Is(err, ErrInvalidCSRFToken):
+		return ReasonInvalidCSRFToken
+	case errors.Is(err, ErrCookieTooLarge):
+		return ReasonCookieTooLarge
+	case errors.Is(err, ErrEmptyAuthHeader),
+		errors.Is(err, ErrEmptyQueryToken),
+		errors.Is(err, ErrEmptyCookieToken),
+		errors.Is(err, ErrEmptyParamToken),
+		errors.Is(err, ErrMissingRefreshToken):
+		return ReasonMissingToken
+	case errors.Is(err, ErrInvalidAuthHeader):
+		return ReasonInvalidHeader
+	case errors.Is(err, jwt.ErrTokenExpired), errors.Is(err, ErrExpiredToken):
+		return ReasonExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ReasonNotValidYet
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return ReasonInvalidSignature
+	case errors.Is(err, ErrInvalidSigningAlgorithm):
+		return ReasonInvalidAlgorithm
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ReasonMalformed
+	case errors.Is(err, ErrMissingExpField),
+		errors.Is(err, ErrWrongFormatOfExp),
+		errors.Is(err, jwt.ErrTokenInvalidClaims),
+		errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		return ReasonInvalidClaims
+	case errors.Is(err, ErrMFAPendingToken):
+		return ReasonMFAPending
+	case errors.Is(err, ErrForbidden):
+		return ReasonForbidden
+	case errors.Is(err, ErrLoginLocked):
+		return ReasonLocked
+	case errors.Is(err, ErrMissingLoginValues):
+		return ReasonMissingCredentials
+	case errors.Is(err, ErrFailedAuthentication):
+		return ReasonInvalidCredentials
+	case errors.Is(err, ErrMissingMFAValues):
+		return ReasonMissingMFAValues
+	case errors.Is(err, ErrInvalidMFACode):
+		return ReasonInvalidMFACode
+	case errors.Is(err, ErrSessionLimitReached):
+		return ReasonSessionLimit
+	case errors.Is(err, ErrSessionNotFound):
+		return ReasonSessionNotFound
+	case errors.Is(err, ErrMissingSubject):
+		return ReasonMissingSubject
+	case errors.Is(err, ErrTokenRevoked):
+		return ReasonRevoked
+	case errors.Is(err, ErrMissingSessionID):
+		return ReasonInvalidClaims
+	case errors.Is(err, ErrRefreshTokenIdle):
+		return ReasonRefreshTokenIdle
+	case errors.Is(err, ErrRefreshSessionExpired):
+		return ReasonSessionExpired
+	case errors.Is(err, ErrInvalidRefreshToken),
+		errors.Is(err, ErrRefreshTokenNotFound),
+		errors.Is(err, core.ErrRefreshTokenNotFound):
+		return ReasonInvalidRefreshToken
+	case errors.Is(err, ErrInvalidMFAToken):
+		return ReasonInvalidMFAToken
+	case errors.Is(err, ErrFailedTokenCreation),
+		errors.Is(err, ErrMissingAuthenticatorFunc),
+		errors.Is(err, ErrMissingMFAVerifier),
+		errors.Is(err, ErrLoginAttemptStore),
+		errors.Is(err, ErrSessionsNotSupported),
+		errors.Is(err, ErrFailedSessionOperation),
+		errors.Is(err, ErrRevocationCheckFailed),
+		errors.Is(err, ErrRevocationWatermarkNotSupported):
+		return ReasonServerError
+	default:
+		return ReasonInvalid
+	}
+}
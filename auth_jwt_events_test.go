@@ -0,0 +1,200 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/store"
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+func (r *eventRecorder) HandleEvent(ctx context.Context, event *Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) types() []EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	types := make([]EventType, 0, len(r.events))
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func (r *eventRecorder) last() *Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events[len(r.events)-1]
+}
+
+func (r *eventRecorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+func newEventMiddleware(t *testing.T, recorder *eventRecorder) *GinJWTMiddleware {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: validAuthenticator,
+		Authorizer: func(c *gin.Context, data any) bool {
+			return data == testAdmin
+		},
+		EventHandler: recorder,
+	})
+	require.NoError(t, err)
+
+	return authMiddleware
+}
+
+func TestEventsLoginRefreshLogout(t *testing.T) {
+	recorder := &eventRecorder{}
+	handler := ginHandler(newEventMiddleware(t, recorder))
+	r := gofight.New()
+
+	r.POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": "wrong"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+	assert.Equal(t, []EventType{EventLoginFailure}, recorder.types())
+	assert.Equal(t, ErrFailedAuthentication, recorder.last().Err)
+	recorder.reset()
+
+	var refreshToken string
+	r.POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": testPassword}).
+		SetHeader(gofight.H{
+			"User-Agent":   "event-test",
+			"X-Request-ID": "req-1",
+		}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			refreshToken = gjson.Get(r.Body.String(), "refresh_token").String()
+		})
+	assert.Equal(t, []EventType{EventLoginSuccess, EventTokenIssued}, recorder.types())
+	event := recorder.last()
+	assert.Equal(t, testAdmin, event.Identity)
+	assert.Equal(t, "event-test", event.UserAgent)
+	assert.Equal(t, "req-1", event.RequestID)
+	assert.Empty(t, event.Reason)
+	recorder.reset()
+
+	r.POST("/refresh").
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			refreshToken = gjson.Get(r.Body.String(), "refresh_token").String()
+		})
+	assert.Equal(
+		t,
+		[]EventType{EventRefreshTokenRevoked, EventTokenIssued, EventRefreshSuccess},
+		recorder.types(),
+	)
+	recorder.reset()
+
+	r.POST("/refresh").
+		SetJSON(gofight.D{"refresh_token": "unknown"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+	assert.Equal(t, []EventType{EventRefreshFailure}, recorder.types())
+	recorder.reset()
+
+	r.POST("/logout").
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		SetHeader(gofight.H{"Authorization": "Bearer " + makeTokenString("HS256", testAdmin)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+	assert.Equal(t, []EventType{EventRefreshTokenRevoked, EventLogout}, recorder.types())
+	assert.Equal(t, testAdmin, recorder.last().Identity)
+}
+
+func TestEventsTokenRejectedAndDenied(t *testing.T) {
+	recorder := &eventRecorder{}
+	handler := ginHandler(newEventMiddleware(t, recorder))
+	r := gofight.New()
+
+	r.GET("/auth/hello").
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+	assert.Equal(t, []EventType{EventTokenRejected}, recorder.types())
+	assert.Equal(t, ReasonMissingToken, recorder.last().Reason)
+	recorder.reset()
+
+	r.GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer not.a.token"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+	assert.Equal(t, ReasonMalformed, recorder.last().Reason)
+	recorder.reset()
+
+	r.GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + makeTokenString("HS384", testAdmin)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+	assert.Equal(t, ReasonInvalidAlgorithm, recorder.last().Reason)
+	recorder.reset()
+
+	r.GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + makeTokenString("HS256", testUser)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusForbidden, r.Code)
+		})
+	assert.Equal(t, []EventType{EventAuthorizationDenied}, recorder.types())
+	assert.Equal(t, testUser, recorder.last().Identity)
+	assert.Equal(t, ReasonForbidden, recorder.last().Reason)
+	recorder.reset()
+
+	r.GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + makeTokenString("HS256", testAdmin)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+	assert.Empty(t, recorder.types())
+}
+
+func TestEventsStoreFallback(t *testing.T) {
+	var events []*Event
+	middleware := &GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		UseRedisStore: true,
+		RedisConfig: &store.RedisConfig{
+			Addr: "invalid-host:6379",
+		},
+		EventHandler: EventHandlerFunc(func(ctx context.Context, event *Event) {
+			events = append(events, event)
+		}),
+	}
+
+	require.NoError(t, middleware.MiddlewareInit())
+	require.Len(t, events, 1)
+	assert.Equal(t, EventStoreFallback, events[0].Type)
+	assert.Error(t, events[0].Err)
+	assert.Empty(t, events[0].ClientIP)
+}
@@ -0,0 +1,138 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newFingerprintMiddleware(t *testing.T) *GinJWTMiddleware {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:             "test zone",
+		Key:               key,
+		Timeout:           time.Hour,
+		Authenticator:     validAuthenticator,
+		EnableFingerprint: true,
+	})
+	require.NoError(t, err)
+	return authMiddleware
+}
+
+// findCookie returns the cookie named name set by the response, or nil.
+func findCookie(r gofight.HTTPResponse, name string) *http.Cookie {
+	for _, cookie := range (*httptest.ResponseRecorder)(r).Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestFingerprintLogin(t *testing.T) {
+	authMiddleware := newFingerprintMiddleware(t)
+	handler := ginHandler(authMiddleware)
+
+	r := testLogin(t, handler, testAdmin, nil)
+	accessToken := gjson.Get(r.Body.String(), "access_token").String()
+	refreshToken := gjson.Get(r.Body.String(), "refresh_token").String()
+
+	cookie := findCookie(r, DefaultFingerprintCookieName)
+	require.NotNil(t, cookie)
+	assert.True(t, cookie.Secure)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+	assert.Equal(t, "/", cookie.Path)
+	assert.Empty(t, cookie.Domain)
+	fingerprint := cookie.Value
+
+	token, err := authMiddleware.ParseTokenString(accessToken)
+	require.NoError(t, err)
+	assert.Equal(t, fingerprintHash(fingerprint), ExtractClaimsFromToken(token)[claimFingerprint])
+
+	gofight.New().GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + accessToken}).
+		SetCookie(gofight.H{DefaultFingerprintCookieName: fingerprint}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	// A new fingerprint is issued on refresh
+	gofight.New().POST("/refresh").
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			require.Equal(t, http.StatusOK, r.Code)
+			cookie := findCookie(r, DefaultFingerprintCookieName)
+			require.NotNil(t, cookie)
+			assert.NotEqual(t, fingerprint, cookie.Value)
+		})
+}
+
+func TestFingerprintMismatch(t *testing.T) {
+	authMiddleware := newFingerprintMiddleware(t)
+	handler := ginHandler(authMiddleware)
+
+	accessToken, _ := loginTokens(t, handler, testAdmin, nil)
+
+	// A stolen token without the cookie
+	gofight.New().GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + accessToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ErrFingerprintMismatch.Error(),
+				gjson.Get(r.Body.String(), "message").String())
+		})
+
+	gofight.New().GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + accessToken}).
+		SetCookie(gofight.H{DefaultFingerprintCookieName: "forged"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+
+	// Tokens without fgp claim are not affected
+	gofight.New().GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + makeTokenString("HS256", testAdmin)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+}
+
+func TestFingerprintLogout(t *testing.T) {
+	handler := ginHandler(newFingerprintMiddleware(t))
+
+	gofight.New().POST("/logout").
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			cookie := findCookie(r, DefaultFingerprintCookieName)
+			require.NotNil(t, cookie)
+			assert.Empty(t, cookie.Value)
+			assert.Negative(t, cookie.MaxAge)
+		})
+}
+
+func TestFingerprintCookieName(t *testing.T) {
+	_, err := New(&GinJWTMiddleware{
+		Key:                   key,
+		Authenticator:         validAuthenticator,
+		EnableFingerprint:     true,
+		FingerprintCookieName: "fgp",
+	})
+	assert.ErrorIs(t, err, ErrInvalidFingerprintCookieName)
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Key:                   key,
+		Authenticator:         validAuthenticator,
+		EnableFingerprint:     true,
+		FingerprintCookieName: "__Host-session-fgp",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "__Host-session-fgp", authMiddleware.FingerprintCookieName)
+}
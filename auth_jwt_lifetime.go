@@ -0,0 +1,172 @@
+package jwt
+
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+)
+
+// claimSessionID is the access token claim identifying the session of the token pair
+const claimSessionID = "sid"
+
+type (
+	replacedTokenContextKey struct{}
+	sessionIDContextKey     struct{}
+)
+
+// withReplacedToken returns ctx carrying the data of the refresh token being exchanged,
+// so that its successor belongs to the same session.
+func withReplacedToken(ctx context.Context, data *core.RefreshTokenData) context.Context {
+	return context.WithValue(ctx, replacedTokenContextKey{}, data)
+}
+
+// replacedTokenFromContext returns the data set by withReplacedToken, or nil.
+func replacedTokenFromContext(ctx context.Context) *core.RefreshTokenData {
+	data, _ := ctx.Value(replacedTokenContextKey{}).(*core.RefreshTokenData)
+	return data
+}
+
+// withSessionID returns ctx carrying the ID of the session of the token pair to issue: the
+// session of the refresh token being exchanged, or a new one.
+func withSessionID(ctx context.Context) context.Context {
+	sessionID := rand.Text()
+	if replaced := replacedTokenFromContext(ctx); replaced != nil && replaced.SessionID != "" {
+		sessionID = replaced.SessionID
+	}
+	return context.WithValue(ctx, sessionIDContextKey{}, sessionID)
+}
+
+// sessionIDFromContext returns the session ID set by withSessionID, or "".
+func sessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionIDContextKey{}).(string)
+	return sessionID
+}
+
+// dataStore returns RefreshTokenStore as a core.DataStore, when it implements it.
+func (mw *GinJWTMiddleware) dataStore() (core.DataStore, bool) {
+	store, ok := mw.RefreshTokenStore.(core.DataStore)
+	return store, ok
+}
+
+// initializeRefreshLifetime checks that RefreshTokenStore can carry the session start
+// that the refresh token limits need.
+func (mw *GinJWTMiddleware) initializeRefreshLifetime() error {
+	if mw.RefreshTokenIdleTimeout <= 0 && mw.RefreshTokenMaxLifetime <= 0 {
+		return nil
+	}
+	if _, ok := mw.dataStore(); !ok {
+		return ErrRefreshLifetimeNotSupported
+	}
+	return nil
+}
+
+// checkRefreshLifetime enforces RefreshTokenIdleTimeout, counted from the issuance of the
+// refresh token, i.e. the last refresh, and RefreshTokenMaxLifetime, counted from the login.
+func (mw *GinJWTMiddleware) checkRefreshLifetime(data *core.RefreshTokenData) error {
+	now := mw.TimeFunc()
+	if mw.RefreshTokenMaxLifetime > 0 && !data.SessionStart.IsZero() &&
+		now.After(data.SessionStart.Add(mw.RefreshTokenMaxLifetime)) {
+		return ErrRefreshSessionExpired
+	}
+	if mw.RefreshTokenIdleTimeout > 0 && !data.Created.IsZero() &&
+		now.After(data.Created.Add(mw.RefreshTokenIdleTimeout)) {
+		return ErrRefreshTokenIdle
+	}
+	return nil
+}
+
+// refreshTokenData returns the data stored with a refresh token. Stores that do not implement
+// core.DataStore only provide the user data.
+func (mw *GinJWTMiddleware) refreshTokenData(
+	ctx context.Context,
+	token string,
+) (*core.RefreshTokenData, error) {
+	store, ok := mw.dataStore()
+	if !ok {
+		userData, err := mw.storeGet(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		return &core.RefreshTokenData{UserData: userData}, nil
+	}
+	return mw.storeGetData(ctx, store, token)
+}
+
+// setStoreRecord stores value under key as an entry of kind, such as a pending MFA login,
+// that shares RefreshTokenStore with the refresh tokens but is refused by RefreshHandler.
+func (mw *GinJWTMiddleware) setStoreRecord(
+	ctx context.Context,
+	kind string,
+	key string,
+	value any,
+	expiry time.Time,
+) error {
+	store, ok := mw.dataStore()
+	if !ok {
+		return mw.storeSet(ctx, key, value, expiry)
+	}
+	return mw.storeSetData(ctx, store, key, &core.RefreshTokenData{
+		UserData: value,
+		Expiry:   expiry,
+		Kind:     kind,
+	})
+}
+
+// storeRecord returns the value stored by setStoreRecord under key, or
+// core.ErrRefreshTokenNotFound when key holds no entry of kind.
+func (mw *GinJWTMiddleware) storeRecord(ctx context.Context, kind, key string) (any, error) {
+	store, ok := mw.dataStore()
+	if !ok {
+		return mw.storeGet(ctx, key)
+	}
+	data, err := mw.storeGetData(ctx, store, key)
+	if err != nil {
+		return nil, err
+	}
+	if data.Kind != kind {
+		return nil, core.ErrRefreshTokenNotFound
+	}
+	return data.UserData, nil
+}
+
+// isStoreRecordKey reports whether token is the key of an entry stored by setStoreRecord.
+// Stores that do not implement core.DataStore lose the kind of the entries, but refresh
+// tokens never carry these prefixes.
+func isStoreRecordKey(token string) bool {
+	return strings.HasPrefix(token, mfaStoreKeyPrefix) ||
+		strings.HasPrefix(token, dpopBindingKeyPrefix) ||
+		strings.HasPrefix(token, revokedSessionKeyPrefix)
+}
+
+// refreshTokenRecord returns the data to store with a new refresh token. It belongs to the
+// session in ctx, and follows the refresh policy in ctx.
+func (mw *GinJWTMiddleware) refreshTokenRecord(
+	ctx context.Context,
+	userData any,
+) *core.RefreshTokenData {
+	now := mw.TimeFunc()
+	policy := mw.refreshPolicyFromContext(ctx)
+	record := &core.RefreshTokenData{
+		UserData:      userData,
+		Expiry:        mw.refreshTokenExpiry(now, policy.timeout),
+		Created:       now,
+		SessionStart:  now,
+		SessionID:     sessionIDFromContext(ctx),
+		Timeout:       policy.timeout,
+		SessionCookie: policy.sessionCookie,
+		Metadata:      sessionMetadataFromContext(ctx),
+	}
+
+	if mw.indexesSessions() {
+		record.Subject = mw.SubjectFunc(userData)
+	}
+
+	replaced := replacedTokenFromContext(ctx)
+	if replaced != nil && !replaced.SessionStart.IsZero() {
+		record.SessionStart = replaced.SessionStart
+	}
+	return record
+}
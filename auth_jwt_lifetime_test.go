@@ -0,0 +1,139 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/appleboy/gin-jwt/v3/store"
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newLifetimeHandler(
+	t *testing.T,
+	now *time.Time,
+	idleTimeout, maxLifetime time.Duration,
+) *gin.Engine {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:                   "test zone",
+		Key:                     key,
+		Timeout:                 time.Hour,
+		Authenticator:           validAuthenticator,
+		RefreshTokenIdleTimeout: idleTimeout,
+		RefreshTokenMaxLifetime: maxLifetime,
+		ProblemDetails:          true,
+		TimeFunc: func() time.Time {
+			return *now
+		},
+	})
+	require.NoError(t, err)
+	return ginHandler(authMiddleware)
+}
+
+// lifetimeRefresh calls RefreshHandler and returns the status, the new refresh token and
+// the error code of a failure.
+func lifetimeRefresh(handler *gin.Engine, refreshToken string) (int, string, string) {
+	var code int
+	var newRefreshToken, errorCode string
+	gofight.New().POST("/refresh").
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			code = r.Code
+			newRefreshToken = gjson.Get(r.Body.String(), "refresh_token").String()
+			errorCode = gjson.Get(r.Body.String(), "code").String()
+		})
+	return code, newRefreshToken, errorCode
+}
+
+func TestRefreshTokenIdleTimeout(t *testing.T) {
+	now := time.Now()
+	handler := newLifetimeHandler(t, &now, time.Hour, 0)
+	_, refreshToken := loginTokens(t, handler, testAdmin, nil)
+
+	// Every refresh restarts the idle timeout
+	for range 3 {
+		now = now.Add(50 * time.Minute)
+		code, newRefreshToken, _ := lifetimeRefresh(handler, refreshToken)
+		require.Equal(t, http.StatusOK, code)
+		refreshToken = newRefreshToken
+	}
+
+	now = now.Add(61 * time.Minute)
+	code, _, errorCode := lifetimeRefresh(handler, refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, ReasonRefreshTokenIdle, errorCode)
+}
+
+func TestRefreshTokenMaxLifetime(t *testing.T) {
+	now := time.Now()
+	handler := newLifetimeHandler(t, &now, time.Hour, 2*time.Hour)
+	_, refreshToken := loginTokens(t, handler, testAdmin, nil)
+
+	// The session lifetime is carried across rotations, however often the token is used
+	for range 4 {
+		now = now.Add(25 * time.Minute)
+		code, newRefreshToken, _ := lifetimeRefresh(handler, refreshToken)
+		require.Equal(t, http.StatusOK, code)
+		refreshToken = newRefreshToken
+	}
+
+	now = now.Add(25 * time.Minute)
+	code, _, errorCode := lifetimeRefresh(handler, refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, ReasonSessionExpired, errorCode)
+
+	// A new login starts a new session
+	_, refreshToken = loginTokens(t, handler, testAdmin, nil)
+	code, _, _ = lifetimeRefresh(handler, refreshToken)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestRefreshTokenSessionStart(t *testing.T) {
+	tokenStore := store.NewInMemoryRefreshTokenStore()
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:             "test zone",
+		Key:               key,
+		Timeout:           time.Hour,
+		RefreshTokenStore: tokenStore,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	tokenPair, err := authMiddleware.TokenGenerator(ctx, "admin")
+	require.NoError(t, err)
+	data, err := tokenStore.GetData(ctx, tokenPair.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, data.Created, data.SessionStart)
+
+	assert.NotEmpty(t, data.SessionID)
+
+	// A refresh token replacing another one stays in its session
+	replaced := &core.RefreshTokenData{
+		SessionStart: time.Now().Add(-time.Hour).Truncate(time.Second),
+		SessionID:    "session-id",
+	}
+	tokenPair, err = authMiddleware.TokenGenerator(withReplacedToken(ctx, replaced), "admin")
+	require.NoError(t, err)
+	data, err = tokenStore.GetData(ctx, tokenPair.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, replaced.SessionStart, data.SessionStart)
+	assert.Equal(t, "session-id", data.SessionID)
+}
+
+func TestRefreshLifetimeNotSupported(t *testing.T) {
+	_, err := New(&GinJWTMiddleware{
+		Realm:                   "test zone",
+		Key:                     key,
+		RefreshTokenStore:       plainTokenStore{store.NewInMemoryRefreshTokenStore()},
+		RefreshTokenMaxLifetime: time.Hour,
+	})
+	assert.ErrorIs(t, err, ErrRefreshLifetimeNotSupported)
+}
@@ -0,0 +1,262 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	loginAttemptUserPrefix = "user:"
+	loginAttemptIPPrefix   = "ip:"
+	keyUsername            = "username"
+	// maxLoginBodySize caps the JSON login body read by loginField
+	maxLoginBodySize = 1 << 20
+)
+
+// LoginAttemptUserKey returns the login attempt key tracking failures of username.
+// The username is trimmed and lowercased, so that its variants share one counter.
+func LoginAttemptUserKey(username string) string {
+	return loginAttemptUserPrefix + strings.ToLower(strings.TrimSpace(username))
+}
+
+// LoginAttemptIPKey returns the login attempt key tracking failures from a client IP.
+func LoginAttemptIPKey(ip string) string {
+	return loginAttemptIPPrefix + ip
+}
+
+// loginProtectionEnabled reports whether brute-force protection is configured.
+func (mw *GinJWTMiddleware) loginProtectionEnabled() bool {
+	return mw.MaxLoginAttempts > 0
+}
+
+// initializeLoginAttemptStore sets up the login attempt store, preferring Redis
+// when the refresh tokens are stored in Redis.
+func (mw *GinJWTMiddleware) initializeLoginAttemptStore() {
+	if !mw.loginProtectionEnabled() || mw.LoginAttemptStore != nil {
+		return
+	}
+
+	if _, ok := mw.RefreshTokenStore.(*store.RedisRefreshTokenStore); ok {
+		redisConfig := mw.RedisConfig
+		if redisConfig == nil {
+			redisConfig = store.DefaultRedisConfig()
+		}
+
+		attemptStore, err := store.NewRedisLoginAttemptStore(redisConfig)
+		if err == nil {
+			mw.LoginAttemptStore = attemptStore
+			return
+		}
+
+		mw.logger().Warn("failed to create Redis login attempt store, falling back to in-memory store",
+			logKeyStore, string(store.RedisStore),
+			logKeyErrorKind, errorKindRedis,
+			logKeyError, err,
+		)
+	}
+
+	mw.LoginAttemptStore = store.NewInMemoryLoginAttemptStore()
+}
+
+// defaultLoginAttemptKeys tracks failures by submitted username and by client IP.
+func (mw *GinJWTMiddleware) defaultLoginAttemptKeys(c *gin.Context) []string {
+	keys := []string{LoginAttemptIPKey(c.ClientIP())}
+	if username := strings.TrimSpace(loginUsername(c)); username != "" {
+		keys = append(keys, LoginAttemptUserKey(username))
+	}
+	return keys
+}
+
+// loginUsername reads the username field from a form or JSON login request.
+func loginUsername(c *gin.Context) string {
+	return loginField(c, keyUsername)
+}
+
+// loginField reads a field from a form or JSON login request without consuming the body,
+// so that Authenticator can still bind it. JSON values other than strings, e.g. true,
+// are returned as they appear in the body. JSON bodies over maxLoginBodySize are not read,
+// and fail to bind in Authenticator too.
+func loginField(c *gin.Context, name string) string {
+	contentType := c.ContentType()
+
+	if strings.Contains(contentType, "application/x-www-form-urlencoded") ||
+		strings.Contains(contentType, "multipart/form-data") {
+		return c.PostForm(name)
+	}
+
+	if !strings.Contains(contentType, "application/json") || c.Request.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxLoginBodySize+1))
+	rest := io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil {
+		c.Request.Body = rest
+		return ""
+	}
+	if len(body) > maxLoginBodySize {
+		c.Request.Body = http.MaxBytesReader(c.Writer, rest, maxLoginBodySize)
+		return ""
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var reqBody map[string]json.RawMessage
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		return ""
+	}
+
+	raw, ok := reqBody[name]
+	if !ok {
+		return ""
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return string(raw)
+	}
+	return value
+}
+
+// loginLockedUntil returns the latest lockout deadline among keys, or the zero time.
+// Keys LoginAttemptStore cannot read are skipped, unless LoginAttemptFailClosed is set:
+// the error is then returned and the login refused.
+func (mw *GinJWTMiddleware) loginLockedUntil(c *gin.Context, keys []string) (time.Time, error) {
+	now := mw.TimeFunc()
+	var until time.Time
+
+	for _, key := range keys {
+		attempt, err := mw.LoginAttemptStore.Get(c.Request.Context(), key)
+		if err != nil {
+			err = mw.loginAttemptStoreError(c, key, err)
+			if mw.LoginAttemptFailClosed {
+				return time.Time{}, err
+			}
+			continue
+		}
+		if attempt.IsLocked(now) && attempt.LockedUntil.After(until) {
+			until = attempt.LockedUntil
+		}
+	}
+
+	return until, nil
+}
+
+// loginAttemptStoreError logs a failed LoginAttemptStore call and emits an
+// EventLoginAttemptStoreError event for key. It returns err wrapped in ErrLoginAttemptStore.
+func (mw *GinJWTMiddleware) loginAttemptStoreError(c *gin.Context, key string, err error) error {
+	err = fmt.Errorf("%w: %w", ErrLoginAttemptStore, err)
+	mw.logger().Warn("login attempt store failed",
+		logKeyErrorKind, errorKindStore,
+		logKeyError, err,
+	)
+	mw.emit(c, EventLoginAttemptStoreError, key, err)
+	return err
+}
+
+// loginLockoutDuration returns the lockout applied after the given number of failures:
+// LoginLockoutDuration doubled for each failure beyond MaxLoginAttempts, capped by MaxLoginLockoutDuration.
+func (mw *GinJWTMiddleware) loginLockoutDuration(failures int) time.Duration {
+	if failures < mw.MaxLoginAttempts {
+		return 0
+	}
+
+	exponent := failures - mw.MaxLoginAttempts
+	factor := math.Pow(2, float64(exponent))
+	duration := time.Duration(float64(mw.LoginLockoutDuration) * factor)
+	if duration <= 0 || duration > mw.MaxLoginLockoutDuration || math.IsInf(factor, 0) {
+		duration = mw.MaxLoginLockoutDuration
+	}
+
+	return duration
+}
+
+// registerLoginFailure records a failed login for each key and locks out keys
+// that reached MaxLoginAttempts.
+func (mw *GinJWTMiddleware) registerLoginFailure(c *gin.Context, keys []string) {
+	ctx := c.Request.Context()
+
+	for _, key := range keys {
+		failures, err := mw.LoginAttemptStore.AddFailure(ctx, key, mw.LoginAttemptWindow)
+		if err != nil {
+			mw.loginAttemptStoreError(c, key, err)
+			continue
+		}
+
+		duration := mw.loginLockoutDuration(failures)
+		if duration == 0 {
+			continue
+		}
+
+		until := mw.TimeFunc().Add(duration)
+		if err := mw.LoginAttemptStore.Lock(ctx, key, until); err != nil {
+			mw.loginAttemptStoreError(c, key, err)
+			continue
+		}
+
+		if mw.LoginLockoutFunc != nil {
+			mw.LoginLockoutFunc(c, key, until)
+		}
+
+		// The locked key stands in for the identity, the login is not authenticated
+		mw.emit(c, EventLoginLockout, key, ErrLoginLocked)
+	}
+}
+
+// clearLoginFailures resets the counters of keys after a successful login.
+// Client IP counters are kept, otherwise an attacker could clear them by
+// logging into their own account between guesses.
+func (mw *GinJWTMiddleware) clearLoginFailures(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if strings.HasPrefix(key, loginAttemptIPPrefix) {
+			continue
+		}
+		_ = mw.LoginAttemptStore.Reset(ctx, key)
+	}
+}
+
+// ResetLoginAttempts clears the failure counters and lockouts of the given keys.
+func (mw *GinJWTMiddleware) ResetLoginAttempts(ctx context.Context, keys ...string) error {
+	if mw.LoginAttemptStore == nil {
+		return nil
+	}
+
+	for _, key := range keys {
+		if err := mw.LoginAttemptStore.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnlockUser manually lifts the lockout of username.
+func (mw *GinJWTMiddleware) UnlockUser(ctx context.Context, username string) error {
+	return mw.ResetLoginAttempts(ctx, LoginAttemptUserKey(username))
+}
+
+// UnlockIP manually lifts the lockout of a client IP.
+func (mw *GinJWTMiddleware) UnlockIP(ctx context.Context, ip string) error {
+	return mw.ResetLoginAttempts(ctx, LoginAttemptIPKey(ip))
+}
+
+// loginLocked responds with 429 and a Retry-After header when the login is locked out.
+func (mw *GinJWTMiddleware) loginLocked(c *gin.Context, until time.Time) {
+	retryAfter := int64(math.Ceil(until.Sub(mw.TimeFunc()).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	mw.unauthorized(c, PhaseLogin, http.StatusTooManyRequests, ErrLoginLocked)
+}
@@ -0,0 +1,283 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/appleboy/gin-jwt/v3/store"
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func loginAttempt(handler *gin.Engine, username, password string) gofight.HTTPResponse {
+	var resp gofight.HTTPResponse
+	gofight.New().POST("/login").
+		SetJSON(gofight.D{
+			"username": username,
+			"password": password,
+		}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			resp = r
+		})
+	return resp
+}
+
+func TestLoginLockout(t *testing.T) {
+	var lockedKeys []string
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:            "test zone",
+		Key:              key,
+		Authenticator:    validAuthenticator,
+		MaxLoginAttempts: 3,
+		LoginLockoutFunc: func(c *gin.Context, key string, until time.Time) {
+			lockedKeys = append(lockedKeys, key)
+		},
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &store.InMemoryLoginAttemptStore{}, authMiddleware.LoginAttemptStore)
+
+	handler := ginHandler(authMiddleware)
+
+	for range 3 {
+		r := loginAttempt(handler, testAdmin, "wrong")
+		assert.Equal(t, http.StatusUnauthorized, r.Code)
+	}
+	assert.ElementsMatch(t, []string{LoginAttemptUserKey(testAdmin), LoginAttemptIPKey("")}, lockedKeys)
+
+	// Even the right password is refused while locked out
+	r := loginAttempt(handler, testAdmin, testPassword)
+	assert.Equal(t, http.StatusTooManyRequests, r.Code)
+	assert.Equal(t, ErrLoginLocked.Error(), gjson.Get(r.Body.String(), "message").String())
+	//nolint:staticcheck
+	retryAfter, err := strconv.Atoi(r.HeaderMap.Get("Retry-After"))
+	require.NoError(t, err)
+	assert.InDelta(t, 60, retryAfter, 1)
+
+	// Manual unlock of both the user and the client IP
+	require.NoError(t, authMiddleware.UnlockUser(context.Background(), testAdmin))
+	require.NoError(t, authMiddleware.UnlockIP(context.Background(), ""))
+
+	r = loginAttempt(handler, testAdmin, testPassword)
+	assert.Equal(t, http.StatusOK, r.Code)
+}
+
+func TestLoginSuccessResetsUserFailures(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:            "test zone",
+		Key:              key,
+		Authenticator:    validAuthenticator,
+		MaxLoginAttempts: 3,
+		LoginAttemptKeys: func(c *gin.Context) []string {
+			return []string{LoginAttemptUserKey(loginUsername(c))}
+		},
+	})
+	require.NoError(t, err)
+
+	handler := ginHandler(authMiddleware)
+
+	for range 2 {
+		assert.Equal(t, http.StatusUnauthorized, loginAttempt(handler, testAdmin, "wrong").Code)
+	}
+	assert.Equal(t, http.StatusOK, loginAttempt(handler, testAdmin, testPassword).Code)
+
+	attempt, err := authMiddleware.LoginAttemptStore.Get(context.Background(), LoginAttemptUserKey(testAdmin))
+	require.NoError(t, err)
+	assert.Equal(t, 0, attempt.Failures)
+
+	for range 2 {
+		assert.Equal(t, http.StatusUnauthorized, loginAttempt(handler, testAdmin, "wrong").Code)
+	}
+	assert.Equal(t, http.StatusOK, loginAttempt(handler, testAdmin, testPassword).Code)
+}
+
+func TestLoginLockoutDuration(t *testing.T) {
+	mw := &GinJWTMiddleware{
+		MaxLoginAttempts:        3,
+		LoginLockoutDuration:    time.Minute,
+		MaxLoginLockoutDuration: 10 * time.Minute,
+	}
+
+	assert.Equal(t, time.Duration(0), mw.loginLockoutDuration(2))
+	assert.Equal(t, time.Minute, mw.loginLockoutDuration(3))
+	assert.Equal(t, 2*time.Minute, mw.loginLockoutDuration(4))
+	assert.Equal(t, 8*time.Minute, mw.loginLockoutDuration(6))
+	assert.Equal(t, 10*time.Minute, mw.loginLockoutDuration(7))
+	assert.Equal(t, 10*time.Minute, mw.loginLockoutDuration(1000))
+}
+
+func TestLoginUsernameKeepsBody(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:            "test zone",
+		Key:              key,
+		Authenticator:    validAuthenticator,
+		MaxLoginAttempts: 5,
+	})
+	require.NoError(t, err)
+
+	// The username is peeked from the body, Authenticator must still be able to bind it
+	gofight.New().POST("/login").
+		SetForm(gofight.H{
+			"username": testAdmin,
+			"password": testPassword,
+		}).
+		Run(ginHandler(authMiddleware), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	assert.Equal(t, http.StatusOK, loginAttempt(ginHandler(authMiddleware), testAdmin, testPassword).Code)
+}
+
+func TestLoginAttemptUserKeyNormalized(t *testing.T) {
+	assert.Equal(t, LoginAttemptUserKey("admin"), LoginAttemptUserKey(" Admin "))
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:            "test zone",
+		Key:              key,
+		Authenticator:    validAuthenticator,
+		MaxLoginAttempts: 2,
+		LoginAttemptKeys: func(c *gin.Context) []string {
+			return []string{LoginAttemptUserKey(loginUsername(c))}
+		},
+	})
+	require.NoError(t, err)
+	handler := ginHandler(authMiddleware)
+
+	// Variants of the username share one counter
+	assert.Equal(t, http.StatusUnauthorized, loginAttempt(handler, "ADMIN", "wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, loginAttempt(handler, " admin", "wrong").Code)
+	assert.Equal(t, http.StatusTooManyRequests, loginAttempt(handler, testAdmin, testPassword).Code)
+}
+
+func TestLoginFieldBodyLimit(t *testing.T) {
+	body := `{"username":"admin","password":"admin","padding":"` +
+		strings.Repeat("a", maxLoginBodySize) + `"}`
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	assert.Empty(t, loginUsername(c))
+
+	// Authenticator cannot bind the body either, so the username cannot dodge its counter
+	var loginVals Login
+	assert.Error(t, c.ShouldBindJSON(&loginVals))
+}
+
+func TestMFALoginLockout(t *testing.T) {
+	now := time.Now()
+	authMiddleware := newMFAMiddleware(t, func() time.Time { return now })
+	authMiddleware.MaxLoginAttempts = 3
+	authMiddleware.LoginAttemptKeys = func(c *gin.Context) []string {
+		return []string{LoginAttemptUserKey(loginUsername(c))}
+	}
+	require.NoError(t, authMiddleware.MiddlewareInit())
+	handler := mfaHandler(authMiddleware)
+	ctx := context.Background()
+	userKey := LoginAttemptUserKey(testAdmin)
+
+	mfaAttempt := func(mfaToken, code string) int {
+		var status int
+		gofight.New().POST("/login/mfa").
+			SetJSON(gofight.D{"mfa_token": mfaToken, "code": code}).
+			Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+				status = r.Code
+			})
+		return status
+	}
+
+	// The right password alone does not clear the counters
+	assert.Equal(t, http.StatusUnauthorized, loginAttempt(handler, testAdmin, "wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, mfaAttempt(loginForMFAToken(t, handler), "000000"))
+	attempt, err := authMiddleware.LoginAttemptStore.Get(ctx, userKey)
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempt.Failures, "a wrong code counts as a failed login")
+
+	// A verified second factor does
+	code := GenerateTOTP(totpTestSecret, now, 6, 30*time.Second, "")
+	assert.Equal(t, http.StatusOK, mfaAttempt(loginForMFAToken(t, handler), code))
+	attempt, err = authMiddleware.LoginAttemptStore.Get(ctx, userKey)
+	require.NoError(t, err)
+	assert.Zero(t, attempt.Failures)
+
+	// Pending logins are refused once wrong codes locked the user out
+	mfaTokens := make([]string, 4)
+	for i := range mfaTokens {
+		mfaTokens[i] = loginForMFAToken(t, handler)
+	}
+	for _, mfaToken := range mfaTokens[:3] {
+		assert.Equal(t, http.StatusUnauthorized, mfaAttempt(mfaToken, "000000"))
+	}
+	now = now.Add(30 * time.Second)
+	code = GenerateTOTP(totpTestSecret, now, 6, 30*time.Second, "")
+	assert.Equal(t, http.StatusTooManyRequests, mfaAttempt(mfaTokens[3], code))
+	assert.Equal(t, http.StatusTooManyRequests, loginAttempt(handler, testAdmin, testPassword).Code)
+}
+
+// failingAttemptStore is a LoginAttemptStore that is unavailable.
+type failingAttemptStore struct {
+	core.LoginAttemptStore
+}
+
+var errAttemptStoreDown = errors.New("login attempt store down")
+
+func (failingAttemptStore) Get(ctx context.Context, key string) (*core.LoginAttempt, error) {
+	return nil, errAttemptStoreDown
+}
+
+func (failingAttemptStore) AddFailure(
+	ctx context.Context,
+	key string,
+	window time.Duration,
+) (int, error) {
+	return 0, errAttemptStoreDown
+}
+
+func TestLoginAttemptStoreError(t *testing.T) {
+	var events []*Event
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:             "test zone",
+		Key:               key,
+		Authenticator:     validAuthenticator,
+		MaxLoginAttempts:  3,
+		LoginAttemptStore: failingAttemptStore{store.NewInMemoryLoginAttemptStore()},
+		EventHandler: EventHandlerFunc(func(ctx context.Context, event *Event) {
+			events = append(events, event)
+		}),
+	})
+	require.NoError(t, err)
+	handler := ginHandler(authMiddleware)
+
+	storeErrors := func() []*Event {
+		var found []*Event
+		for _, event := range events {
+			if event.Type == EventLoginAttemptStoreError {
+				assert.ErrorIs(t, event.Err, ErrLoginAttemptStore)
+				assert.ErrorIs(t, event.Err, errAttemptStoreDown)
+				found = append(found, event)
+			}
+		}
+		return found
+	}
+
+	// Failures that cannot be read or recorded are reported, and logins stay open
+	assert.Equal(t, http.StatusUnauthorized, loginAttempt(handler, testAdmin, "wrong").Code)
+	assert.Len(t, storeErrors(), 4, "one read and one write per key")
+	assert.Equal(t, http.StatusOK, loginAttempt(handler, testAdmin, testPassword).Code)
+
+	// Fail-closed refuses logins while the store is unavailable
+	authMiddleware.LoginAttemptFailClosed = true
+	events = nil
+	r := loginAttempt(handler, testAdmin, testPassword)
+	assert.Equal(t, http.StatusServiceUnavailable, r.Code)
+	assert.Equal(t, ErrLoginAttemptStore.Error(), gjson.Get(r.Body.String(), "message").String())
+	assert.Len(t, storeErrors(), 1)
+}
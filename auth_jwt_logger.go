@@ -0,0 +1,49 @@
+package jwt
+
+import (
+	"log/slog"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/appleboy/gin-jwt/v3/store"
+)
+
+// Attribute keys shared by every log record of the middleware.
+// Token values are never logged.
+const (
+	logKeyRealm     = "realm"
+	logKeyStore     = "store"
+	logKeyError     = "error"
+	logKeyErrorKind = "error_kind"
+	logKeyReason    = "reason"
+	logKeyFile      = "file"
+)
+
+// Values of the error_kind attribute
+const (
+	errorKindKeyFile = "key_file"
+	errorKindStore   = "store"
+	errorKindRedis   = "redis_connection"
+)
+
+// logger returns the configured logger annotated with the realm.
+func (mw *GinJWTMiddleware) logger() *slog.Logger {
+	logger := mw.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With(logKeyRealm, mw.Realm)
+}
+
+// storeType names the kind of refresh token store for log records.
+func storeType(s core.TokenStore) string {
+	switch s.(type) {
+	case *store.InMemoryRefreshTokenStore:
+		return string(store.MemoryStore)
+	case *store.RedisRefreshTokenStore:
+		return string(store.RedisStore)
+	case nil:
+		return "none"
+	default:
+		return "custom"
+	}
+}
@@ -0,0 +1,76 @@
+package jwt
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/appleboy/gin-jwt/v3/store"
+	"github.com/appleboy/gofight/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestLoggerRedisFallback(t *testing.T) {
+	var buf bytes.Buffer
+	middleware := &GinJWTMiddleware{
+		Realm:         "log zone",
+		Key:           key,
+		UseRedisStore: true,
+		RedisConfig: &store.RedisConfig{
+			Addr: "invalid-host:6379",
+		},
+		Logger: newTestLogger(&buf),
+	}
+
+	require.NoError(t, middleware.MiddlewareInit())
+	assert.Nil(t, middleware.RedisConfig.Logger, "caller's config must not be modified")
+
+	record := buf.String()
+	assert.Equal(t, "WARN", gjson.Get(record, "level").String())
+	assert.Equal(t, "log zone", gjson.Get(record, "realm").String())
+	assert.Equal(t, "redis", gjson.Get(record, "store").String())
+	assert.Equal(t, errorKindRedis, gjson.Get(record, "error_kind").String())
+}
+
+func TestLoggerKeyFile(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := New(&GinJWTMiddleware{
+		Realm:            "zone",
+		SigningAlgorithm: "RS256",
+		PrivKeyFile:      "nonexisting",
+		Logger:           newTestLogger(&buf),
+	})
+
+	assert.Equal(t, ErrNoPrivKeyFile, err)
+	assert.Equal(t, "ERROR", gjson.Get(buf.String(), "level").String())
+	assert.Equal(t, errorKindKeyFile, gjson.Get(buf.String(), "error_kind").String())
+	assert.Equal(t, "nonexisting", gjson.Get(buf.String(), "file").String())
+}
+
+func TestLoggerNeverLogsTokens(t *testing.T) {
+	var buf bytes.Buffer
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           []byte("another secret"),
+		Authenticator: validAuthenticator,
+		Logger:        newTestLogger(&buf),
+	})
+	require.NoError(t, err)
+
+	token := makeTokenString("HS256", testAdmin)
+	gofight.New().GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + token}).
+		Run(ginHandler(authMiddleware), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+
+	assert.Equal(t, ReasonInvalidSignature, gjson.Get(buf.String(), "reason").String())
+	assert.NotContains(t, buf.String(), token)
+}
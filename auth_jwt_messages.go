@@ -0,0 +1,224 @@
+package jwt
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MessageCatalog maps an error kind, as found in AuthError.Kind and Event.Reason,
+// to the message shown to the client
+type MessageCatalog map[string]string
+
+// Built-in locales
+const (
+	LocaleEnglish            = "en"
+	LocaleSimplifiedChinese  = "zh-CN"
+	LocaleTraditionalChinese = "zh-TW"
+)
+
+// defaultMessages are the built-in catalogs. Errors whose kind is missing,
+// such as custom Authenticator errors, keep their own message.
+var defaultMessages = map[string]MessageCatalog{
+	// The English messages are the ones of the errors, so that default responses do not
+	// depend on Accept-Language. Kinds covering several errors, or errors wrapped by
+	// jwt, keep the message of each error.
+	LocaleEnglish: {
+		ReasonInvalidHeader:       ErrInvalidAuthHeader.Error(),
+		ReasonMFAPending:          ErrMFAPendingToken.Error(),
+		ReasonForbidden:           ErrForbidden.Error(),
+		ReasonLocked:              ErrLoginLocked.Error(),
+		ReasonMissingCredentials:  ErrMissingLoginValues.Error(),
+		ReasonInvalidCredentials:  ErrFailedAuthentication.Error(),
+		ReasonRefreshTokenIdle:    ErrRefreshTokenIdle.Error(),
+		ReasonSessionExpired:      ErrRefreshSessionExpired.Error(),
+		ReasonSessionLimit:        ErrSessionLimitReached.Error(),
+		ReasonSessionNotFound:     ErrSessionNotFound.Error(),
+		ReasonRevoked:             ErrTokenRevoked.Error(),
+		ReasonInvalidMFAToken:     ErrInvalidMFAToken.Error(),
+		ReasonMissingMFAValues:    ErrMissingMFAValues.Error(),
+		ReasonInvalidMFACode:      ErrInvalidMFACode.Error(),
+		ReasonCertificateMismatch: ErrCertificateMismatch.Error(),
+		ReasonFingerprintMismatch: ErrFingerprintMismatch.Error(),
+		ReasonInvalidCSRFToken:    ErrInvalidCSRFToken.Error(),
+	},
+	LocaleSimplifiedChinese: {
+		ReasonMissingToken:        "缺少令牌",
+		ReasonInvalidHeader:       "认证头格式无效",
+		ReasonMalformed:           "令牌格式错误",
+		ReasonInvalidSignature:    "令牌签名无效",
+		ReasonInvalidAlgorithm:    "签名算法无效",
+		ReasonExpired:             "令牌已过期",
+		ReasonNotValidYet:         "令牌尚未生效",
+		ReasonInvalidClaims:       "令牌声明无效",
+		ReasonMFAPending:          "多因素认证尚未完成",
+		ReasonForbidden:           "您没有权限访问此资源",
+		ReasonLocked:              "登录失败次数过多，请稍后再试",
+		ReasonMissingCredentials:  "缺少用户名或密码",
+		ReasonInvalidCredentials:  "用户名或密码错误",
+		ReasonInvalidRefreshToken: "刷新令牌无效或已过期",
+		ReasonRefreshTokenIdle:    "刷新令牌因长时间未使用已过期",
+		ReasonSessionExpired:      "会话已过期，请重新登录",
+		ReasonSessionLimit:        "活动会话过多",
+		ReasonSessionNotFound:     "找不到会话",
+		ReasonRevoked:             "令牌已被撤销",
+		ReasonInvalidMFAToken:     "多因素认证令牌无效或已过期",
+		ReasonMissingMFAValues:    "缺少 mfa_token 或 code 参数",
+		ReasonInvalidMFACode:      "验证码错误",
+		ReasonServerError:         "服务器内部错误",
+		ReasonInvalidDPoPProof:    "DPoP 证明无效",
+		ReasonDPoPRequired:        "需要 DPoP 绑定的令牌",
+		ReasonCertificateMismatch: "客户端证书与令牌不匹配",
+		ReasonFingerprintMismatch: "令牌指纹不匹配",
+		ReasonInvalidCSRFToken:    "CSRF 令牌缺失或无效",
+	},
+	LocaleTraditionalChinese: {
+		ReasonMissingToken:        "缺少權杖",
+		ReasonInvalidHeader:       "驗證標頭格式無效",
+		ReasonMalformed:           "權杖格式錯誤",
+		ReasonInvalidSignature:    "權杖簽章無效",
+		ReasonInvalidAlgorithm:    "簽章演算法無效",
+		ReasonExpired:             "權杖已過期",
+		ReasonNotValidYet:         "權杖尚未生效",
+		ReasonInvalidClaims:       "權杖宣告無效",
+		ReasonMFAPending:          "多因素驗證尚未完成",
+		ReasonForbidden:           "您沒有權限存取此資源",
+		ReasonLocked:              "登入失敗次數過多，請稍後再試",
+		ReasonMissingCredentials:  "缺少使用者名稱或密碼",
+		ReasonInvalidCredentials:  "使用者名稱或密碼錯誤",
+		ReasonInvalidRefreshToken: "更新權杖無效或已過期",
+		ReasonRefreshTokenIdle:    "更新權杖因長時間未使用已過期",
+		ReasonSessionExpired:      "工作階段已過期，請重新登入",
+		ReasonSessionLimit:        "使用中的工作階段過多",
+		ReasonSessionNotFound:     "找不到工作階段",
+		ReasonRevoked:             "權杖已被撤銷",
+		ReasonInvalidMFAToken:     "多因素驗證權杖無效或已過期",
+		ReasonMissingMFAValues:    "缺少 mfa_token 或 code 參數",
+		ReasonInvalidMFACode:      "驗證碼錯誤",
+		ReasonServerError:         "伺服器內部錯誤",
+		ReasonInvalidDPoPProof:    "DPoP 證明無效",
+		ReasonDPoPRequired:        "需要 DPoP 綁定的權杖",
+		ReasonCertificateMismatch: "用戶端憑證與權杖不符",
+		ReasonFingerprintMismatch: "權杖指紋不符",
+		ReasonInvalidCSRFToken:    "CSRF 權杖遺失或無效",
+	},
+}
+
+// initializeMessages merges Messages over the built-in catalogs.
+func (mw *GinJWTMiddleware) initializeMessages() {
+	mw.messages = make(map[string]MessageCatalog, len(defaultMessages)+len(mw.Messages))
+	for locale, catalog := range defaultMessages {
+		mw.messages[locale] = catalog
+	}
+
+	for locale, catalog := range mw.Messages {
+		merged := make(MessageCatalog, len(mw.messages[locale])+len(catalog))
+		for kind, message := range mw.messages[locale] {
+			merged[kind] = message
+		}
+		for kind, message := range catalog {
+			merged[kind] = message
+		}
+		mw.messages[locale] = merged
+	}
+
+	mw.locales = make([]string, 0, len(mw.messages))
+	for locale := range mw.messages {
+		mw.locales = append(mw.locales, locale)
+	}
+	sort.Strings(mw.locales)
+}
+
+// ErrorMessage returns the message of err in the locale of the request.
+// It falls back to err.Error() when no locale matches or the catalog has no entry for the kind of err.
+// It is the default HTTPStatusMessageFunc, and can be called from a custom one or from ErrorHandler.
+func (mw *GinJWTMiddleware) ErrorMessage(c *gin.Context, err error) string {
+	locale := mw.matchLocale(mw.LocaleFunc(c))
+	kind := errorReason(err)
+	message, ok := mw.messages[locale][kind]
+	// A built-in English message would drop the details of a wrapped error
+	if ok && message != defaultMessages[LocaleEnglish][kind] {
+		return message
+	}
+	return err.Error()
+}
+
+// acceptLanguage is the default LocaleFunc. It returns the supported locale
+// with the highest quality in the Accept-Language header.
+func (mw *GinJWTMiddleware) acceptLanguage(c *gin.Context) string {
+	header := c.GetHeader("Accept-Language")
+	if header == "" {
+		return ""
+	}
+
+	type weightedTag struct {
+		tag     string
+		quality float64
+	}
+
+	var tags []weightedTag
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			v, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = v
+		}
+		if tag == "" || tag == "*" || quality <= 0 {
+			continue
+		}
+		tags = append(tags, weightedTag{tag: tag, quality: quality})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].quality > tags[j].quality
+	})
+
+	for _, t := range tags {
+		if locale := mw.matchLocale(t.tag); locale != "" {
+			return locale
+		}
+	}
+	return ""
+}
+
+// matchLocale maps a language tag to a catalog locale: exact match first,
+// then Chinese script and region, then the primary language.
+func (mw *GinJWTMiddleware) matchLocale(tag string) string {
+	if tag == "" {
+		return ""
+	}
+
+	for _, locale := range mw.locales {
+		if strings.EqualFold(locale, tag) {
+			return locale
+		}
+	}
+
+	subtags := strings.Split(strings.ToLower(strings.ReplaceAll(tag, "_", "-")), "-")
+	if subtags[0] == "zh" {
+		locale := LocaleSimplifiedChinese
+		for _, subtag := range subtags[1:] {
+			switch subtag {
+			case "hant", "tw", "hk", "mo":
+				locale = LocaleTraditionalChinese
+			}
+		}
+		if _, ok := mw.messages[locale]; ok {
+			return locale
+		}
+	}
+
+	for _, locale := range mw.locales {
+		primary, _, _ := strings.Cut(locale, "-")
+		if strings.EqualFold(primary, subtags[0]) {
+			return locale
+		}
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestAcceptLanguage(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Key:           key,
+		Authenticator: defaultAuthenticator,
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		header   string
+		expected string
+	}{
+		{"", ""},
+		{"*", ""},
+		{"fr", ""},
+		{"en", LocaleEnglish},
+		{"en-US,en;q=0.9", LocaleEnglish},
+		{"zh-CN", LocaleSimplifiedChinese},
+		{"zh", LocaleSimplifiedChinese},
+		{"zh-Hans-SG", LocaleSimplifiedChinese},
+		{"zh-TW,zh;q=0.9", LocaleTraditionalChinese},
+		{"zh-tw", LocaleTraditionalChinese},
+		{"zh-Hant", LocaleTraditionalChinese},
+		{"zh-HK", LocaleTraditionalChinese},
+		{"fr-FR, zh-CN;q=0.5", LocaleSimplifiedChinese},
+		{"en;q=0.2, zh-TW;q=0.8", LocaleTraditionalChinese},
+		{"zh-CN;q=0, en", LocaleEnglish},
+		{"zh-CN;q=bad, en;q=0.1", LocaleEnglish},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.header, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(nil)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+			c.Request.Header.Set("Accept-Language", tc.header)
+			assert.Equal(t, tc.expected, authMiddleware.acceptLanguage(c))
+		})
+	}
+}
+
+func TestLocalizedErrorMessages(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: defaultAuthenticator,
+		Messages: map[string]MessageCatalog{
+			LocaleTraditionalChinese: {ReasonExpired: "登入已逾時"},
+			"ja":                     {ReasonExpired: "トークンの有効期限が切れています"},
+		},
+	})
+	require.NoError(t, err)
+
+	handler := ginHandler(authMiddleware)
+	expired := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"identity": testAdmin,
+		"exp":      time.Now().Add(-time.Hour).Unix(),
+	})
+	expiredToken, err := expired.SignedString(key)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		language string
+		expected string
+	}{
+		{"", ErrExpiredToken.Error()},
+		{"de", ErrExpiredToken.Error()},
+		{"en-GB", "token is expired"},
+		{"zh-CN", "令牌已过期"},
+		{"zh-TW", "登入已逾時"},
+		{"ja-JP", "トークンの有効期限が切れています"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.language, func(t *testing.T) {
+			gofight.New().GET("/auth/hello").
+				SetHeader(gofight.H{
+					"Authorization":   "Bearer " + expiredToken,
+					"Accept-Language": tc.language,
+				}).
+				Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+					assert.Equal(t, http.StatusUnauthorized, r.Code)
+					assert.Equal(t, tc.expected, gjson.Get(r.Body.String(), "message").String())
+				})
+		})
+	}
+
+	// zh-TW entries that are not overridden keep the built-in message
+	gofight.New().GET("/auth/hello").
+		SetHeader(gofight.H{"Accept-Language": "zh-TW"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, "缺少權杖", gjson.Get(r.Body.String(), "message").String())
+		})
+
+	// The built-in catalogs are left untouched
+	assert.Equal(t, "權杖已過期", defaultMessages[LocaleTraditionalChinese][ReasonExpired])
+}
+
+func TestEnglishMessagesMatchErrors(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: defaultAuthenticator,
+	})
+	require.NoError(t, err)
+
+	c, _ := gin.CreateTestContext(nil)
+	c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+	c.Request.Header.Set("Accept-Language", "en-US")
+
+	// English responses are the messages of the errors, as without Accept-Language
+	for _, err := range []error{
+		ErrEmptyAuthHeader,
+		ErrEmptyCookieToken,
+		ErrInvalidAuthHeader,
+		ErrExpiredToken,
+		fmt.Errorf("%w: %w", jwt.ErrTokenSignatureInvalid, jwt.ErrSignatureInvalid),
+		ErrForbidden,
+		ErrFailedAuthentication,
+		fmt.Errorf("%w: account disabled", ErrFailedAuthentication),
+		ErrInvalidRefreshToken,
+		ErrFailedTokenCreation,
+		ErrRevocationCheckFailed,
+		fmt.Errorf("%w: htm does not match the request method", ErrInvalidDPoPProof),
+		ErrInvalidCSRFToken,
+	} {
+		assert.Equal(t, err.Error(), authMiddleware.ErrorMessage(c, err))
+	}
+
+	gofight.New().GET("/auth/hello").
+		SetHeader(gofight.H{"Accept-Language": "en-US"}).
+		Run(ginHandler(authMiddleware), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, ErrEmptyAuthHeader.Error(),
+				gjson.Get(r.Body.String(), "message").String())
+		})
+}
+
+func TestLocaleFunc(t *testing.T) {
+	errDisabled := errors.New("account disabled")
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+		Authenticator: func(c *gin.Context) (any, error) {
+			if c.Query("disabled") != "" {
+				return nil, errDisabled
+			}
+			return nil, ErrFailedAuthentication
+		},
+		LocaleFunc: func(c *gin.Context) string {
+			return c.Query("lang")
+		},
+		ProblemDetails: true,
+	})
+	require.NoError(t, err)
+
+	handler := ginHandler(authMiddleware)
+
+	gofight.New().POST("/login?lang=zh_Hant").
+		SetHeader(gofight.H{"Accept-Language": "en"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, "使用者名稱或密碼錯誤", gjson.Get(r.Body.String(), "detail").String())
+			assert.Equal(t, ReasonInvalidCredentials, gjson.Get(r.Body.String(), "code").String())
+		})
+
+	// Errors without a catalog entry keep their own message
+	gofight.New().POST("/login?lang=zh-CN&disabled=1").
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, errDisabled.Error(), gjson.Get(r.Body.String(), "detail").String())
+		})
+}
@@ -0,0 +1,92 @@
+package jwt
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultDeviceNameHeader is the default request header carrying the client's device name
+const DefaultDeviceNameHeader = "X-Device-Name"
+
+// maxMetadataValueSize caps the user agent and device name stored with a refresh token,
+// as clients choose them freely
+const maxMetadataValueSize = 128
+
+type sessionMetadataContextKey struct{}
+
+// withSessionMetadata returns ctx carrying the metadata to store with the refresh token to issue.
+func withSessionMetadata(ctx context.Context, metadata *core.SessionMetadata) context.Context {
+	if metadata == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, sessionMetadataContextKey{}, metadata)
+}
+
+// sessionMetadataFromContext returns the metadata set by withSessionMetadata, or nil.
+func sessionMetadataFromContext(ctx context.Context) *core.SessionMetadata {
+	metadata, _ := ctx.Value(sessionMetadataContextKey{}).(*core.SessionMetadata)
+	return metadata
+}
+
+// initializeSessionMetadata sets the session metadata defaults and checks that
+// RefreshTokenStore can keep the metadata.
+func (mw *GinJWTMiddleware) initializeSessionMetadata() error {
+	if !mw.EnableSessionMetadata {
+		return nil
+	}
+	if mw.DeviceNameHeader == "" {
+		mw.DeviceNameHeader = DefaultDeviceNameHeader
+	}
+	if _, ok := mw.dataStore(); !ok {
+		return ErrSessionMetadataNotSupported
+	}
+	return nil
+}
+
+// sessionMetadata captures the device of the request c, for the refresh token it is issued.
+// previous is the metadata of the refresh token being exchanged, nil at login: the device
+// name is kept when the request does not send one, and the refresh count goes on.
+// SessionMetadataFunc has the last word on what is recorded.
+func (mw *GinJWTMiddleware) sessionMetadata(
+	c *gin.Context,
+	previous *core.SessionMetadata,
+) *core.SessionMetadata {
+	if !mw.EnableSessionMetadata {
+		return nil
+	}
+
+	metadata := &core.SessionMetadata{LastUsed: mw.TimeFunc()}
+	if previous != nil {
+		metadata = previous.Clone()
+		metadata.LastUsed = mw.TimeFunc()
+		metadata.RefreshCount++
+	}
+	if c.Request != nil {
+		metadata.UserAgent = truncateMetadataValue(c.Request.UserAgent())
+		metadata.ClientIP = c.ClientIP()
+		if name := c.GetHeader(mw.DeviceNameHeader); name != "" {
+			metadata.DeviceName = truncateMetadataValue(name)
+		}
+	}
+
+	if mw.SessionMetadataFunc != nil {
+		return mw.SessionMetadataFunc(c, metadata)
+	}
+	return metadata
+}
+
+// truncateMetadataValue cuts value to maxMetadataValueSize bytes, without splitting a
+// UTF-8 sequence.
+func truncateMetadataValue(value string) string {
+	if len(value) <= maxMetadataValueSize {
+		return value
+	}
+	end := maxMetadataValueSize
+	for end > 0 && !utf8.RuneStart(value[end]) {
+		end--
+	}
+	return value[:end]
+}
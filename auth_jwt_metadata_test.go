@@ -0,0 +1,156 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/appleboy/gin-jwt/v3/store"
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newSessionMetadataMiddleware(
+	t *testing.T,
+	tokenStore *store.InMemoryRefreshTokenStore,
+	now *time.Time,
+) *GinJWTMiddleware {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:                 "test zone",
+		Key:                   key,
+		Timeout:               time.Hour,
+		Authenticator:         validAuthenticator,
+		RefreshTokenStore:     tokenStore,
+		EnableSessionMetadata: true,
+		TimeFunc: func() time.Time {
+			return *now
+		},
+	})
+	require.NoError(t, err)
+	return authMiddleware
+}
+
+func TestSessionMetadata(t *testing.T) {
+	now := time.Now()
+	tokenStore := store.NewInMemoryRefreshTokenStore()
+	handler := ginHandler(newSessionMetadataMiddleware(t, tokenStore, &now))
+	ctx := context.Background()
+
+	_, refreshToken := loginTokens(t, handler, testAdmin, gofight.H{
+		"User-Agent":    "test-agent",
+		"X-Device-Name": "Work laptop",
+	})
+
+	data, err := tokenStore.GetData(ctx, refreshToken)
+	require.NoError(t, err)
+	require.NotNil(t, data.Metadata)
+	assert.Equal(t, "test-agent", data.Metadata.UserAgent)
+	assert.Equal(t, "Work laptop", data.Metadata.DeviceName)
+	assert.Equal(t, now, data.Metadata.LastUsed)
+	assert.Zero(t, data.Metadata.RefreshCount)
+
+	// A refresh updates the metadata, and keeps the device name
+	for i := 1; i <= 2; i++ {
+		now = now.Add(time.Minute)
+		gofight.New().POST("/refresh").
+			SetHeader(gofight.H{"User-Agent": "updated-agent"}).
+			SetJSON(gofight.D{"refresh_token": refreshToken}).
+			Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+				require.Equal(t, http.StatusOK, r.Code)
+				refreshToken = gjson.Get(r.Body.String(), "refresh_token").String()
+			})
+
+		data, err = tokenStore.GetData(ctx, refreshToken)
+		require.NoError(t, err)
+		require.NotNil(t, data.Metadata)
+		assert.Equal(t, "updated-agent", data.Metadata.UserAgent)
+		assert.Equal(t, "Work laptop", data.Metadata.DeviceName)
+		assert.Equal(t, now, data.Metadata.LastUsed)
+		assert.Equal(t, i, data.Metadata.RefreshCount)
+	}
+}
+
+func TestSessionMetadataClientIP(t *testing.T) {
+	now := time.Now()
+	authMiddleware := newSessionMetadataMiddleware(
+		t, store.NewInMemoryRefreshTokenStore(), &now,
+	)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+	c.Request.RemoteAddr = "192.0.2.1:1234"
+	assert.Equal(t, "192.0.2.1", authMiddleware.sessionMetadata(c, nil).ClientIP)
+}
+
+func TestSessionMetadataTruncated(t *testing.T) {
+	now := time.Now()
+	authMiddleware := newSessionMetadataMiddleware(
+		t, store.NewInMemoryRefreshTokenStore(), &now,
+	)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+	c.Request.Header.Set("User-Agent", strings.Repeat("a", 1000))
+	c.Request.Header.Set("X-Device-Name", "a"+strings.Repeat("é", 100))
+
+	metadata := authMiddleware.sessionMetadata(c, nil)
+	assert.Equal(t, strings.Repeat("a", maxMetadataValueSize), metadata.UserAgent)
+	assert.Len(t, metadata.DeviceName, maxMetadataValueSize-1, "runes are not split")
+	assert.True(t, utf8.ValidString(metadata.DeviceName))
+}
+
+func TestSessionMetadataFunc(t *testing.T) {
+	now := time.Now()
+	tokenStore := store.NewInMemoryRefreshTokenStore()
+	authMiddleware := newSessionMetadataMiddleware(t, tokenStore, &now)
+	authMiddleware.SessionMetadataFunc = func(
+		c *gin.Context,
+		metadata *core.SessionMetadata,
+	) *core.SessionMetadata {
+		metadata.ClientIP = ""
+		metadata.Extra = map[string]string{"tenant": c.GetHeader("X-Tenant")}
+		return metadata
+	}
+	handler := ginHandler(authMiddleware)
+
+	_, refreshToken := loginTokens(t, handler, testAdmin, gofight.H{"X-Tenant": "acme"})
+
+	data, err := tokenStore.GetData(context.Background(), refreshToken)
+	require.NoError(t, err)
+	require.NotNil(t, data.Metadata)
+	assert.Empty(t, data.Metadata.ClientIP)
+	assert.Equal(t, "acme", data.Metadata.Extra["tenant"])
+
+	// Nothing is recorded when the hook returns nil
+	authMiddleware.SessionMetadataFunc = func(
+		c *gin.Context,
+		metadata *core.SessionMetadata,
+	) *core.SessionMetadata {
+		return nil
+	}
+	_, refreshToken = loginTokens(t, handler, testAdmin, nil)
+
+	data, err = tokenStore.GetData(context.Background(), refreshToken)
+	require.NoError(t, err)
+	assert.Nil(t, data.Metadata)
+}
+
+func TestSessionMetadataNotSupported(t *testing.T) {
+	_, err := New(&GinJWTMiddleware{
+		Realm:                 "test zone",
+		Key:                   key,
+		RefreshTokenStore:     plainTokenStore{store.NewInMemoryRefreshTokenStore()},
+		EnableSessionMetadata: true,
+	})
+	assert.ErrorIs(t, err, ErrSessionMetadataNotSupported)
+}
@@ -0,0 +1,247 @@
+package jwt
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+)
+
+// Metric names reported to MetricsRecorder
+const (
+	// MetricAuthRequests counts middleware decisions by outcome and reason
+	MetricAuthRequests = "gin_jwt_auth_requests_total"
+	// MetricLogins counts LoginHandler and MFAHandler results by outcome and reason
+	MetricLogins = "gin_jwt_logins_total"
+	// MetricRefreshes counts RefreshHandler results by outcome and reason
+	MetricRefreshes = "gin_jwt_refreshes_total"
+	// MetricLogouts counts LogoutHandler results by outcome
+	MetricLogouts = "gin_jwt_logouts_total"
+	// MetricStoreOperationDuration is the latency histogram of refresh token store calls,
+	// labelled by operation and result
+	MetricStoreOperationDuration = "gin_jwt_store_operation_duration_seconds"
+	// MetricRefreshTokens is the gauge of active refresh tokens, backed by TokenStore.Count
+	MetricRefreshTokens = "gin_jwt_refresh_tokens"
+)
+
+// Values of the outcome label
+const (
+	OutcomeSuccess     = "success"
+	OutcomeRejected    = "rejected"
+	OutcomeForbidden   = "forbidden"
+	OutcomeFailure     = "failure"
+	OutcomeLocked      = "locked"
+	OutcomeMFARequired = "mfa_required"
+	OutcomeError       = "error"
+)
+
+// Values of the operation label of MetricStoreOperationDuration
+const (
+	StoreOperationSet       = "set"
+	StoreOperationGet       = "get"
+	StoreOperationDelete    = "delete"
+	StoreOperationConsume   = "consume"
+	StoreOperationSessions  = "sessions"
+	StoreOperationWatermark = "watermark"
+)
+
+// MetricsRecorder receives the measurements of the middleware.
+// The metrics package provides an implementation exported through expvar
+// and the Prometheus text format; adapters for other systems only need these three methods.
+type MetricsRecorder interface {
+	// IncCounter increments the counter name for the given labels
+	IncCounter(name string, labels map[string]string)
+
+	// ObserveDuration records d in the histogram name for the given labels
+	ObserveDuration(name string, d time.Duration, labels map[string]string)
+
+	// RegisterGauge registers a gauge whose value is read from fn when metrics are collected
+	RegisterGauge(name string, fn func() float64)
+}
+
+// countOutcome increments counter name with the outcome and, for failures, the reason of err.
+func (mw *GinJWTMiddleware) countOutcome(name, outcome string, err error) {
+	if mw.Metrics == nil {
+		return
+	}
+
+	labels := map[string]string{"outcome": outcome}
+	if err != nil {
+		labels["reason"] = errorReason(err)
+	}
+	mw.Metrics.IncCounter(name, labels)
+}
+
+// observeStore records the latency of a refresh token store call.
+func (mw *GinJWTMiddleware) observeStore(operation string, start time.Time, err error) {
+	if mw.Metrics == nil {
+		return
+	}
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	mw.Metrics.ObserveDuration(MetricStoreOperationDuration, time.Since(start), map[string]string{
+		"operation": operation,
+		"result":    result,
+	})
+}
+
+// registerMetrics registers the gauges of the middleware. The refresh tokens are counted
+// once up front, so that a store unable to count them fails MiddlewareInit.
+func (mw *GinJWTMiddleware) registerMetrics() error {
+	if mw.Metrics == nil {
+		return nil
+	}
+
+	count, err := mw.storeCount(context.Background())
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMetricsRegistration, err)
+	}
+
+	// A failed count is logged and the gauge keeps its last value instead of dropping to 0
+	var last atomic.Int64
+	last.Store(int64(count))
+	mw.Metrics.RegisterGauge(MetricRefreshTokens, func() float64 {
+		count, err := mw.storeCount(context.Background())
+		if err != nil {
+			mw.logger().Warn("failed to count refresh tokens",
+				logKeyStore, storeType(mw.RefreshTokenStore),
+				logKeyErrorKind, errorKindStore,
+				logKeyError, err,
+			)
+			return float64(last.Load())
+		}
+		last.Store(int64(count))
+		return float64(count)
+	})
+	return nil
+}
+
+// storeSet calls RefreshTokenStore.Set inside a span and records its latency.
+func (mw *GinJWTMiddleware) storeSet(ctx context.Context, token string, data any, expiry time.Time) error {
+	ctx, span := mw.startStoreSpan(ctx, SpanStoreSet)
+	start := time.Now()
+	err := mw.RefreshTokenStore.Set(ctx, token, data, expiry)
+	mw.observeStore(StoreOperationSet, start, err)
+	endSpan(span, err)
+	return err
+}
+
+// storeGet calls RefreshTokenStore.Get inside a span and records its latency.
+func (mw *GinJWTMiddleware) storeGet(ctx context.Context, token string) (any, error) {
+	ctx, span := mw.startStoreSpan(ctx, SpanStoreGet)
+	start := time.Now()
+	data, err := mw.RefreshTokenStore.Get(ctx, token)
+	mw.observeStore(StoreOperationGet, start, err)
+	endSpan(span, err)
+	return data, err
+}
+
+// storeSetData calls SetData of a core.DataStore inside a span and records its latency.
+func (mw *GinJWTMiddleware) storeSetData(
+	ctx context.Context,
+	store core.DataStore,
+	token string,
+	data *core.RefreshTokenData,
+) error {
+	ctx, span := mw.startStoreSpan(ctx, SpanStoreSet)
+	start := time.Now()
+	err := store.SetData(ctx, token, data)
+	mw.observeStore(StoreOperationSet, start, err)
+	endSpan(span, err)
+	return err
+}
+
+// storeGetData calls GetData of a core.DataStore inside a span and records its latency.
+func (mw *GinJWTMiddleware) storeGetData(
+	ctx context.Context,
+	store core.DataStore,
+	token string,
+) (*core.RefreshTokenData, error) {
+	ctx, span := mw.startStoreSpan(ctx, SpanStoreGet)
+	start := time.Now()
+	data, err := store.GetData(ctx, token)
+	mw.observeStore(StoreOperationGet, start, err)
+	endSpan(span, err)
+	return data, err
+}
+
+// storeDelete calls RefreshTokenStore.Delete inside a span and records its latency.
+func (mw *GinJWTMiddleware) storeDelete(ctx context.Context, token string) error {
+	ctx, span := mw.startStoreSpan(ctx, SpanStoreDelete)
+	start := time.Now()
+	err := mw.RefreshTokenStore.Delete(ctx, token)
+	mw.observeStore(StoreOperationDelete, start, err)
+	endSpan(span, err)
+	return err
+}
+
+// storeConsume calls Consume of a core.ConsumeStore inside a span and records its latency.
+func (mw *GinJWTMiddleware) storeConsume(
+	ctx context.Context,
+	consumer core.ConsumeStore,
+	token string,
+) (any, error) {
+	ctx, span := mw.startStoreSpan(ctx, SpanStoreConsume)
+	start := time.Now()
+	data, err := consumer.Consume(ctx, token)
+	mw.observeStore(StoreOperationConsume, start, err)
+	endSpan(span, err)
+	return data, err
+}
+
+// storeSessions calls Sessions of a core.SessionStore inside a span and records its latency.
+func (mw *GinJWTMiddleware) storeSessions(
+	ctx context.Context,
+	store core.SessionStore,
+	subject string,
+) ([]core.Session, error) {
+	ctx, span := mw.startStoreSpan(ctx, SpanStoreSessions)
+	start := time.Now()
+	sessions, err := store.Sessions(ctx, subject)
+	mw.observeStore(StoreOperationSessions, start, err)
+	endSpan(span, err)
+	return sessions, err
+}
+
+// storeWatermark calls Watermark of a core.WatermarkStore inside a span and records its latency.
+func (mw *GinJWTMiddleware) storeWatermark(
+	ctx context.Context,
+	store core.WatermarkStore,
+	subject string,
+) (time.Time, error) {
+	ctx, span := mw.startStoreSpan(ctx, SpanStoreWatermark)
+	start := time.Now()
+	watermark, err := store.Watermark(ctx, subject)
+	mw.observeStore(StoreOperationWatermark, start, err)
+	endSpan(span, err)
+	return watermark, err
+}
+
+// storeSetWatermark calls SetWatermark of a core.WatermarkStore inside a span and records its
+// latency under the same operation as storeWatermark.
+func (mw *GinJWTMiddleware) storeSetWatermark(
+	ctx context.Context,
+	store core.WatermarkStore,
+	subject string,
+	watermark time.Time,
+) error {
+	ctx, span := mw.startStoreSpan(ctx, SpanStoreWatermark)
+	start := time.Now()
+	err := store.SetWatermark(ctx, subject, watermark)
+	mw.observeStore(StoreOperationWatermark, start, err)
+	endSpan(span, err)
+	return err
+}
+
+// storeCount calls RefreshTokenStore.Count inside a span.
+func (mw *GinJWTMiddleware) storeCount(ctx context.Context) (int, error) {
+	ctx, span := mw.startStoreSpan(ctx, SpanStoreCount)
+	count, err := mw.RefreshTokenStore.Count(ctx)
+	endSpan(span, err)
+	return count, err
+}
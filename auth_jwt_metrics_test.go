@@ -0,0 +1,188 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/appleboy/gin-jwt/v3/metrics"
+	"github.com/appleboy/gin-jwt/v3/store"
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+var _ MetricsRecorder = metrics.NewRegistry()
+
+func TestMetricsOutcomes(t *testing.T) {
+	registry := metrics.NewRegistry()
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: validAuthenticator,
+		Authorizer: func(c *gin.Context, data any) bool {
+			return data == testAdmin
+		},
+		Metrics: registry,
+	})
+	require.NoError(t, err)
+
+	handler := ginHandler(authMiddleware)
+	r := gofight.New()
+
+	var refreshToken string
+	r.POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": testPassword}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			refreshToken = gjson.Get(r.Body.String(), "refresh_token").String()
+		})
+	r.POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": "wrong"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {})
+	r.POST("/refresh").
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+	r.POST("/refresh").
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+	r.GET("/auth/hello").
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {})
+	r.GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + makeTokenString("HS256", testAdmin)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {})
+	r.GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + makeTokenString("HS256", testUser)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {})
+	r.POST("/logout").
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {})
+
+	assert.Equal(t, uint64(1), registry.Counter(MetricLogins, map[string]string{"outcome": OutcomeSuccess}))
+	assert.Equal(t, uint64(1), registry.Counter(MetricLogins, map[string]string{
+		"outcome": OutcomeFailure,
+		"reason":  ReasonInvalidCredentials,
+	}))
+	assert.Equal(t, uint64(1), registry.Counter(MetricRefreshes, map[string]string{"outcome": OutcomeSuccess}))
+	assert.Equal(t, uint64(1), registry.Counter(MetricRefreshes, map[string]string{
+		"outcome": OutcomeFailure,
+		"reason":  ReasonInvalidRefreshToken,
+	}))
+	assert.Equal(t, uint64(1), registry.Counter(MetricAuthRequests, map[string]string{"outcome": OutcomeSuccess}))
+	assert.Equal(t, uint64(1), registry.Counter(MetricAuthRequests, map[string]string{
+		"outcome": OutcomeForbidden,
+		"reason":  ReasonForbidden,
+	}))
+	assert.Equal(t, uint64(1), registry.Counter(MetricAuthRequests, map[string]string{
+		"outcome": OutcomeRejected,
+		"reason":  ReasonMissingToken,
+	}))
+	assert.Equal(t, uint64(1), registry.Counter(MetricLogouts, map[string]string{"outcome": OutcomeSuccess}))
+
+	// login set, refresh get+set+delete, failed refresh get
+	assert.Equal(t, uint64(2), registry.HistogramCount(MetricStoreOperationDuration, map[string]string{
+		"operation": StoreOperationSet,
+		"result":    "ok",
+	}))
+	assert.Equal(t, uint64(1), registry.HistogramCount(MetricStoreOperationDuration, map[string]string{
+		"operation": StoreOperationGet,
+		"result":    "error",
+	}))
+	assert.Equal(t, float64(1), registry.Snapshot()[MetricRefreshTokens])
+}
+
+func TestMetricsLoginErrors(t *testing.T) {
+	registry := metrics.NewRegistry()
+	authMiddleware := newMFAMiddleware(t, time.Now)
+	authMiddleware.Metrics = registry
+	handler := mfaHandler(authMiddleware)
+	r := gofight.New()
+
+	r.POST("/login/mfa").
+		SetJSON(gofight.D{}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+		})
+	r.POST("/login/mfa").
+		SetJSON(gofight.D{"mfa_token": "invalid", "code": "123456"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+
+	authMiddleware.MFAVerifier = nil
+	r.POST("/login/mfa").
+		SetJSON(gofight.D{"mfa_token": "invalid", "code": "123456"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusInternalServerError, r.Code)
+		})
+
+	authMiddleware.Authenticator = nil
+	r.POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": testPassword}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusInternalServerError, r.Code)
+		})
+
+	assert.Equal(t, uint64(1), registry.Counter(MetricLogins, map[string]string{
+		"outcome": OutcomeFailure,
+		"reason":  ReasonMissingMFAValues,
+	}))
+	assert.Equal(t, uint64(1), registry.Counter(MetricLogins, map[string]string{
+		"outcome": OutcomeFailure,
+		"reason":  ReasonInvalidMFAToken,
+	}))
+	assert.Equal(t, uint64(2), registry.Counter(MetricLogins, map[string]string{
+		"outcome": OutcomeError,
+		"reason":  ReasonServerError,
+	}))
+}
+
+type countFailStore struct {
+	core.TokenStore
+	err error
+}
+
+func (s *countFailStore) Count(ctx context.Context) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return s.TokenStore.Count(ctx)
+}
+
+func TestMetricsRegistrationError(t *testing.T) {
+	tokenStore := &countFailStore{
+		TokenStore: store.NewInMemoryRefreshTokenStore(),
+		err:        errors.New("count failed"),
+	}
+	_, err := New(&GinJWTMiddleware{
+		Key:               key,
+		Authenticator:     validAuthenticator,
+		RefreshTokenStore: tokenStore,
+		Metrics:           metrics.NewRegistry(),
+	})
+	assert.ErrorIs(t, err, ErrMetricsRegistration)
+
+	// Once registered, a failed count keeps the last value of the gauge
+	tokenStore.err = nil
+	registry := metrics.NewRegistry()
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Key:               key,
+		Authenticator:     validAuthenticator,
+		RefreshTokenStore: tokenStore,
+		Metrics:           registry,
+	})
+	require.NoError(t, err)
+
+	loginTokens(t, ginHandler(authMiddleware), testAdmin, nil)
+	assert.Equal(t, float64(1), registry.Snapshot()[MetricRefreshTokens])
+
+	tokenStore.err = errors.New("count failed")
+	assert.Equal(t, float64(1), registry.Snapshot()[MetricRefreshTokens])
+}
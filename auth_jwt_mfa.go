@@ -0,0 +1,221 @@
+package jwt
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	claimPurpose          = "purpose"
+	claimJTI              = "jti"
+	claimLoginAttemptKeys = "login_attempt_keys"
+	purposeMFAPending     = "mfa_pending"
+	mfaStoreKeyPrefix     = "mfa_pending:"
+	keyMFAToken           = "mfa_token"
+	keyMFACode            = "code"
+)
+
+// MFAVerifier verifies the second authentication factor presented to MFAHandler.
+// data is the value returned by Authenticator for the first factor.
+// Implementations return false with a nil error when the code is simply wrong.
+type MFAVerifier interface {
+	Verify(c *gin.Context, data any, code string) (bool, error)
+}
+
+// MFAVerifierFunc is an adapter to allow the use of ordinary functions as MFAVerifier,
+// e.g. for backup codes or a custom verification service.
+type MFAVerifierFunc func(c *gin.Context, data any, code string) (bool, error)
+
+// Verify calls f(c, data, code).
+func (f MFAVerifierFunc) Verify(c *gin.Context, data any, code string) (bool, error) {
+	return f(c, data, code)
+}
+
+// mfaRequest is the payload expected by MFAHandler.
+type mfaRequest struct {
+	MFAToken string `form:"mfa_token" json:"mfa_token"`
+	Code     string `form:"code"      json:"code"`
+}
+
+// initializeMFA checks the configuration of a TOTPVerifier set as MFAVerifier.
+func (mw *GinJWTMiddleware) initializeMFA() error {
+	if verifier, ok := mw.MFAVerifier.(*TOTPVerifier); ok {
+		return verifier.Validate()
+	}
+	return nil
+}
+
+// mfaRequired reports whether the user identified by data must pass the second factor.
+func (mw *GinJWTMiddleware) mfaRequired(c *gin.Context, data any) bool {
+	if mw.MFAVerifier == nil {
+		return false
+	}
+	if mw.MFARequired == nil {
+		return true
+	}
+	return mw.MFARequired(c, data)
+}
+
+// mfaStoreKey returns the store key holding the user data of a pending MFA login.
+func mfaStoreKey(jti string) string {
+	return mfaStoreKeyPrefix + jti
+}
+
+// generateMFAPendingToken creates a short-lived token that can only be exchanged
+// through MFAHandler. The user data is kept server-side in RefreshTokenStore, and the
+// login attempt keys of the first factor travel in the token, so that MFAHandler counts
+// wrong codes against them.
+func (mw *GinJWTMiddleware) generateMFAPendingToken(
+	c *gin.Context,
+	data any,
+	attemptKeys []string,
+) (string, time.Time, error) {
+	signingMethod := jwt.GetSigningMethod(mw.SigningAlgorithm)
+	if signingMethod == nil {
+		return "", time.Time{}, ErrInvalidSigningAlgorithm
+	}
+
+	jti, err := mw.generateRefreshToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := mw.TimeFunc()
+	expire := now.Add(mw.MFATimeout)
+	ctx := c.Request.Context()
+	err = mw.setStoreRecord(ctx, core.KindMFAPending, mfaStoreKey(jti), data, expire)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	token := jwt.New(signingMethod)
+	claims := token.Claims.(jwt.MapClaims)
+	claims[claimPurpose] = purposeMFAPending
+	claims[claimJTI] = jti
+	claims["iat"] = now.Unix()
+	claims[mw.ExpField] = expire.Unix()
+	if rememberMe(c) {
+		claims[claimRememberMe] = true
+	}
+	if len(attemptKeys) > 0 {
+		claims[claimLoginAttemptKeys] = attemptKeys
+	}
+
+	tokenString, err := mw.signedString(ctx, token)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expire, nil
+}
+
+// mfaLoginAttemptKeys returns the login attempt keys carried by an mfa_pending token.
+func mfaLoginAttemptKeys(claims jwt.MapClaims) []string {
+	values, _ := claims[claimLoginAttemptKeys].([]any)
+	keys := make([]string, 0, len(values))
+	for _, value := range values {
+		if key, ok := value.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// isMFAPendingToken reports whether claims belong to an mfa_pending token.
+func isMFAPendingToken(claims jwt.MapClaims) bool {
+	purpose, _ := claims[claimPurpose].(string)
+	return purpose == purposeMFAPending
+}
+
+// MFAHandler exchanges the mfa_pending token returned by LoginHandler and a valid
+// second-factor code for a full token pair.
+// Payload needs to be json or form in the form of {"mfa_token": "TOKEN", "code": "123456"}.
+// The pending token is single use: it is discarded after a successful or failed attempt.
+func (mw *GinJWTMiddleware) MFAHandler(c *gin.Context) {
+	if mw.MFAVerifier == nil {
+		mw.countOutcome(MetricLogins, OutcomeError, ErrMissingMFAVerifier)
+		mw.unauthorized(c, PhaseLogin, http.StatusInternalServerError, ErrMissingMFAVerifier)
+		return
+	}
+
+	var req mfaRequest
+	if err := c.ShouldBind(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		mw.countOutcome(MetricLogins, OutcomeFailure, ErrMissingMFAValues)
+		mw.unauthorized(c, PhaseLogin, http.StatusBadRequest, ErrMissingMFAValues)
+		return
+	}
+
+	token, err := mw.parseTokenString(c.Request.Context(), req.MFAToken)
+	if err != nil {
+		mw.countOutcome(MetricLogins, OutcomeFailure, ErrInvalidMFAToken)
+		mw.unauthorized(c, PhaseLogin, http.StatusUnauthorized, ErrInvalidMFAToken)
+		return
+	}
+
+	claims := ExtractClaimsFromToken(token)
+	jti, _ := claims[claimJTI].(string)
+	if !isMFAPendingToken(claims) || jti == "" {
+		mw.countOutcome(MetricLogins, OutcomeFailure, ErrInvalidMFAToken)
+		mw.unauthorized(c, PhaseLogin, http.StatusUnauthorized, ErrInvalidMFAToken)
+		return
+	}
+
+	// Wrong codes count as failed logins of the first factor
+	ctx := c.Request.Context()
+	attemptKeys := mfaLoginAttemptKeys(claims)
+	if mw.loginProtectionEnabled() {
+		until, err := mw.loginLockedUntil(c, attemptKeys)
+		if err != nil {
+			mw.emit(c, EventLoginFailure, nil, err)
+			mw.countOutcome(MetricLogins, OutcomeError, err)
+			mw.unauthorized(c, PhaseLogin, http.StatusServiceUnavailable, ErrLoginAttemptStore)
+			return
+		}
+		if !until.IsZero() {
+			mw.emit(c, EventLoginFailure, nil, ErrLoginLocked)
+			mw.countOutcome(MetricLogins, OutcomeLocked, ErrLoginLocked)
+			mw.loginLocked(c, until)
+			return
+		}
+	}
+
+	// The remember me flag was sent with the first factor
+	remember, _ := claims[claimRememberMe].(bool)
+	c.Set(rememberMeContextKey, remember)
+
+	key := mfaStoreKey(jti)
+	data, err := mw.storeRecord(ctx, core.KindMFAPending, key)
+	if err != nil {
+		mw.countOutcome(MetricLogins, OutcomeFailure, ErrInvalidMFAToken)
+		mw.unauthorized(c, PhaseLogin, http.StatusUnauthorized, ErrInvalidMFAToken)
+		return
+	}
+
+	// Discard the pending login before verifying so that a token can never be
+	// used to try more than one code.
+	if err := mw.storeDelete(ctx, key); err != nil {
+		mw.countOutcome(MetricLogins, OutcomeError, err)
+		mw.unauthorized(c, PhaseLogin, http.StatusInternalServerError, err)
+		return
+	}
+
+	ok, err := mw.MFAVerifier.Verify(c, data, req.Code)
+	if err != nil || !ok {
+		if mw.loginProtectionEnabled() {
+			mw.registerLoginFailure(c, attemptKeys)
+		}
+		mw.emit(c, EventLoginFailure, data, ErrInvalidMFACode)
+		mw.countOutcome(MetricLogins, OutcomeFailure, ErrInvalidMFACode)
+		mw.unauthorized(c, PhaseLogin, http.StatusUnauthorized, ErrInvalidMFACode)
+		return
+	}
+
+	if mw.loginProtectionEnabled() {
+		mw.clearLoginFailures(ctx, attemptKeys)
+	}
+	mw.issueTokenPair(c, data)
+}
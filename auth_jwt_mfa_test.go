@@ -0,0 +1,365 @@
+package jwt
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+var totpTestSecret = []byte("12345678901234567890")
+
+func newMFAMiddleware(t *testing.T, now func() time.Time) *GinJWTMiddleware {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: validAuthenticator,
+		MFAVerifier: &TOTPVerifier{
+			SecretFunc: func(c *gin.Context, data any) ([]byte, error) {
+				return totpTestSecret, nil
+			},
+			TimeFunc: now,
+		},
+	})
+	require.NoError(t, err)
+
+	return authMiddleware
+}
+
+func mfaHandler(auth *GinJWTMiddleware) *gin.Engine {
+	r := ginHandler(auth)
+	r.POST("/login/mfa", auth.MFAHandler)
+	return r
+}
+
+func loginForMFAToken(t *testing.T, handler *gin.Engine) string {
+	t.Helper()
+
+	var mfaToken string
+	gofight.New().POST("/login").
+		SetJSON(gofight.D{
+			"username": testAdmin,
+			"password": testPassword,
+		}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.True(t, gjson.Get(r.Body.String(), "mfa_required").Bool())
+			assert.False(t, gjson.Get(r.Body.String(), "access_token").Exists())
+			mfaToken = gjson.Get(r.Body.String(), "mfa_token").String()
+		})
+	require.NotEmpty(t, mfaToken)
+
+	return mfaToken
+}
+
+func TestMFALoginFlow(t *testing.T) {
+	now := time.Now()
+	authMiddleware := newMFAMiddleware(t, func() time.Time { return now })
+	handler := mfaHandler(authMiddleware)
+	r := gofight.New()
+
+	mfaToken := loginForMFAToken(t, handler)
+
+	// The pending token must not grant access to protected routes
+	r.GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + mfaToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ErrMFAPendingToken.Error(), gjson.Get(r.Body.String(), "message").String())
+		})
+
+	var accessToken string
+	r.POST("/login/mfa").
+		SetJSON(gofight.D{
+			"mfa_token": mfaToken,
+			"code":      GenerateTOTP(totpTestSecret, now, 6, 30*time.Second, ""),
+		}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			accessToken = gjson.Get(r.Body.String(), "access_token").String()
+			assert.NotEmpty(t, gjson.Get(r.Body.String(), "refresh_token").String())
+		})
+	require.NotEmpty(t, accessToken)
+
+	r.GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + accessToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	// The pending token is single use
+	r.POST("/login/mfa").
+		SetJSON(gofight.D{
+			"mfa_token": mfaToken,
+			"code":      GenerateTOTP(totpTestSecret, now, 6, 30*time.Second, ""),
+		}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ErrInvalidMFAToken.Error(), gjson.Get(r.Body.String(), "message").String())
+		})
+}
+
+func TestMFAHandlerInvalidCode(t *testing.T) {
+	now := time.Now()
+	authMiddleware := newMFAMiddleware(t, func() time.Time { return now })
+	handler := mfaHandler(authMiddleware)
+	r := gofight.New()
+
+	mfaToken := loginForMFAToken(t, handler)
+
+	r.POST("/login/mfa").
+		SetJSON(gofight.D{
+			"mfa_token": mfaToken,
+			"code":      "000000",
+		}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ErrInvalidMFACode.Error(), gjson.Get(r.Body.String(), "message").String())
+		})
+
+	// A failed attempt discards the pending login
+	r.POST("/login/mfa").
+		SetJSON(gofight.D{
+			"mfa_token": mfaToken,
+			"code":      GenerateTOTP(totpTestSecret, now, 6, 30*time.Second, ""),
+		}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ErrInvalidMFAToken.Error(), gjson.Get(r.Body.String(), "message").String())
+		})
+}
+
+func TestMFAHandlerRejectsAccessToken(t *testing.T) {
+	authMiddleware := newMFAMiddleware(t, time.Now)
+	handler := mfaHandler(authMiddleware)
+
+	gofight.New().POST("/login/mfa").
+		SetJSON(gofight.D{
+			"mfa_token": makeTokenString("HS256", testAdmin),
+			"code":      "123456",
+		}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ErrInvalidMFAToken.Error(), gjson.Get(r.Body.String(), "message").String())
+		})
+}
+
+func TestRefreshHandlerRejectsPendingMFALogin(t *testing.T) {
+	authMiddleware := newMFAMiddleware(t, time.Now)
+	handler := mfaHandler(authMiddleware)
+
+	token, err := authMiddleware.ParseTokenString(loginForMFAToken(t, handler))
+	require.NoError(t, err)
+	jti, _ := ExtractClaimsFromToken(token)[claimJTI].(string)
+	require.NotEmpty(t, jti)
+
+	// The pending login cannot be exchanged without the second factor
+	gofight.New().POST("/refresh").
+		SetJSON(gofight.D{"refresh_token": mfaStoreKey(jti)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ErrInvalidRefreshToken.Error(),
+				gjson.Get(r.Body.String(), "message").String())
+		})
+
+	// Entries of another kind are refused whatever their key
+	ctx := t.Context()
+	require.NoError(t, authMiddleware.setStoreRecord(
+		ctx, core.KindMFAPending, "pending", testAdmin, time.Now().Add(time.Minute),
+	))
+	_, err = authMiddleware.validateRefreshToken(ctx, "pending")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestMFAHandlerMissingValues(t *testing.T) {
+	authMiddleware := newMFAMiddleware(t, time.Now)
+	handler := mfaHandler(authMiddleware)
+
+	gofight.New().POST("/login/mfa").
+		SetJSON(gofight.D{"code": "123456"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusBadRequest, r.Code)
+			assert.Equal(t, ErrMissingMFAValues.Error(), gjson.Get(r.Body.String(), "message").String())
+		})
+}
+
+func TestMFARequiredSkipsSecondFactor(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: validAuthenticator,
+		MFAVerifier: MFAVerifierFunc(func(c *gin.Context, data any, code string) (bool, error) {
+			return code == "backup-code", nil
+		}),
+		MFARequired: func(c *gin.Context, data any) bool {
+			return data != testAdmin
+		},
+	})
+	require.NoError(t, err)
+
+	gofight.New().POST("/login").
+		SetJSON(gofight.D{
+			"username": testAdmin,
+			"password": testPassword,
+		}).
+		Run(ginHandler(authMiddleware), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.NotEmpty(t, gjson.Get(r.Body.String(), "access_token").String())
+		})
+}
+
+func TestMFAHandlerWithoutVerifier(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: validAuthenticator,
+	})
+	require.NoError(t, err)
+
+	gofight.New().POST("/login/mfa").
+		SetJSON(gofight.D{"mfa_token": "x", "code": "123456"}).
+		Run(mfaHandler(authMiddleware), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusInternalServerError, r.Code)
+		})
+}
+
+// RFC 6238 Appendix B test vectors (8 digits)
+func TestGenerateTOTP(t *testing.T) {
+	seeds := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+
+	testCases := []struct {
+		unix      int64
+		algorithm string
+		expected  string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1234567890, "SHA1", "89005924"},
+		{2000000000, "SHA256", "90698825"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, tc := range testCases {
+		code := GenerateTOTP(seeds[tc.algorithm], time.Unix(tc.unix, 0), 8, 30*time.Second, tc.algorithm)
+		assert.Equal(t, tc.expected, code, "%s at %d", tc.algorithm, tc.unix)
+	}
+}
+
+func TestTOTPVerifierSkew(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	verifier := &TOTPVerifier{
+		SecretFunc: func(c *gin.Context, data any) ([]byte, error) {
+			return totpTestSecret, nil
+		},
+		TimeFunc: func() time.Time { return now },
+	}
+
+	previous := GenerateTOTP(totpTestSecret, now.Add(-30*time.Second), 6, 30*time.Second, "")
+	ok, err := verifier.Verify(nil, nil, previous)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	stale := GenerateTOTP(totpTestSecret, now.Add(-90*time.Second), 6, 30*time.Second, "")
+	ok, err = verifier.Verify(nil, nil, stale)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = verifier.Verify(nil, nil, "12345")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestTOTPVerifierReplay(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	verifier := &TOTPVerifier{
+		SecretFunc: func(c *gin.Context, data any) ([]byte, error) {
+			return totpTestSecret, nil
+		},
+		TimeFunc: func() time.Time { return now },
+	}
+
+	current := GenerateTOTP(totpTestSecret, now, 6, 30*time.Second, "")
+	ok, err := verifier.Verify(nil, nil, current)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// A code is single use, and an older code is refused once a newer one was accepted
+	ok, _ = verifier.Verify(nil, nil, current)
+	assert.False(t, ok)
+	previous := GenerateTOTP(totpTestSecret, now.Add(-30*time.Second), 6, 30*time.Second, "")
+	ok, _ = verifier.Verify(nil, nil, previous)
+	assert.False(t, ok)
+
+	now = now.Add(30 * time.Second)
+	next := GenerateTOTP(totpTestSecret, now, 6, 30*time.Second, "")
+	ok, _ = verifier.Verify(nil, nil, next)
+	assert.True(t, ok)
+
+	// AcceptStepFunc replaces the record in memory
+	var steps []uint64
+	verifier.AcceptStepFunc = func(c *gin.Context, data any, step uint64) (bool, error) {
+		steps = append(steps, step)
+		return true, nil
+	}
+	ok, _ = verifier.Verify(nil, nil, next)
+	assert.True(t, ok)
+	assert.Equal(t, []uint64{uint64(now.Unix() / 30)}, steps)
+}
+
+func TestTOTPVerifierConfig(t *testing.T) {
+	secretFunc := func(c *gin.Context, data any) ([]byte, error) {
+		return totpTestSecret, nil
+	}
+
+	invalid := map[string]*TOTPVerifier{
+		"sub-second period": {SecretFunc: secretFunc, Period: 500 * time.Millisecond},
+		"fractional period": {SecretFunc: secretFunc, Period: 1500 * time.Millisecond},
+		"negative period":   {SecretFunc: secretFunc, Period: -time.Second},
+		"too few digits":    {SecretFunc: secretFunc, Digits: 5},
+		"too many digits":   {SecretFunc: secretFunc, Digits: 10},
+		"negative skew":     {SecretFunc: secretFunc, Skew: -1},
+	}
+	for name, verifier := range invalid {
+		assert.ErrorIs(t, verifier.Validate(), ErrInvalidTOTPConfig, name)
+
+		ok, err := verifier.Verify(nil, nil, "123456")
+		assert.ErrorIs(t, err, ErrInvalidTOTPConfig, name)
+		assert.False(t, ok, name)
+
+		_, err = New(&GinJWTMiddleware{
+			Key:           key,
+			Authenticator: validAuthenticator,
+			MFAVerifier:   verifier,
+		})
+		assert.ErrorIs(t, err, ErrInvalidTOTPConfig, name)
+	}
+
+	valid := &TOTPVerifier{SecretFunc: secretFunc, Digits: 8, Period: 60 * time.Second}
+	assert.NoError(t, valid.Validate())
+}
+
+func TestDecodeTOTPSecret(t *testing.T) {
+	secret, err := DecodeTOTPSecret("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	assert.NoError(t, err)
+	assert.Equal(t, totpTestSecret, secret)
+
+	_, err = DecodeTOTPSecret("not base32!")
+	assert.ErrorIs(t, err, ErrInvalidTOTPSecret)
+}
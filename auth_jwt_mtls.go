@@ -0,0 +1,85 @@
+package jwt
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// claimX5T is the confirmation member holding the certificate thumbprint (RFC 8705 section 3.1)
+const claimX5T = "x5t#S256"
+
+type certificateContextKey struct{}
+
+// WithCertificateThumbprint returns a context that makes TokenGenerator bind the access token
+// to the base64url SHA-256 thumbprint x5t of a client certificate, see CertificateThumbprint.
+func WithCertificateThumbprint(ctx context.Context, x5t string) context.Context {
+	return context.WithValue(ctx, certificateContextKey{}, x5t)
+}
+
+// certificateThumbprint returns the thumbprint set by WithCertificateThumbprint.
+func certificateThumbprint(ctx context.Context) string {
+	x5t, _ := ctx.Value(certificateContextKey{}).(string)
+	return x5t
+}
+
+// CertificateThumbprint returns the x5t#S256 thumbprint of a certificate.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// peerCertificateThumbprint returns the thumbprint of the TLS client certificate of the request.
+func peerCertificateThumbprint(c *gin.Context) string {
+	if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return CertificateThumbprint(c.Request.TLS.PeerCertificates[0])
+}
+
+// certificateContext binds the tokens issued in ctx to the client certificate, if any.
+func (mw *GinJWTMiddleware) certificateContext(
+	ctx context.Context,
+	c *gin.Context,
+) context.Context {
+	if !mw.EnableCertificateBinding {
+		return ctx
+	}
+	if x5t := peerCertificateThumbprint(c); x5t != "" {
+		return WithCertificateThumbprint(ctx, x5t)
+	}
+	return ctx
+}
+
+// confirmationClaim returns the cnf claim of an access token issued in ctx, or nil when unbound.
+func confirmationClaim(ctx context.Context) map[string]any {
+	cnf := map[string]any{}
+	if jkt := dpopThumbprint(ctx); jkt != "" {
+		cnf[claimJKT] = jkt
+	}
+	if x5t := certificateThumbprint(ctx); x5t != "" {
+		cnf[claimX5T] = x5t
+	}
+	if len(cnf) == 0 {
+		return nil
+	}
+	return cnf
+}
+
+// checkCertificateBinding rejects a certificate-bound token presented without the same certificate.
+func (mw *GinJWTMiddleware) checkCertificateBinding(c *gin.Context, claims jwt.MapClaims) error {
+	cnf, _ := claims[claimConfirmation].(map[string]any)
+	x5t, _ := cnf[claimX5T].(string)
+	if x5t == "" {
+		return nil
+	}
+
+	if peerCertificateThumbprint(c) != x5t {
+		return ErrCertificateMismatch
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+// newClientCertificate creates a self-signed TLS client certificate.
+func newClientCertificate(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(
+		rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: privateKey, Leaf: leaf}
+}
+
+// newMTLSServer starts a TLS server that asks for any client certificate.
+func newMTLSServer(t *testing.T, auth *GinJWTMiddleware) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(ginHandler(auth))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// mtlsClient returns a client of server presenting cert, or no certificate when cert is nil.
+func mtlsClient(server *httptest.Server, cert *tls.Certificate) *http.Client {
+	client := server.Client()
+	transport := client.Transport.(*http.Transport).Clone()
+	if cert != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+	}
+	client.Transport = transport
+	return client
+}
+
+func mtlsLogin(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, url+"/login",
+		strings.NewReader(`{"username":"`+testAdmin+`","password":"`+testPassword+`"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return gjson.GetBytes(body, "access_token").String()
+}
+
+func mtlsHello(t *testing.T, client *http.Client, url, token string) int {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url+"/auth/hello", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestCertificateBoundToken(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:                    "test zone",
+		Key:                      key,
+		Timeout:                  time.Hour,
+		Authenticator:            validAuthenticator,
+		EnableCertificateBinding: true,
+	})
+	require.NoError(t, err)
+
+	server := newMTLSServer(t, authMiddleware)
+	cert := newClientCertificate(t, "service-a")
+	other := newClientCertificate(t, "service-b")
+
+	token := mtlsLogin(t, mtlsClient(server, &cert), server.URL)
+
+	parsed, err := authMiddleware.ParseTokenString(token)
+	require.NoError(t, err)
+	cnf, _ := ExtractClaimsFromToken(parsed)[claimConfirmation].(map[string]any)
+	assert.Equal(t, CertificateThumbprint(cert.Leaf), cnf[claimX5T])
+
+	assert.Equal(t, http.StatusOK, mtlsHello(t, mtlsClient(server, &cert), server.URL, token))
+	assert.Equal(t, http.StatusUnauthorized,
+		mtlsHello(t, mtlsClient(server, &other), server.URL, token))
+	assert.Equal(t, http.StatusUnauthorized,
+		mtlsHello(t, mtlsClient(server, nil), server.URL, token))
+}
+
+func TestCertificateBindingWithoutClientCertificate(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:                    "test zone",
+		Key:                      key,
+		Timeout:                  time.Hour,
+		Authenticator:            validAuthenticator,
+		EnableCertificateBinding: true,
+	})
+	require.NoError(t, err)
+
+	server := newMTLSServer(t, authMiddleware)
+	client := mtlsClient(server, nil)
+
+	// Tokens issued without a certificate stay plain bearer tokens
+	token := mtlsLogin(t, client, server.URL)
+
+	parsed, err := authMiddleware.ParseTokenString(token)
+	require.NoError(t, err)
+	assert.NotContains(t, ExtractClaimsFromToken(parsed), claimConfirmation)
+	assert.Equal(t, http.StatusOK, mtlsHello(t, client, server.URL, token))
+}
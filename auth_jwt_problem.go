@@ -0,0 +1,105 @@
+package jwt
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RFC 6750 and RFC 9449 error codes sent in the WWW-Authenticate header
+const (
+	BearerErrorInvalidRequest    = "invalid_request"
+	BearerErrorInvalidToken      = "invalid_token"
+	BearerErrorInsufficientScope = "insufficient_scope"
+	DPoPErrorInvalidProof        = "invalid_dpop_proof"
+)
+
+// ProblemContentType is the media type of RFC 9457 problem details
+const ProblemContentType = "application/problem+json"
+
+// defaultBearerErrorDescription is the error_description of errors that are not described
+const defaultBearerErrorDescription = "the token is invalid"
+
+// bearerError maps err to an RFC 6750 error code.
+// Per RFC 6750 section 3.1, no code is returned when the request carries no token,
+// nor for failures that are not about the presented token such as a lockout.
+func bearerError(err *AuthError) string {
+	// Custom Authenticator errors are about credentials, not a bearer token
+	if err.Phase == PhaseLogin && err.Kind == ReasonInvalid {
+		return ""
+	}
+
+	switch err.Kind {
+	case ReasonMissingToken,
+		ReasonMissingCredentials,
+		ReasonInvalidCredentials,
+		ReasonMissingMFAValues,
+		ReasonInvalidMFACode,
+		ReasonLocked,
+		ReasonSessionLimit,
+		ReasonSessionNotFound,
+		ReasonInvalidCSRFToken,
+		ReasonServerError:
+		return ""
+	case ReasonInvalidHeader:
+		return BearerErrorInvalidRequest
+	case ReasonForbidden:
+		return BearerErrorInsufficientScope
+	case ReasonInvalidDPoPProof:
+		return DPoPErrorInvalidProof
+	default:
+		return BearerErrorInvalidToken
+	}
+}
+
+// bearerChallenge builds the WWW-Authenticate header value for err.
+func (mw *GinJWTMiddleware) bearerChallenge(err *AuthError) string {
+	challenge := `Bearer realm="` + mw.Realm + `"`
+	// DPoP failures are answered with a DPoP challenge (RFC 9449 section 7.1)
+	if err.Kind == ReasonInvalidDPoPProof || err.Kind == ReasonDPoPRequired {
+		challenge = dpopScheme + ` realm="` + mw.Realm + `", algs="` +
+			strings.Join(mw.DPoPAlgorithms, " ") + `"`
+	}
+
+	code := bearerError(err)
+	if code == "" {
+		return challenge
+	}
+
+	return challenge + `, error="` + code + `", error_description="` + bearerErrorDescription(err) + `"`
+}
+
+// bearerErrorDescription describes err in error_description, without the characters
+// RFC 6750 does not allow. Errors of an unknown kind and server errors, e.g. a failing token
+// store, may carry internal details and get a generic description instead of their message.
+func bearerErrorDescription(err *AuthError) string {
+	if err.Kind == ReasonInvalid || err.Status >= http.StatusInternalServerError {
+		return defaultBearerErrorDescription
+	}
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return -1
+		}
+		return r
+	}, err.Error())
+}
+
+// problemResponse is the default Unauthorized func when ProblemDetails is enabled.
+// The code member holds the same stable value as Event.Reason.
+func (mw *GinJWTMiddleware) problemResponse(c *gin.Context, code int, message string) {
+	reason := ReasonInvalid
+	if authErr := ExtractAuthError(c); authErr != nil {
+		reason = authErr.Kind
+	}
+
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(code, gin.H{
+		"type":     "about:blank",
+		"title":    http.StatusText(code),
+		"status":   code,
+		"detail":   message,
+		keyCode:    reason,
+		"instance": c.Request.URL.Path,
+	})
+}
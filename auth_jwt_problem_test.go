@@ -0,0 +1,150 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestBearerError(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected string
+	}{
+		{ErrEmptyAuthHeader, ""},
+		{ErrMissingRefreshToken, ""},
+		{ErrFailedAuthentication, ""},
+		{ErrMissingLoginValues, ""},
+		{ErrLoginLocked, ""},
+		{ErrFailedTokenCreation, ""},
+		{ErrInvalidAuthHeader, BearerErrorInvalidRequest},
+		{ErrExpiredToken, BearerErrorInvalidToken},
+		{ErrMissingExpField, BearerErrorInvalidToken},
+		{ErrInvalidSigningAlgorithm, BearerErrorInvalidToken},
+		{ErrMFAPendingToken, BearerErrorInvalidToken},
+		{ErrInvalidRefreshToken, BearerErrorInvalidToken},
+		{errors.New("unknown"), BearerErrorInvalidToken},
+		{ErrForbidden, BearerErrorInsufficientScope},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			assert.Equal(t, tc.expected, bearerError(newAuthError(PhaseParse, 0, tc.err)))
+		})
+	}
+}
+
+func TestBearerErrorDescription(t *testing.T) {
+	err := fmt.Errorf("%w: bad \"quoted\" \\ value\n with ü", ErrExpiredToken)
+	assert.Equal(t, "token is expired: bad quoted  value with ",
+		bearerErrorDescription(newAuthError(PhaseParse, http.StatusUnauthorized, err)))
+
+	// Unknown and server errors may hold internal details
+	err = errors.New("failed to get token from Redis: dial tcp 10.0.0.1:6379")
+	assert.Equal(t, defaultBearerErrorDescription,
+		bearerErrorDescription(newAuthError(PhaseRefresh, http.StatusUnauthorized, err)))
+	err = fmt.Errorf("%w: connection refused", ErrRevocationCheckFailed)
+	assert.Equal(t, defaultBearerErrorDescription,
+		bearerErrorDescription(newAuthError(PhaseParse, http.StatusInternalServerError, err)))
+}
+
+func TestWWWAuthenticateErrorAttributes(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: defaultAuthenticator,
+		Authorizer: func(c *gin.Context, data any) bool {
+			return data == testAdmin
+		},
+	})
+	require.NoError(t, err)
+
+	handler := ginHandler(authMiddleware)
+
+	gofight.New().GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + makeTokenString("HS256", testUser)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusForbidden, r.Code)
+			assert.Equal(
+				t,
+				`Bearer realm="test zone", error="insufficient_scope", `+
+					`error_description="you don't have permission to access this resource"`,
+				r.HeaderMap.Get("WWW-Authenticate"), //nolint:staticcheck
+			)
+		})
+
+	gofight.New().POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": "wrong"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			//nolint:staticcheck
+			assert.Equal(t, `Bearer realm="test zone"`, r.HeaderMap.Get("WWW-Authenticate"))
+		})
+}
+
+func TestProblemDetailsResponse(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:          "test zone",
+		Key:            key,
+		Authenticator:  defaultAuthenticator,
+		ProblemDetails: true,
+	})
+	require.NoError(t, err)
+
+	handler := ginHandler(authMiddleware)
+
+	gofight.New().GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer invalid"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			//nolint:staticcheck
+			assert.Equal(t, ProblemContentType, r.HeaderMap.Get("Content-Type"))
+
+			body := r.Body.String()
+			assert.Equal(t, "about:blank", gjson.Get(body, "type").String())
+			assert.Equal(t, "Unauthorized", gjson.Get(body, "title").String())
+			assert.Equal(t, int64(http.StatusUnauthorized), gjson.Get(body, "status").Int())
+			assert.Equal(t, ReasonMalformed, gjson.Get(body, "code").String())
+			assert.Equal(t, "/auth/hello", gjson.Get(body, "instance").String())
+			assert.Contains(t, gjson.Get(body, "detail").String(), "token is malformed")
+		})
+
+	gofight.New().GET("/auth/hello").
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ReasonMissingToken, gjson.Get(r.Body.String(), "code").String())
+		})
+
+	gofight.New().POST("/refresh").
+		SetJSON(gofight.D{"refresh_token": "unknown"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ReasonInvalidRefreshToken, gjson.Get(r.Body.String(), "code").String())
+		})
+}
+
+func TestProblemDetailsIgnoredWithCustomUnauthorized(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:          "test zone",
+		Key:            key,
+		Authenticator:  defaultAuthenticator,
+		ProblemDetails: true,
+		Unauthorized: func(c *gin.Context, code int, message string) {
+			c.String(code, message)
+		},
+	})
+	require.NoError(t, err)
+
+	gofight.New().GET("/auth/hello").
+		Run(ginHandler(authMiddleware), func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Equal(t, ErrEmptyAuthHeader.Error(), r.Body.String())
+		})
+}
@@ -2,7 +2,7 @@ package jwt
 
 import (
 	"crypto/tls"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/appleboy/gin-jwt/v3/store"
@@ -57,6 +57,13 @@ func WithRedisTLS(tlsConfig *tls.Config) RedisOption {
 	}
 }
 
+// WithRedisLogger sets the logger used by the Redis store
+func WithRedisLogger(logger *slog.Logger) RedisOption {
+	return func(config *store.RedisConfig) {
+		config.Logger = logger
+	}
+}
+
 // EnableRedisStore enables Redis store with optional configuration
 func (mw *GinJWTMiddleware) EnableRedisStore(opts ...RedisOption) *GinJWTMiddleware {
 	mw.UseRedisStore = true
@@ -83,13 +90,27 @@ func (mw *GinJWTMiddleware) initializeRedisStore() {
 			redisConfig = store.DefaultRedisConfig()
 		}
 
+		if redisConfig.Logger == nil {
+			// Share the middleware logger without modifying the caller's config
+			configCopy := *redisConfig
+			configCopy.Logger = mw.Logger
+			redisConfig = &configCopy
+		}
+
 		redisStore, err := store.NewRedisRefreshTokenStore(redisConfig)
 		if err != nil {
 			// Fallback to in-memory store
-			log.Printf("Failed to connect to Redis: %v, falling back to in-memory store", err)
+			mw.logger().Warn("failed to connect to Redis, falling back to in-memory store",
+				logKeyStore, string(store.RedisStore),
+				logKeyErrorKind, errorKindRedis,
+				logKeyError, err,
+			)
 			mw.RefreshTokenStore = mw.inMemoryStore
+			mw.emitBackground(EventStoreFallback, err)
 		} else {
-			log.Println("Successfully connected to Redis store with client-side cache enabled")
+			mw.logger().Info("connected to Redis store with client-side cache enabled",
+				logKeyStore, string(store.RedisStore),
+			)
 			mw.RefreshTokenStore = redisStore
 		}
 	}
@@ -0,0 +1,138 @@
+package jwt
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRememberMeField is the default login parameter asking for a long-lived refresh token
+const DefaultRememberMeField = "remember_me"
+
+// defaultSessionRefreshTimeout is the stored lifetime of browser-session refresh tokens
+const defaultSessionRefreshTimeout = 24 * time.Hour
+
+const (
+	claimRememberMe         = "remember_me"
+	rememberMeContextKey    = "JWT_REMEMBER_ME"
+	refreshPolicyContextKey = "JWT_REFRESH_POLICY"
+)
+
+// refreshPolicy is the lifetime chosen at login for a refresh token and its successors.
+type refreshPolicy struct {
+	timeout time.Duration
+	// sessionCookie keeps the refresh token in a cookie without Max-Age, which the
+	// browser drops when it is closed
+	sessionCookie bool
+}
+
+type refreshPolicyKey struct{}
+
+// withRefreshPolicy returns ctx carrying the policy of the refresh token to issue.
+func withRefreshPolicy(ctx context.Context, p refreshPolicy) context.Context {
+	return context.WithValue(ctx, refreshPolicyKey{}, p)
+}
+
+// refreshPolicyFromContext returns the policy set by withRefreshPolicy,
+// or RefreshTokenTimeout with a persistent cookie.
+func (mw *GinJWTMiddleware) refreshPolicyFromContext(ctx context.Context) refreshPolicy {
+	if p, ok := ctx.Value(refreshPolicyKey{}).(refreshPolicy); ok && p.timeout > 0 {
+		return p
+	}
+	return refreshPolicy{timeout: mw.RefreshTokenTimeout}
+}
+
+// initializeRememberMe sets the refresh token lifetime defaults.
+func (mw *GinJWTMiddleware) initializeRememberMe() {
+	if mw.RefreshTimeoutFunc == nil {
+		mw.RefreshTimeoutFunc = func(c *gin.Context, data any) time.Duration {
+			return mw.RefreshTokenTimeout
+		}
+	}
+
+	if !mw.EnableRememberMe {
+		return
+	}
+	if mw.RememberMeField == "" {
+		mw.RememberMeField = DefaultRememberMeField
+	}
+	if mw.SessionRefreshTimeout <= 0 {
+		mw.SessionRefreshTimeout = defaultSessionRefreshTimeout
+	}
+}
+
+// readRememberMe records whether the login request of c asks to be remembered.
+// It must run before Authenticator, which consumes the request body.
+func (mw *GinJWTMiddleware) readRememberMe(c *gin.Context) {
+	if !mw.EnableRememberMe {
+		return
+	}
+
+	value := loginField(c, mw.RememberMeField)
+	remember, _ := strconv.ParseBool(value)
+	c.Set(rememberMeContextKey, remember || value == "on")
+}
+
+// rememberMe reports whether the login of c asked for a long-lived refresh token.
+func rememberMe(c *gin.Context) bool {
+	return c.GetBool(rememberMeContextKey)
+}
+
+// loginRefreshPolicy chooses the refresh token lifetime of a login: RefreshTimeoutFunc, or
+// with EnableRememberMe and no remember me flag, a browser session.
+func (mw *GinJWTMiddleware) loginRefreshPolicy(c *gin.Context, data any) refreshPolicy {
+	if mw.EnableRememberMe && !rememberMe(c) {
+		return refreshPolicy{timeout: mw.SessionRefreshTimeout, sessionCookie: true}
+	}
+	return refreshPolicy{timeout: mw.RefreshTimeoutFunc(c, data)}
+}
+
+// storedRefreshPolicy returns the policy a refresh token was issued with, so that the token
+// replacing it keeps it. Stores that do not keep it fall back to RefreshTimeoutFunc.
+func (mw *GinJWTMiddleware) storedRefreshPolicy(
+	c *gin.Context,
+	data *core.RefreshTokenData,
+) refreshPolicy {
+	if data.Timeout > 0 {
+		return refreshPolicy{timeout: data.Timeout, sessionCookie: data.SessionCookie}
+	}
+	return refreshPolicy{timeout: mw.RefreshTimeoutFunc(c, data.UserData)}
+}
+
+// refreshContext returns ctx carrying the session, policy and metadata of the refresh token
+// being exchanged, for the token replacing it. The policy is also set on c for its cookie.
+func (mw *GinJWTMiddleware) refreshContext(
+	ctx context.Context,
+	c *gin.Context,
+	data *core.RefreshTokenData,
+) context.Context {
+	policy := mw.storedRefreshPolicy(c, data)
+	c.Set(refreshPolicyContextKey, policy)
+	ctx = withSessionMetadata(ctx, mw.sessionMetadata(c, data.Metadata))
+	return withRefreshPolicy(withReplacedToken(ctx, data), policy)
+}
+
+// refreshCookieExpiry returns when the cookie of refreshToken expires, and whether it is a
+// browser-session cookie. The policy comes from c when the token was issued for it, from
+// the store otherwise.
+func (mw *GinJWTMiddleware) refreshCookieExpiry(
+	c *gin.Context,
+	refreshToken string,
+	now time.Time,
+) (time.Time, bool) {
+	if p, ok := c.Get(refreshPolicyContextKey); ok {
+		policy := p.(refreshPolicy)
+		return mw.refreshTokenExpiry(now, policy.timeout), policy.sessionCookie
+	}
+
+	if store, ok := mw.dataStore(); ok && c.Request != nil && refreshToken != "" {
+		data, err := mw.storeGetData(c.Request.Context(), store, refreshToken)
+		if err == nil {
+			return data.Expiry, data.SessionCookie
+		}
+	}
+	return mw.refreshTokenExpiry(now, mw.RefreshTokenTimeout), false
+}
@@ -0,0 +1,157 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/store"
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newRememberMeMiddleware(
+	t *testing.T,
+	tokenStore *store.InMemoryRefreshTokenStore,
+) *GinJWTMiddleware {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:                 "test zone",
+		Key:                   key,
+		Timeout:               time.Hour,
+		Authenticator:         validAuthenticator,
+		SendCookie:            true,
+		RefreshTokenStore:     tokenStore,
+		EnableRememberMe:      true,
+		SessionRefreshTimeout: 2 * time.Hour,
+	})
+	require.NoError(t, err)
+	return authMiddleware
+}
+
+// refreshTokenCookie returns the refresh token and the Max-Age of its cookie.
+func refreshTokenCookie(t *testing.T, r gofight.HTTPResponse) (string, int) {
+	t.Helper()
+
+	require.Equal(t, http.StatusOK, r.Code)
+	cookie := findCookie(r, defaultRefreshTokenName)
+	require.NotNil(t, cookie)
+	return gjson.Get(r.Body.String(), "refresh_token").String(), cookie.MaxAge
+}
+
+func TestRememberMe(t *testing.T) {
+	tokenStore := store.NewInMemoryRefreshTokenStore()
+	handler := ginHandler(newRememberMeMiddleware(t, tokenStore))
+	ctx := context.Background()
+
+	// Without the flag, the refresh token lives in a browser-session cookie
+	gofight.New().POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": testPassword}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			refreshToken, maxAge := refreshTokenCookie(t, r)
+			assert.Equal(t, 0, maxAge)
+
+			data, err := tokenStore.GetData(ctx, refreshToken)
+			require.NoError(t, err)
+			assert.True(t, data.SessionCookie)
+			assert.WithinDuration(t, time.Now().Add(2*time.Hour), data.Expiry, time.Minute)
+		})
+
+	// With it, the refresh token is kept for RefreshTokenTimeout
+	gofight.New().POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": testPassword, "remember_me": true}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			refreshToken, maxAge := refreshTokenCookie(t, r)
+			assert.Equal(t, int((30 * 24 * time.Hour).Seconds()), maxAge)
+
+			data, err := tokenStore.GetData(ctx, refreshToken)
+			require.NoError(t, err)
+			assert.False(t, data.SessionCookie)
+		})
+
+	// A checked checkbox of a form
+	gofight.New().POST("/login").
+		SetForm(gofight.H{"username": testAdmin, "password": testPassword, "remember_me": "on"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			_, maxAge := refreshTokenCookie(t, r)
+			assert.Positive(t, maxAge)
+		})
+}
+
+func TestRememberMeKeptOnRefresh(t *testing.T) {
+	tokenStore := store.NewInMemoryRefreshTokenStore()
+	handler := ginHandler(newRememberMeMiddleware(t, tokenStore))
+
+	refreshToken, _ := refreshTokenCookie(t, testLogin(t, handler, testAdmin, nil))
+
+	gofight.New().POST("/refresh").
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			newRefreshToken, maxAge := refreshTokenCookie(t, r)
+			assert.Equal(t, 0, maxAge, "the browser session policy is kept")
+
+			data, err := tokenStore.GetData(context.Background(), newRefreshToken)
+			require.NoError(t, err)
+			assert.True(t, data.SessionCookie)
+			assert.Equal(t, 2*time.Hour, data.Timeout)
+		})
+}
+
+func TestRememberMeWithMFA(t *testing.T) {
+	now := time.Now()
+	authMiddleware := newMFAMiddleware(t, func() time.Time { return now })
+	authMiddleware.SendCookie = true
+	authMiddleware.EnableRememberMe = true
+	require.NoError(t, authMiddleware.MiddlewareInit())
+	handler := mfaHandler(authMiddleware)
+
+	var mfaToken string
+	gofight.New().POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": testPassword, "remember_me": "true"}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			mfaToken = gjson.Get(r.Body.String(), "mfa_token").String()
+		})
+	require.NotEmpty(t, mfaToken)
+
+	gofight.New().POST("/login/mfa").
+		SetJSON(gofight.D{
+			"mfa_token": mfaToken,
+			"code":      GenerateTOTP(totpTestSecret, now, 6, 30*time.Second, ""),
+		}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			_, maxAge := refreshTokenCookie(t, r)
+			assert.Positive(t, maxAge, "the flag of the first factor is kept")
+		})
+}
+
+func TestRefreshTimeoutFunc(t *testing.T) {
+	tokenStore := store.NewInMemoryRefreshTokenStore()
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:             "test zone",
+		Key:               key,
+		Timeout:           time.Hour,
+		Authenticator:     validAuthenticator,
+		SendCookie:        true,
+		RefreshTokenStore: tokenStore,
+		RefreshTimeoutFunc: func(c *gin.Context, data any) time.Duration {
+			if data == testAdmin {
+				return 3 * time.Hour
+			}
+			return time.Hour
+		},
+	})
+	require.NoError(t, err)
+	handler := ginHandler(authMiddleware)
+
+	refreshToken, maxAge := refreshTokenCookie(t, testLogin(t, handler, testAdmin, nil))
+	assert.Equal(t, int((3 * time.Hour).Seconds()), maxAge)
+
+	data, err := tokenStore.GetData(context.Background(), refreshToken)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(3*time.Hour), data.Expiry, time.Minute)
+}
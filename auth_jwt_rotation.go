@@ -0,0 +1,130 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/gin-gonic/gin"
+)
+
+// rotationStore returns RefreshTokenStore as a core.RotationStore when a grace period is set.
+func (mw *GinJWTMiddleware) rotationStore() (core.RotationStore, bool) {
+	if mw.RefreshTokenGracePeriod <= 0 {
+		return nil, false
+	}
+	rotation, ok := mw.RefreshTokenStore.(core.RotationStore)
+	return rotation, ok
+}
+
+// initializeRotation checks that RefreshTokenStore can keep rotated tokens.
+func (mw *GinJWTMiddleware) initializeRotation() error {
+	if mw.RefreshTokenGracePeriod <= 0 {
+		return nil
+	}
+	if _, ok := mw.rotationStore(); !ok {
+		return ErrRotationNotSupported
+	}
+	return nil
+}
+
+// rotateRefreshToken keeps oldRefreshToken pointing to tokenPair for RefreshTokenGracePeriod
+// instead of deleting it.
+func (mw *GinJWTMiddleware) rotateRefreshToken(
+	ctx context.Context,
+	rotation core.RotationStore,
+	oldRefreshToken string,
+	tokenPair *core.Token,
+) error {
+	if err := mw.deleteDPoPBinding(ctx, oldRefreshToken); err != nil {
+		return err
+	}
+
+	graceExpiry := mw.TimeFunc().Add(mw.RefreshTokenGracePeriod)
+	return rotation.Rotate(ctx, oldRefreshToken, tokenPair, graceExpiry)
+}
+
+// rotatedTokenPair returns the token pair a refresh token was rotated to within the grace
+// period, or nil. DPoP-bound pairs are never handed out again, as the proof cannot be checked,
+// and neither are pairs bound to a fingerprint, as only its hash is kept.
+func (mw *GinJWTMiddleware) rotatedTokenPair(ctx context.Context, refreshToken string) *core.Token {
+	rotation, ok := mw.rotationStore()
+	if !ok || mw.EnableFingerprint {
+		return nil
+	}
+
+	tokenPair, err := rotation.Rotated(ctx, refreshToken)
+	if err != nil || tokenPair.TokenType == dpopScheme {
+		return nil
+	}
+	return tokenPair
+}
+
+// exchangeRefreshToken redeems oldRefreshToken for a new token pair. The exchange succeeds
+// once per refresh token, even for concurrent requests, when RefreshTokenStore implements
+// core.RotationStore (with a grace period) or core.ConsumeStore. replayed reports that the
+// token was rotated by a concurrent request within the grace period, and tokenPair is the pair
+// that request got.
+func (mw *GinJWTMiddleware) exchangeRefreshToken(
+	ctx context.Context,
+	data any,
+	oldRefreshToken string,
+) (tokenPair *core.Token, replayed bool, err error) {
+	if rotation, ok := mw.rotationStore(); ok {
+		tokenPair, err = mw.TokenGenerator(ctx, data)
+		if err != nil {
+			return nil, false, err
+		}
+
+		err = mw.rotateRefreshToken(ctx, rotation, oldRefreshToken, tokenPair)
+		if !errors.Is(err, core.ErrRefreshTokenNotFound) {
+			return tokenPair, false, err
+		}
+
+		// Another request rotated the token first, discard this pair
+		if err := mw.revokeRefreshToken(ctx, tokenPair.RefreshToken); err != nil {
+			mw.logger().Warn("failed to revoke discarded refresh token", logKeyError, err)
+		}
+		if successor := mw.rotatedTokenPair(ctx, oldRefreshToken); successor != nil {
+			return successor, true, nil
+		}
+		return nil, false, ErrInvalidRefreshToken
+	}
+
+	if consumer, ok := mw.RefreshTokenStore.(core.ConsumeStore); ok {
+		// Generate first, so that a failure leaves the old refresh token usable
+		tokenPair, err = mw.TokenGenerator(ctx, data)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if _, err := mw.storeConsume(ctx, consumer, oldRefreshToken); err != nil {
+			// Another request redeemed the token first, discard this pair
+			if err := mw.revokeRefreshToken(ctx, tokenPair.RefreshToken); err != nil {
+				mw.logger().Warn("failed to revoke discarded refresh token", logKeyError, err)
+			}
+			if errors.Is(err, core.ErrRefreshTokenNotFound) {
+				err = ErrInvalidRefreshToken
+			}
+			return nil, false, err
+		}
+		if err := mw.deleteDPoPBinding(ctx, oldRefreshToken); err != nil {
+			return nil, false, err
+		}
+		return tokenPair, false, nil
+	}
+
+	tokenPair, err = mw.TokenGeneratorWithRevocation(ctx, data, oldRefreshToken)
+	return tokenPair, false, err
+}
+
+// replayRotation answers a repeated refresh with the token pair of the first one.
+func (mw *GinJWTMiddleware) replayRotation(c *gin.Context, tokenPair *core.Token) {
+	mw.emit(c, EventRefreshSuccess, nil, nil)
+	mw.countOutcome(MetricRefreshes, OutcomeSuccess, nil)
+
+	mw.SetCookie(c, tokenPair.AccessToken)
+	mw.SetRefreshTokenCookie(c, tokenPair.RefreshToken)
+
+	mw.RefreshResponse(c, tokenPair)
+}
@@ -0,0 +1,190 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newRotationHandler(t *testing.T, gracePeriod time.Duration) *gin.Engine {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:                   "test zone",
+		Key:                     key,
+		Timeout:                 time.Hour,
+		Authenticator:           validAuthenticator,
+		RefreshTokenGracePeriod: gracePeriod,
+	})
+	require.NoError(t, err)
+	return ginHandler(authMiddleware)
+}
+
+// rotationRefresh calls RefreshHandler and returns the status and the new token pair.
+func rotationRefresh(handler *gin.Engine, refreshToken string) (int, string, string) {
+	var code int
+	var accessToken, newRefreshToken string
+	gofight.New().POST("/refresh").
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			code = r.Code
+			accessToken = gjson.Get(r.Body.String(), "access_token").String()
+			newRefreshToken = gjson.Get(r.Body.String(), "refresh_token").String()
+		})
+	return code, accessToken, newRefreshToken
+}
+
+func TestRefreshTokenGracePeriod(t *testing.T) {
+	handler := newRotationHandler(t, time.Minute)
+	_, refreshToken := loginTokens(t, handler, testAdmin, nil)
+
+	code, accessToken, newRefreshToken := rotationRefresh(handler, refreshToken)
+	require.Equal(t, http.StatusOK, code)
+	require.NotEqual(t, refreshToken, newRefreshToken)
+
+	// A concurrent refresh with the same token gets the same pair
+	code, repeatedAccessToken, repeatedRefreshToken := rotationRefresh(handler, refreshToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, accessToken, repeatedAccessToken)
+	assert.Equal(t, newRefreshToken, repeatedRefreshToken)
+
+	// The successor is a regular refresh token
+	code, _, nextRefreshToken := rotationRefresh(handler, newRefreshToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEqual(t, newRefreshToken, nextRefreshToken)
+}
+
+func TestRefreshTokenGracePeriodExpired(t *testing.T) {
+	handler := newRotationHandler(t, 50*time.Millisecond)
+	_, refreshToken := loginTokens(t, handler, testAdmin, nil)
+
+	code, _, _ := rotationRefresh(handler, refreshToken)
+	require.Equal(t, http.StatusOK, code)
+
+	time.Sleep(100 * time.Millisecond)
+	code, _, _ = rotationRefresh(handler, refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestRefreshTokenWithoutGracePeriod(t *testing.T) {
+	handler := newRotationHandler(t, 0)
+	_, refreshToken := loginTokens(t, handler, testAdmin, nil)
+
+	code, _, _ := rotationRefresh(handler, refreshToken)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _, _ = rotationRefresh(handler, refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestRefreshTokenRedeemedOnce(t *testing.T) {
+	handler := newRotationHandler(t, 0)
+	_, refreshToken := loginTokens(t, handler, testAdmin, nil)
+
+	const requests = 10
+	codes := make([]int, requests)
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Go(func() {
+			codes[i], _, _ = rotationRefresh(handler, refreshToken)
+		})
+	}
+	wg.Wait()
+
+	var succeeded int
+	for _, code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+		} else {
+			assert.Equal(t, http.StatusUnauthorized, code)
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+}
+
+func TestRefreshTokenKeptOnGeneratorError(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: validAuthenticator,
+	})
+	require.NoError(t, err)
+	handler := ginHandler(authMiddleware)
+	_, refreshToken := loginTokens(t, handler, testAdmin, nil)
+
+	// The new pair cannot be signed: the old refresh token must survive
+	authMiddleware.SigningAlgorithm = "none-such"
+	code, _, _ := rotationRefresh(handler, refreshToken)
+	assert.Equal(t, http.StatusInternalServerError, code)
+
+	authMiddleware.SigningAlgorithm = "HS256"
+	code, _, newRefreshToken := rotationRefresh(handler, refreshToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, newRefreshToken)
+}
+
+func TestRefreshTokenGracePeriodConcurrent(t *testing.T) {
+	handler := newRotationHandler(t, time.Minute)
+	_, refreshToken := loginTokens(t, handler, testAdmin, nil)
+
+	const requests = 10
+	refreshTokens := make([]string, requests)
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Go(func() {
+			var code int
+			code, _, refreshTokens[i] = rotationRefresh(handler, refreshToken)
+			assert.Equal(t, http.StatusOK, code)
+		})
+	}
+	wg.Wait()
+
+	for _, newRefreshToken := range refreshTokens {
+		assert.Equal(t, refreshTokens[0], newRefreshToken)
+	}
+}
+
+// plainTokenStore hides the optional store extensions of the in-memory store
+type plainTokenStore struct {
+	core.TokenStore
+}
+
+func TestRefreshTokenGracePeriodRequiresRotationStore(t *testing.T) {
+	_, err := New(&GinJWTMiddleware{
+		Realm:                   "test zone",
+		Key:                     key,
+		Authenticator:           validAuthenticator,
+		RefreshTokenGracePeriod: time.Minute,
+		RefreshTokenStore:       plainTokenStore{},
+	})
+	assert.ErrorIs(t, err, ErrRotationNotSupported)
+}
+
+func TestRotatedTokenPairSkipsDPoP(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:                   "test zone",
+		Key:                     key,
+		Authenticator:           validAuthenticator,
+		RefreshTokenGracePeriod: time.Minute,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	rotation := authMiddleware.RefreshTokenStore.(core.RotationStore)
+	require.NoError(t, authMiddleware.RefreshTokenStore.Set(ctx, "bound", testAdmin,
+		time.Now().Add(time.Hour)))
+	require.NoError(t, rotation.Rotate(ctx, "bound", &core.Token{TokenType: dpopScheme},
+		time.Now().Add(time.Minute)))
+
+	assert.Nil(t, authMiddleware.rotatedTokenPair(ctx, "bound"))
+}
@@ -0,0 +1,286 @@
+package jwt
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// SessionIDParam is the route parameter of RevokeSessionHandler and
+	// AdminRevokeSessionHandler holding the session to revoke, e.g. /sessions/:session_id
+	SessionIDParam = "session_id"
+	// SubjectParam is the route parameter of the admin session handlers holding the user
+	// they act on, e.g. /admin/users/:subject/sessions
+	SubjectParam = "subject"
+)
+
+// SessionInfo describes a session in the replies of the session handlers. ID is the opaque
+// session ID: refresh tokens are never exposed.
+type SessionInfo struct {
+	ID string `json:"id"`
+	// Current is set on the session of the access token of the request
+	Current bool `json:"current"`
+	// CreatedAt is the time of the login that started the session
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is the expiry of the current refresh token of the session
+	ExpiresAt time.Time             `json:"expires_at"`
+	Metadata  *core.SessionMetadata `json:"metadata,omitempty"`
+}
+
+// initializeSessionHandlers sets the default replies of the session handlers, and checks
+// that RefreshTokenStore indexes sessions when EnableSessionHandlers is set.
+func (mw *GinJWTMiddleware) initializeSessionHandlers() error {
+	if mw.SessionsResponse == nil {
+		mw.SessionsResponse = func(c *gin.Context, sessions []SessionInfo) {
+			c.JSON(http.StatusOK, gin.H{
+				keyCode:    http.StatusOK,
+				"sessions": sessions,
+			})
+		}
+	}
+
+	if mw.SessionsRevokedResponse == nil {
+		mw.SessionsRevokedResponse = func(c *gin.Context, sessionIDs []string) {
+			c.JSON(http.StatusOK, gin.H{
+				keyCode:   http.StatusOK,
+				"revoked": sessionIDs,
+			})
+		}
+	}
+
+	if !mw.EnableSessionHandlers {
+		return nil
+	}
+	if _, ok := mw.sessionStore(); !ok {
+		return ErrSessionsNotSupported
+	}
+	return nil
+}
+
+// ListSessionsHandler replies with the sessions of the caller through SessionsResponse.
+// It must run behind MiddlewareFunc: the caller is SubjectFunc of IdentityHandler.
+func (mw *GinJWTMiddleware) ListSessionsHandler(c *gin.Context) {
+	subject, ok := mw.callerSubject(c)
+	if !ok {
+		return
+	}
+	mw.listSessions(c, subject)
+}
+
+// RevokeSessionHandler revokes the session of the caller named by the SessionIDParam route
+// parameter, and replies through SessionsRevokedResponse. It must run behind MiddlewareFunc.
+func (mw *GinJWTMiddleware) RevokeSessionHandler(c *gin.Context) {
+	subject, ok := mw.callerSubject(c)
+	if !ok {
+		return
+	}
+	mw.revokeSession(c, subject, c.Param(SessionIDParam))
+}
+
+// RevokeOtherSessionsHandler revokes every session of the caller but the one of its access
+// token, e.g. for a "log out other devices" button, and replies through
+// SessionsRevokedResponse. It must run behind MiddlewareFunc.
+func (mw *GinJWTMiddleware) RevokeOtherSessionsHandler(c *gin.Context) {
+	subject, ok := mw.callerSubject(c)
+	if !ok {
+		return
+	}
+
+	current := currentSessionID(c)
+	if current == "" {
+		mw.unauthorized(c, PhaseSessions, http.StatusBadRequest, ErrMissingSessionID)
+		return
+	}
+	revoked, ok := mw.revokeSessions(c, subject, func(sessionID string) bool {
+		return sessionID != current
+	})
+	if ok {
+		mw.SessionsRevokedResponse(c, revoked)
+	}
+}
+
+// AdminListSessionsHandler replies with the sessions of the user named by the SubjectParam
+// route parameter. The caller must be allowed by SessionAdminAuthorizer.
+func (mw *GinJWTMiddleware) AdminListSessionsHandler(c *gin.Context) {
+	subject, ok := mw.subjectParam(c)
+	if !ok || !mw.authorizeSessionAdmin(c) {
+		return
+	}
+	mw.listSessions(c, subject)
+}
+
+// AdminRevokeSessionHandler revokes the session named by the SessionIDParam route parameter
+// of the user named by the SubjectParam one. The caller must be allowed by
+// SessionAdminAuthorizer.
+func (mw *GinJWTMiddleware) AdminRevokeSessionHandler(c *gin.Context) {
+	subject, ok := mw.subjectParam(c)
+	if !ok || !mw.authorizeSessionAdmin(c) {
+		return
+	}
+	mw.revokeSession(c, subject, c.Param(SessionIDParam))
+}
+
+// AdminRevokeSessionsHandler revokes every session of the user named by the SubjectParam
+// route parameter. The caller must be allowed by SessionAdminAuthorizer.
+func (mw *GinJWTMiddleware) AdminRevokeSessionsHandler(c *gin.Context) {
+	subject, ok := mw.subjectParam(c)
+	if !ok || !mw.authorizeSessionAdmin(c) {
+		return
+	}
+	revoked, ok := mw.revokeSessions(c, subject, func(string) bool {
+		return true
+	})
+	if ok {
+		mw.SessionsRevokedResponse(c, revoked)
+	}
+}
+
+// subjectParam returns the SubjectParam route parameter of the admin handlers, or replies
+// 400 with ErrMissingSubject when it is empty, e.g. for /admin/users//sessions.
+func (mw *GinJWTMiddleware) subjectParam(c *gin.Context) (string, bool) {
+	subject := c.Param(SubjectParam)
+	if subject == "" {
+		mw.unauthorized(c, PhaseSessions, http.StatusBadRequest, ErrMissingSubject)
+		return "", false
+	}
+	return subject, true
+}
+
+// currentSessionID returns the session of the access token of c, set by MiddlewareFunc.
+func currentSessionID(c *gin.Context) string {
+	sessionID, _ := ExtractClaims(c)[claimSessionID].(string)
+	return sessionID
+}
+
+// callerSubject returns the user of the access token of c, or replies with ErrForbidden.
+func (mw *GinJWTMiddleware) callerSubject(c *gin.Context) (string, bool) {
+	subject := mw.SubjectFunc(mw.IdentityHandler(c))
+	if subject == "" {
+		mw.unauthorized(c, PhaseSessions, http.StatusForbidden, ErrForbidden)
+		return "", false
+	}
+	return subject, true
+}
+
+// authorizeSessionAdmin reports whether SessionAdminAuthorizer allows the caller of an admin
+// session handler, and replies with ErrForbidden otherwise.
+func (mw *GinJWTMiddleware) authorizeSessionAdmin(c *gin.Context) bool {
+	identity := mw.IdentityHandler(c)
+	if identity == nil || mw.SessionAdminAuthorizer == nil ||
+		!mw.SessionAdminAuthorizer(c, identity) {
+		mw.emit(c, EventAuthorizationDenied, identity, ErrForbidden)
+		mw.unauthorized(c, PhaseSessions, http.StatusForbidden, ErrForbidden)
+		return false
+	}
+	return true
+}
+
+// subjectSessions returns the live sessions of subject, or replies with an error.
+func (mw *GinJWTMiddleware) subjectSessions(c *gin.Context, subject string) ([]core.Session, bool) {
+	store, ok := mw.sessionStore()
+	if !mw.EnableSessionHandlers || !ok {
+		mw.unauthorized(c, PhaseSessions, http.StatusNotImplemented, ErrSessionsNotSupported)
+		return nil, false
+	}
+
+	sessions, err := mw.storeSessions(c.Request.Context(), store, subject)
+	if err != nil {
+		mw.sessionStoreFailed(c, err)
+		return nil, false
+	}
+	return sessions, true
+}
+
+// sessionStoreFailed logs a store error of a session handler and replies with
+// ErrFailedSessionOperation.
+func (mw *GinJWTMiddleware) sessionStoreFailed(c *gin.Context, err error) {
+	mw.logger().Warn("failed to access sessions",
+		logKeyStore, storeType(mw.RefreshTokenStore),
+		logKeyErrorKind, errorKindStore,
+		logKeyError, err,
+	)
+	mw.unauthorized(c, PhaseSessions, http.StatusInternalServerError, ErrFailedSessionOperation)
+}
+
+// listSessions replies with the sessions of subject, oldest first.
+func (mw *GinJWTMiddleware) listSessions(c *gin.Context, subject string) {
+	sessions, ok := mw.subjectSessions(c, subject)
+	if !ok {
+		return
+	}
+
+	current := currentSessionID(c)
+	infos := make([]SessionInfo, 0, len(sessions))
+	seen := make(map[string]bool, len(sessions))
+	for _, session := range sessions {
+		data := session.Data
+		if data.SessionID == "" || seen[data.SessionID] {
+			continue
+		}
+		seen[data.SessionID] = true
+		infos = append(infos, SessionInfo{
+			ID:        data.SessionID,
+			Current:   data.SessionID == current,
+			CreatedAt: data.SessionStart,
+			ExpiresAt: data.Expiry,
+			Metadata:  data.Metadata,
+		})
+	}
+	mw.SessionsResponse(c, infos)
+}
+
+// revokeSession revokes the session sessionID of subject, or replies with ErrSessionNotFound.
+func (mw *GinJWTMiddleware) revokeSession(c *gin.Context, subject, sessionID string) {
+	revoked, ok := mw.revokeSessions(c, subject, func(id string) bool {
+		return id == sessionID
+	})
+	if !ok {
+		return
+	}
+	if len(revoked) == 0 {
+		mw.unauthorized(c, PhaseSessions, http.StatusNotFound, ErrSessionNotFound)
+		return
+	}
+	mw.SessionsRevokedResponse(c, revoked)
+}
+
+// revokeSessions revokes the sessions of subject whose ID match selects, emits an
+// EventSessionRevoked event for each of them, and returns their IDs.
+// It replies with an error and returns false when the store fails.
+func (mw *GinJWTMiddleware) revokeSessions(
+	c *gin.Context,
+	subject string,
+	selects func(sessionID string) bool,
+) ([]string, bool) {
+	sessions, ok := mw.subjectSessions(c, subject)
+	if !ok {
+		return nil, false
+	}
+
+	ctx := c.Request.Context()
+	revoked := []string{}
+	seen := make(map[string]bool, len(sessions))
+	for _, session := range sessions {
+		data := session.Data
+		if data.SessionID == "" || !selects(data.SessionID) {
+			continue
+		}
+		if err := mw.revokeRefreshToken(ctx, session.Token); err != nil {
+			mw.sessionStoreFailed(c, err)
+			return nil, false
+		}
+		if !seen[data.SessionID] {
+			if err := mw.revokeSessionAccess(ctx, data); err != nil {
+				mw.sessionStoreFailed(c, err)
+				return nil, false
+			}
+			seen[data.SessionID] = true
+			revoked = append(revoked, data.SessionID)
+			mw.emitSession(c, EventSessionRevoked, data.UserData, data.SessionID)
+		}
+	}
+	return revoked, true
+}
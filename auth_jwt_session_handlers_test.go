@@ -0,0 +1,255 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/store"
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newSessionHandler(t *testing.T, events *[]*Event) *gin.Engine {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: testUserAuthenticator,
+		PayloadFunc: func(data any) jwt.MapClaims {
+			return jwt.MapClaims{IdentityKey: data}
+		},
+		EnableSessionMetadata: true,
+		EnableSessionHandlers: true,
+		SessionAdminAuthorizer: func(c *gin.Context, data any) bool {
+			return data == testAdmin
+		},
+		ProblemDetails: true,
+		EventHandler: EventHandlerFunc(func(ctx context.Context, event *Event) {
+			*events = append(*events, event)
+		}),
+	})
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.POST("/login", authMiddleware.LoginHandler)
+	r.POST("/refresh", authMiddleware.RefreshHandler)
+	auth := r.Group("/auth", authMiddleware.MiddlewareFunc())
+	auth.GET("/sessions", authMiddleware.ListSessionsHandler)
+	auth.DELETE("/sessions", authMiddleware.RevokeOtherSessionsHandler)
+	auth.DELETE("/sessions/:session_id", authMiddleware.RevokeSessionHandler)
+	admin := auth.Group("/admin/users/:subject/sessions")
+	admin.GET("", authMiddleware.AdminListSessionsHandler)
+	admin.DELETE("", authMiddleware.AdminRevokeSessionsHandler)
+	admin.DELETE("/:session_id", authMiddleware.AdminRevokeSessionHandler)
+	return r
+}
+
+// testUserAuthenticator accepts any username with testPassword.
+func testUserAuthenticator(c *gin.Context) (any, error) {
+	var loginVals Login
+	if err := c.ShouldBind(&loginVals); err != nil {
+		return "", ErrMissingLoginValues
+	}
+	if loginVals.Password != testPassword {
+		return nil, ErrFailedAuthentication
+	}
+	return loginVals.Username, nil
+}
+
+// deviceHeader names the device of a login in the session metadata.
+func deviceHeader(name string) gofight.H {
+	return gofight.H{DefaultDeviceNameHeader: name}
+}
+
+// sessionRequest calls a session handler and returns the status and body of the reply.
+func sessionRequest(handler *gin.Engine, method, path, accessToken string) (int, string) {
+	var code int
+	var body string
+	request := gofight.New()
+	switch method {
+	case http.MethodGet:
+		request.GET(path)
+	case http.MethodDelete:
+		request.DELETE(path)
+	}
+	request.
+		SetHeader(gofight.H{"Authorization": "Bearer " + accessToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			code = r.Code
+			body = r.Body.String()
+		})
+	return code, body
+}
+
+func TestListSessionsHandler(t *testing.T) {
+	var events []*Event
+	handler := newSessionHandler(t, &events)
+
+	laptop, refreshToken := loginTokens(t, handler, "alice", deviceHeader("Laptop"))
+	loginTokens(t, handler, "alice", deviceHeader("Phone"))
+	loginTokens(t, handler, "bob", deviceHeader("Tablet"))
+
+	// A refresh stays in the same session
+	code, _, _ := rotationRefresh(handler, refreshToken)
+	require.Equal(t, http.StatusOK, code)
+
+	code, body := sessionRequest(handler, http.MethodGet, "/auth/sessions", laptop)
+	require.Equal(t, http.StatusOK, code)
+	sessions := gjson.Get(body, "sessions").Array()
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "Laptop", sessions[0].Get("metadata.device_name").String())
+	assert.True(t, sessions[0].Get("current").Bool())
+	assert.Equal(t, int64(1), sessions[0].Get("metadata.refresh_count").Int())
+	assert.Equal(t, "Phone", sessions[1].Get("metadata.device_name").String())
+	assert.False(t, sessions[1].Get("current").Bool())
+	assert.NotContains(t, body, refreshToken, "refresh tokens are not exposed")
+}
+
+func TestRevokeSessionHandler(t *testing.T) {
+	var events []*Event
+	handler := newSessionHandler(t, &events)
+
+	laptop, _ := loginTokens(t, handler, "alice", deviceHeader("Laptop"))
+	phoneAccessToken, phoneRefreshToken := loginTokens(t, handler, "alice", deviceHeader("Phone"))
+	bob, _ := loginTokens(t, handler, "bob", deviceHeader("Tablet"))
+
+	_, body := sessionRequest(handler, http.MethodGet, "/auth/sessions", laptop)
+	phone := gjson.Get(body, "sessions.1.id").String()
+	require.NotEmpty(t, phone)
+
+	// Another user cannot revoke the session
+	code, body := sessionRequest(handler, http.MethodDelete, "/auth/sessions/"+phone, bob)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, ReasonSessionNotFound, gjson.Get(body, "code").String())
+
+	events = nil
+	code, body = sessionRequest(handler, http.MethodDelete, "/auth/sessions/"+phone, laptop)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, phone, gjson.Get(body, "revoked.0").String())
+
+	require.Len(t, events, 1)
+	assert.Equal(t, EventSessionRevoked, events[0].Type)
+	assert.Equal(t, phone, events[0].SessionID)
+	assert.Equal(t, "alice", events[0].Identity)
+
+	code, _, _ = rotationRefresh(handler, phoneRefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// The access token of the revoked session is refused, the others keep working
+	code, body = sessionRequest(handler, http.MethodGet, "/auth/sessions", phoneAccessToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, ReasonRevoked, gjson.Get(body, "code").String())
+	code, _ = sessionRequest(handler, http.MethodGet, "/auth/sessions", laptop)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestRevokeOtherSessionsHandler(t *testing.T) {
+	var events []*Event
+	handler := newSessionHandler(t, &events)
+
+	laptop, laptopRefreshToken := loginTokens(t, handler, "alice", deviceHeader("Laptop"))
+	_, phoneRefreshToken := loginTokens(t, handler, "alice", deviceHeader("Phone"))
+	_, tabletRefreshToken := loginTokens(t, handler, "alice", deviceHeader("Tablet"))
+	_, bobRefreshToken := loginTokens(t, handler, "bob", deviceHeader("Laptop"))
+
+	code, body := sessionRequest(handler, http.MethodDelete, "/auth/sessions", laptop)
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, gjson.Get(body, "revoked").Array(), 2)
+
+	code, _, _ = rotationRefresh(handler, phoneRefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _, _ = rotationRefresh(handler, tabletRefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _, _ = rotationRefresh(handler, laptopRefreshToken)
+	assert.Equal(t, http.StatusOK, code, "the current session is kept")
+	code, _, _ = rotationRefresh(handler, bobRefreshToken)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestAdminSessionHandlers(t *testing.T) {
+	var events []*Event
+	handler := newSessionHandler(t, &events)
+
+	admin, _ := loginTokens(t, handler, testAdmin, deviceHeader("Desktop"))
+	alice, _ := loginTokens(t, handler, "alice", deviceHeader("Laptop"))
+	_, aliceRefreshToken := loginTokens(t, handler, "alice", deviceHeader("Phone"))
+	const aliceSessions = "/auth/admin/users/alice/sessions"
+
+	// Only callers allowed by SessionAdminAuthorizer
+	code, body := sessionRequest(handler, http.MethodGet, aliceSessions, alice)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, ReasonForbidden, gjson.Get(body, "code").String())
+
+	code, body = sessionRequest(handler, http.MethodGet, aliceSessions, admin)
+	require.Equal(t, http.StatusOK, code)
+	sessions := gjson.Get(body, "sessions").Array()
+	require.Len(t, sessions, 2)
+	assert.False(t, sessions[0].Get("current").Bool())
+
+	phone := sessions[1].Get("id").String()
+	code, _ = sessionRequest(handler, http.MethodDelete, aliceSessions+"/"+phone, admin)
+	require.Equal(t, http.StatusOK, code)
+	code, _, _ = rotationRefresh(handler, aliceRefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, body = sessionRequest(handler, http.MethodDelete, aliceSessions, admin)
+	require.Equal(t, http.StatusOK, code)
+	assert.Len(t, gjson.Get(body, "revoked").Array(), 1)
+
+	_, body = sessionRequest(handler, http.MethodGet, aliceSessions, admin)
+	assert.Empty(t, gjson.Get(body, "sessions").Array())
+}
+
+func TestAdminSessionHandlersMissingSubject(t *testing.T) {
+	var events []*Event
+	handler := newSessionHandler(t, &events)
+
+	admin, _ := loginTokens(t, handler, testAdmin, nil)
+	const noSubject = "/auth/admin/users//sessions"
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		code, body := sessionRequest(handler, method, noSubject, admin)
+		assert.Equal(t, http.StatusBadRequest, code, method)
+		assert.Equal(t, ReasonMissingSubject, gjson.Get(body, "code").String(), method)
+	}
+	code, body := sessionRequest(handler, http.MethodDelete, noSubject+"/session", admin)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, ReasonMissingSubject, gjson.Get(body, "code").String())
+}
+
+func TestSessionHandlersNotSupported(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:             "test zone",
+		Key:               key,
+		Authenticator:     testUserAuthenticator,
+		RefreshTokenStore: plainTokenStore{store.NewInMemoryRefreshTokenStore()},
+		PayloadFunc: func(data any) jwt.MapClaims {
+			return jwt.MapClaims{IdentityKey: data}
+		},
+	})
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.POST("/login", authMiddleware.LoginHandler)
+	r.GET("/auth/sessions", authMiddleware.MiddlewareFunc(), authMiddleware.ListSessionsHandler)
+
+	accessToken, _ := loginTokens(t, r, "alice", deviceHeader("Laptop"))
+	code, _ := sessionRequest(r, http.MethodGet, "/auth/sessions", accessToken)
+	assert.Equal(t, http.StatusNotImplemented, code)
+
+	_, err = New(&GinJWTMiddleware{
+		Realm:                 "test zone",
+		Key:                   key,
+		RefreshTokenStore:     plainTokenStore{store.NewInMemoryRefreshTokenStore()},
+		EnableSessionHandlers: true,
+	})
+	assert.ErrorIs(t, err, ErrSessionsNotSupported)
+}
@@ -0,0 +1,179 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// revokedSessionKeyPrefix prefixes the store keys marking revoked sessions
+const revokedSessionKeyPrefix = "revoked_session:"
+
+// SessionLimitPolicy decides what a login does when the user has MaxSessionsPerUser sessions
+type SessionLimitPolicy int
+
+const (
+	// SessionLimitEvictOldest revokes the oldest sessions to make room for the new one
+	SessionLimitEvictOldest SessionLimitPolicy = iota
+	// SessionLimitReject refuses the login with ErrSessionLimitReached
+	SessionLimitReject
+)
+
+// sessionStore returns RefreshTokenStore as a core.SessionStore, when it implements it.
+func (mw *GinJWTMiddleware) sessionStore() (core.SessionStore, bool) {
+	store, ok := mw.RefreshTokenStore.(core.SessionStore)
+	return store, ok
+}
+
+// initializeSessionLimit sets the session defaults and checks that RefreshTokenStore
+// indexes sessions when MaxSessionsPerUser is set.
+func (mw *GinJWTMiddleware) initializeSessionLimit() error {
+	if mw.SubjectFunc == nil {
+		mw.SubjectFunc = mw.defaultSubject
+	}
+
+	if mw.MaxSessionsPerUser <= 0 {
+		return nil
+	}
+	if _, ok := mw.sessionStore(); !ok {
+		return ErrSessionLimitNotSupported
+	}
+	if _, ok := mw.dataStore(); !ok {
+		return ErrSessionLimitNotSupported
+	}
+	return nil
+}
+
+// indexesSessions reports whether refresh tokens are stored with their subject, for the
+// features that look up the sessions of a user. Without them, logins skip SubjectFunc and
+// the session index of the store.
+func (mw *GinJWTMiddleware) indexesSessions() bool {
+	return mw.MaxSessionsPerUser > 0 || mw.EnableSessionHandlers ||
+		mw.EnableRevocationWatermark || mw.EnableSlidingSession
+}
+
+// defaultSubject is the IdentityKey claim PayloadFunc returns for data,
+// or data itself when it is a string.
+func (mw *GinJWTMiddleware) defaultSubject(data any) string {
+	if mw.PayloadFunc != nil {
+		if identity := mw.PayloadFunc(data)[mw.IdentityKey]; identity != nil {
+			return fmt.Sprint(identity)
+		}
+	}
+	subject, _ := data.(string)
+	return subject
+}
+
+// tokenSubject is the user of an access token: its sub claim, or its IdentityKey claim.
+func (mw *GinJWTMiddleware) tokenSubject(claims jwt.MapClaims) string {
+	if subject, ok := claims["sub"].(string); ok && subject != "" {
+		return subject
+	}
+	if identity := claims[mw.IdentityKey]; identity != nil {
+		return fmt.Sprint(identity)
+	}
+	return ""
+}
+
+// enforceSessionLimit makes room for a new session of the user of data, or refuses it,
+// according to SessionLimitPolicy.
+func (mw *GinJWTMiddleware) enforceSessionLimit(
+	ctx context.Context,
+	c *gin.Context,
+	data any,
+) error {
+	if mw.MaxSessionsPerUser <= 0 {
+		return nil
+	}
+	subject := mw.SubjectFunc(data)
+	if subject == "" {
+		return nil
+	}
+
+	store, _ := mw.sessionStore()
+	sessions, err := mw.storeSessions(ctx, store, subject)
+	if err != nil {
+		return err
+	}
+	excess := len(sessions) - mw.MaxSessionsPerUser + 1
+	if excess <= 0 {
+		return nil
+	}
+	if mw.SessionLimitPolicy == SessionLimitReject {
+		return ErrSessionLimitReached
+	}
+
+	for _, session := range sessions[:excess] {
+		if err := mw.revokeRefreshToken(ctx, session.Token); err != nil {
+			return err
+		}
+		if err := mw.revokeSessionAccess(ctx, session.Data); err != nil {
+			return err
+		}
+		mw.emitSession(c, EventSessionEvicted, session.Data.UserData, session.Data.SessionID)
+	}
+	return nil
+}
+
+// revokesSessions reports whether sessions can be revoked before their access tokens expire,
+// by the session handlers or by MaxSessionsPerUser evictions.
+func (mw *GinJWTMiddleware) revokesSessions() bool {
+	return mw.EnableSessionHandlers ||
+		(mw.MaxSessionsPerUser > 0 && mw.SessionLimitPolicy == SessionLimitEvictOldest)
+}
+
+// revokeSessionAccess marks the session of the refresh token data as revoked, so that
+// MiddlewareFunc refuses its access tokens. The mark lasts as long as they can: the latest
+// one was issued with the refresh token, and sliding sessions renew them until SessionMaxAge.
+func (mw *GinJWTMiddleware) revokeSessionAccess(
+	ctx context.Context,
+	data *core.RefreshTokenData,
+) error {
+	if data.SessionID == "" {
+		return nil
+	}
+
+	now := mw.TimeFunc()
+	issued := data.Created
+	if issued.IsZero() {
+		issued = now
+	}
+	expiry := issued.Add(mw.TimeoutFunc(data.UserData))
+	if mw.EnableSlidingSession && !data.SessionStart.IsZero() {
+		if end := data.SessionStart.Add(mw.SessionMaxAge); end.After(expiry) {
+			expiry = end
+		}
+	}
+	if !expiry.After(now) {
+		return nil
+	}
+
+	key := revokedSessionKeyPrefix + data.SessionID
+	return mw.setStoreRecord(ctx, core.KindRevokedSession, key, data.SessionID, expiry)
+}
+
+// checkSessionRevoked returns ErrTokenRevoked when the session of an access token was revoked.
+func (mw *GinJWTMiddleware) checkSessionRevoked(ctx context.Context, claims jwt.MapClaims) error {
+	sessionID, _ := claims[claimSessionID].(string)
+	if sessionID == "" {
+		return nil
+	}
+
+	_, err := mw.storeRecord(ctx, core.KindRevokedSession, revokedSessionKeyPrefix+sessionID)
+	switch {
+	case errors.Is(err, core.ErrRefreshTokenNotFound):
+		return nil
+	case err != nil:
+		mw.logger().Warn("failed to check session revocation",
+			logKeyStore, storeType(mw.RefreshTokenStore),
+			logKeyErrorKind, errorKindStore,
+			logKeyError, err,
+		)
+		return ErrRevocationCheckFailed
+	}
+	return ErrTokenRevoked
+}
@@ -0,0 +1,161 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/appleboy/gin-jwt/v3/store"
+	"github.com/appleboy/gofight/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newSessionLimitMiddleware(
+	t *testing.T,
+	policy SessionLimitPolicy,
+	events *[]*Event,
+) *GinJWTMiddleware {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:              "test zone",
+		Key:                key,
+		Timeout:            time.Hour,
+		Authenticator:      validAuthenticator,
+		MaxSessionsPerUser: 2,
+		SessionLimitPolicy: policy,
+		ProblemDetails:     true,
+		EventHandler: EventHandlerFunc(func(ctx context.Context, event *Event) {
+			*events = append(*events, event)
+		}),
+	})
+	require.NoError(t, err)
+	return authMiddleware
+}
+
+func TestSessionLimitEvictOldest(t *testing.T) {
+	var events []*Event
+	handler := ginHandler(newSessionLimitMiddleware(t, SessionLimitEvictOldest, &events))
+
+	_, first := loginTokens(t, handler, testAdmin, nil)
+	_, second := loginTokens(t, handler, testAdmin, nil)
+
+	// A refresh stays in its session, and keeps its place in the eviction order
+	code, firstAccessToken, first := rotationRefresh(handler, first)
+	require.Equal(t, http.StatusOK, code)
+
+	events = nil
+	_, third := loginTokens(t, handler, testAdmin, nil)
+
+	code, _, _ = rotationRefresh(handler, first)
+	assert.Equal(t, http.StatusUnauthorized, code, "the oldest session is evicted")
+	code, body := sessionRequest(handler, http.MethodGet, "/auth/hello", firstAccessToken)
+	assert.Equal(t, http.StatusUnauthorized, code, "so is its access token")
+	assert.Equal(t, ReasonRevoked, gjson.Get(body, "code").String())
+	code, _, _ = rotationRefresh(handler, second)
+	assert.Equal(t, http.StatusOK, code)
+	code, _, _ = rotationRefresh(handler, third)
+	assert.Equal(t, http.StatusOK, code)
+
+	require.NotEmpty(t, events)
+	evicted := events[0]
+	assert.Equal(t, EventSessionEvicted, evicted.Type)
+	assert.Equal(t, testAdmin, evicted.Identity)
+	assert.NotEmpty(t, evicted.SessionID)
+}
+
+func TestSessionLimitReject(t *testing.T) {
+	var events []*Event
+	handler := ginHandler(newSessionLimitMiddleware(t, SessionLimitReject, &events))
+
+	_, first := loginTokens(t, handler, testAdmin, nil)
+	loginTokens(t, handler, testAdmin, nil)
+
+	gofight.New().POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": testPassword}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusForbidden, r.Code)
+			assert.Equal(t, ReasonSessionLimit, gjson.Get(r.Body.String(), "code").String())
+		})
+
+	// The existing sessions are untouched
+	code, _, _ := rotationRefresh(handler, first)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestSessionLimitNotSupported(t *testing.T) {
+	_, err := New(&GinJWTMiddleware{
+		Realm:              "test zone",
+		Key:                key,
+		RefreshTokenStore:  plainTokenStore{store.NewInMemoryRefreshTokenStore()},
+		MaxSessionsPerUser: 1,
+	})
+	assert.ErrorIs(t, err, ErrSessionLimitNotSupported)
+}
+
+func TestDefaultSubject(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "admin", authMiddleware.SubjectFunc("admin"))
+	assert.Empty(t, authMiddleware.SubjectFunc(42))
+
+	authMiddleware.PayloadFunc = func(data any) jwt.MapClaims {
+		return jwt.MapClaims{IdentityKey: data}
+	}
+	assert.Equal(t, "42", authMiddleware.SubjectFunc(42))
+}
+
+func TestSubjectOnlyForSessionFeatures(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		var calls int
+		authMiddleware, err := New(&GinJWTMiddleware{
+			Realm:                 "test zone",
+			Key:                   key,
+			EnableSessionHandlers: enabled,
+			SubjectFunc: func(data any) string {
+				calls++
+				return "alice"
+			},
+		})
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		tokenPair, err := authMiddleware.TokenGenerator(ctx, "alice")
+		require.NoError(t, err)
+		data, err := authMiddleware.RefreshTokenStore.(core.DataStore).
+			GetData(ctx, tokenPair.RefreshToken)
+		require.NoError(t, err)
+
+		if enabled {
+			assert.Equal(t, "alice", data.Subject)
+			assert.Equal(t, 1, calls)
+		} else {
+			assert.Empty(t, data.Subject, "no session feature needs the subject")
+			assert.Zero(t, calls)
+		}
+	}
+}
+
+func TestTokenSubject(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "alice", authMiddleware.tokenSubject(jwt.MapClaims{IdentityKey: "alice"}))
+	assert.Equal(t, "42", authMiddleware.tokenSubject(jwt.MapClaims{IdentityKey: float64(42)}))
+	assert.Equal(t, "user-1", authMiddleware.tokenSubject(jwt.MapClaims{
+		"sub":       "user-1",
+		IdentityKey: "alice",
+	}), "sub takes precedence")
+	assert.Empty(t, authMiddleware.tokenSubject(jwt.MapClaims{}))
+}
@@ -0,0 +1,144 @@
+package jwt
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultSlidingTokenHeader is the default response header carrying a renewed access token
+const DefaultSlidingTokenHeader = "X-Renewed-Token"
+
+// defaultSessionMaxAge caps sliding sessions when SessionMaxAge is not set
+const defaultSessionMaxAge = 24 * time.Hour
+
+// renewal describes the access token a sliding session replaces.
+type renewal struct {
+	// claims of the current token, carried over to the renewed one
+	claims jwt.MapClaims
+	// sessionStart is the orig_iat of the current token, the time of the login
+	sessionStart time.Time
+	// sessionEnd is the absolute limit of the session
+	sessionEnd time.Time
+	// lifetime of the current token, given to the renewed one
+	lifetime time.Duration
+}
+
+type renewalContextKey struct{}
+
+// renewalFromContext returns the renewal of an access token issued in ctx, or nil.
+func renewalFromContext(ctx context.Context) *renewal {
+	r, _ := ctx.Value(renewalContextKey{}).(*renewal)
+	return r
+}
+
+// initializeSlidingSession sets the sliding session defaults.
+func (mw *GinJWTMiddleware) initializeSlidingSession() {
+	if !mw.EnableSlidingSession {
+		return
+	}
+
+	if mw.SlidingWindow <= 0 {
+		mw.SlidingWindow = mw.Timeout / 2
+	}
+	if mw.SessionMaxAge <= 0 {
+		mw.SessionMaxAge = defaultSessionMaxAge
+	}
+	if mw.SlidingTokenHeader == "" {
+		mw.SlidingTokenHeader = DefaultSlidingTokenHeader
+	}
+}
+
+// slidingRenewal returns the renewal of a token expiring within SlidingWindow, or nil when the
+// token is not due yet or the session cannot be extended past its absolute limit.
+func (mw *GinJWTMiddleware) slidingRenewal(claims jwt.MapClaims) *renewal {
+	exp, ok := claims[mw.ExpField].(float64)
+	if !ok {
+		return nil
+	}
+	origIat, ok := claims["orig_iat"].(float64)
+	if !ok {
+		return nil
+	}
+
+	now := mw.TimeFunc()
+	expire := time.Unix(int64(exp), 0)
+	start := time.Unix(int64(origIat), 0)
+	end := start.Add(mw.SessionMaxAge)
+	if expire.Sub(now) > mw.SlidingWindow || !expire.Before(end) {
+		return nil
+	}
+
+	// The token of the login has no iat claim: it was issued at orig_iat
+	issued := start
+	if iat, ok := claims["iat"].(float64); ok {
+		issued = time.Unix(int64(iat), 0)
+	}
+	return &renewal{
+		claims:       claims,
+		sessionStart: start,
+		sessionEnd:   end,
+		lifetime:     expire.Sub(issued),
+	}
+}
+
+// sessionActive reports whether the session of an access token still has a valid refresh
+// token. Tokens without a session ID, and stores that do not index sessions, count as active.
+func (mw *GinJWTMiddleware) sessionActive(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+	sessionID, _ := claims[claimSessionID].(string)
+	subject := mw.tokenSubject(claims)
+	store, ok := mw.sessionStore()
+	if sessionID == "" || subject == "" || !ok {
+		return true, nil
+	}
+
+	sessions, err := mw.storeSessions(ctx, store, subject)
+	if err != nil {
+		return false, err
+	}
+	for _, session := range sessions {
+		if session.Data.SessionID == sessionID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// renewAccessToken issues a fresh access token when the current one is about to expire,
+// and returns it in SlidingTokenHeader and, with SendCookie, in the access token cookie.
+// Tokens of revoked or evicted sessions are not renewed. A failure is logged and leaves
+// the current token in place.
+func (mw *GinJWTMiddleware) renewAccessToken(c *gin.Context, claims jwt.MapClaims, identity any) {
+	r := mw.slidingRenewal(claims)
+	if r == nil {
+		return
+	}
+
+	active, err := mw.sessionActive(c.Request.Context(), claims)
+	if err != nil {
+		mw.logger().Warn("failed to check session of renewed token",
+			logKeyStore, storeType(mw.RefreshTokenStore),
+			logKeyErrorKind, errorKindStore,
+			logKeyError, err,
+		)
+		return
+	}
+	if !active {
+		return
+	}
+
+	// The renewed token keeps the claims and lifetime of the current one: the user data
+	// PayloadFunc and TimeoutFunc take is only known at login.
+	ctx := context.WithValue(c.Request.Context(), renewalContextKey{}, r)
+	token, _, err := mw.generateAccessToken(ctx, nil)
+	if err != nil {
+		mw.logger().Warn("failed to renew access token", logKeyError, err)
+		return
+	}
+
+	c.Header(mw.SlidingTokenHeader, token)
+	mw.SetCookie(c, token)
+	mw.emit(c, EventTokenRenewed, identity, nil)
+}
@@ -0,0 +1,185 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSlidingMiddleware(t *testing.T, now *time.Time, sessionMaxAge time.Duration) (
+	*GinJWTMiddleware, *gin.Engine,
+) {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: validAuthenticator,
+		PayloadFunc: func(data any) jwt.MapClaims {
+			return jwt.MapClaims{"identity": data, "role": "admin"}
+		},
+		TimeFunc:             func() time.Time { return *now },
+		SendCookie:           true,
+		EnableSlidingSession: true,
+		SessionMaxAge:        sessionMaxAge,
+	})
+	require.NoError(t, err)
+	return authMiddleware, ginHandler(authMiddleware)
+}
+
+// slidingRequest calls a protected route and returns the renewed token, if any.
+func slidingRequest(t *testing.T, handler *gin.Engine, token string) string {
+	t.Helper()
+
+	var renewed string
+	gofight.New().GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + token}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			require.Equal(t, http.StatusOK, r.Code)
+			renewed = r.HeaderMap.Get(DefaultSlidingTokenHeader) //nolint:staticcheck
+			if renewed != "" {
+				cookie := findCookie(r, "jwt")
+				require.NotNil(t, cookie)
+				assert.Equal(t, renewed, cookie.Value)
+			}
+		})
+	return renewed
+}
+
+func TestSlidingSessionRenewal(t *testing.T) {
+	login := time.Now().Truncate(time.Second)
+	now := login
+	authMiddleware, handler := newSlidingMiddleware(t, &now, 0)
+	assert.Equal(t, 30*time.Minute, authMiddleware.SlidingWindow)
+	assert.Equal(t, 24*time.Hour, authMiddleware.SessionMaxAge)
+
+	token, _ := loginTokens(t, handler, testAdmin, nil)
+
+	// Not within the sliding window yet
+	now = login.Add(20 * time.Minute)
+	assert.Empty(t, slidingRequest(t, handler, token))
+
+	now = login.Add(40 * time.Minute)
+	renewed := slidingRequest(t, handler, token)
+	require.NotEmpty(t, renewed)
+
+	parsed, err := authMiddleware.ParseTokenString(renewed)
+	require.NoError(t, err)
+	claims := ExtractClaimsFromToken(parsed)
+	assert.Equal(t, float64(now.Add(time.Hour).Unix()), claims["exp"])
+	assert.Equal(t, float64(login.Unix()), claims["orig_iat"])
+	assert.Equal(t, testAdmin, claims["identity"])
+	assert.Equal(t, "admin", claims["role"])
+
+	// The renewed token keeps the session going past the original expiry
+	now = login.Add(90 * time.Minute)
+	assert.NotEmpty(t, slidingRequest(t, handler, renewed))
+}
+
+func TestSlidingSessionMaxAge(t *testing.T) {
+	login := time.Now().Truncate(time.Second)
+	now := login
+	authMiddleware, handler := newSlidingMiddleware(t, &now, 90*time.Minute)
+
+	token, _ := loginTokens(t, handler, testAdmin, nil)
+
+	now = login.Add(40 * time.Minute)
+	renewed := slidingRequest(t, handler, token)
+	require.NotEmpty(t, renewed)
+
+	parsed, err := authMiddleware.ParseTokenString(renewed)
+	require.NoError(t, err)
+	end := float64(login.Add(90 * time.Minute).Unix())
+	assert.Equal(t, end, ExtractClaimsFromToken(parsed)["exp"])
+
+	// The session already ends with the renewed token
+	now = login.Add(80 * time.Minute)
+	assert.Empty(t, slidingRequest(t, handler, renewed))
+
+	now = login.Add(91 * time.Minute)
+	gofight.New().GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + renewed}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+}
+
+func TestSlidingSessionEvent(t *testing.T) {
+	login := time.Now().Truncate(time.Second)
+	now := login
+	authMiddleware, handler := newSlidingMiddleware(t, &now, 0)
+
+	var events []EventType
+	authMiddleware.EventHandler = EventHandlerFunc(func(_ context.Context, event *Event) {
+		events = append(events, event.Type)
+	})
+
+	token, _ := loginTokens(t, handler, testAdmin, nil)
+	now = login.Add(50 * time.Minute)
+	require.NotEmpty(t, slidingRequest(t, handler, token))
+	assert.Contains(t, events, EventTokenRenewed)
+}
+
+func TestSlidingSessionKeepsLifetime(t *testing.T) {
+	login := time.Now().Truncate(time.Second)
+	now := login
+	authMiddleware, handler := newSlidingMiddleware(t, &now, 0)
+
+	var calls int
+	authMiddleware.TimeoutFunc = func(data any) time.Duration {
+		calls++
+		return 2 * time.Hour
+	}
+
+	token, _ := loginTokens(t, handler, testAdmin, nil)
+
+	now = login.Add(100 * time.Minute)
+	renewed := slidingRequest(t, handler, token)
+	require.NotEmpty(t, renewed)
+
+	parsed, err := authMiddleware.ParseTokenString(renewed)
+	require.NoError(t, err)
+	claims := ExtractClaimsFromToken(parsed)
+	assert.Equal(t, float64(now.Add(2*time.Hour).Unix()), claims["exp"])
+	assert.Equal(t, float64(now.Unix()), claims["iat"])
+
+	// Later renewals measure the lifetime from the iat claim
+	now = now.Add(100 * time.Minute)
+	renewed = slidingRequest(t, handler, renewed)
+	require.NotEmpty(t, renewed)
+	parsed, err = authMiddleware.ParseTokenString(renewed)
+	require.NoError(t, err)
+	assert.Equal(t, float64(now.Add(2*time.Hour).Unix()), ExtractClaimsFromToken(parsed)["exp"])
+
+	// TimeoutFunc only ran for the login
+	assert.Equal(t, 1, calls)
+}
+
+func TestSlidingSessionRevoked(t *testing.T) {
+	login := time.Now().Truncate(time.Second)
+	now := login
+	authMiddleware, handler := newSlidingMiddleware(t, &now, 0)
+
+	token, _ := loginTokens(t, handler, testAdmin, nil)
+
+	store, ok := authMiddleware.sessionStore()
+	require.True(t, ok)
+	sessions, err := store.Sessions(context.Background(), testAdmin)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.NoError(t, authMiddleware.RefreshTokenStore.Delete(
+		context.Background(), sessions[0].Token,
+	))
+
+	// The current token stays valid until it expires, but is not renewed
+	now = login.Add(40 * time.Minute)
+	assert.Empty(t, slidingRequest(t, handler, token))
+}
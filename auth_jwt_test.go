@@ -234,6 +234,51 @@ func ginHandler(auth *GinJWTMiddleware) *gin.Engine {
 	return r
 }
 
+// testLogin logs username in with testPassword through the /login route of handler, with
+// the extra request headers, requires the login to succeed and returns the reply.
+func testLogin(
+	t *testing.T,
+	handler http.Handler,
+	username string,
+	headers gofight.H,
+) gofight.HTTPResponse {
+	t.Helper()
+	return testLoginAt(t, handler, "/login", username, headers)
+}
+
+// testLoginAt is testLogin at target, e.g. the absolute URL a DPoP proof is bound to.
+func testLoginAt(
+	t *testing.T,
+	handler http.Handler,
+	target, username string,
+	headers gofight.H,
+) gofight.HTTPResponse {
+	t.Helper()
+
+	var resp gofight.HTTPResponse
+	gofight.New().POST(target).
+		SetHeader(headers).
+		SetJSON(gofight.D{"username": username, "password": testPassword}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			require.Equal(t, http.StatusOK, r.Code)
+			resp = r
+		})
+	return resp
+}
+
+// loginTokens is testLogin returning the access and refresh tokens of the reply.
+func loginTokens(
+	t *testing.T,
+	handler http.Handler,
+	username string,
+	headers gofight.H,
+) (string, string) {
+	t.Helper()
+
+	body := testLogin(t, handler, username, headers).Body.String()
+	return gjson.Get(body, "access_token").String(), gjson.Get(body, "refresh_token").String()
+}
+
 func TestMissingAuthenticatorForLoginHandler(t *testing.T) {
 	authMiddleware, err := New(&GinJWTMiddleware{
 		Realm:      "test zone",
@@ -891,7 +936,7 @@ func TestClaimsDuringAuthorization(t *testing.T) {
 	r := gofight.New()
 	handler := ginHandler(authMiddleware)
 
-	userToken, _, _ := authMiddleware.generateAccessToken(jwt.MapClaims{
+	userToken, _, _ := authMiddleware.generateAccessToken(context.Background(), jwt.MapClaims{
 		"identity": "administrator",
 	})
 
@@ -1056,7 +1101,7 @@ func TestTokenFromQueryString(t *testing.T) {
 
 	r := gofight.New()
 
-	userToken, _, _ := authMiddleware.generateAccessToken(jwt.MapClaims{
+	userToken, _, _ := authMiddleware.generateAccessToken(context.Background(), jwt.MapClaims{
 		"identity": testAdmin,
 	})
 
@@ -1094,7 +1139,7 @@ func TestTokenFromParamPath(t *testing.T) {
 
 	r := gofight.New()
 
-	userToken, _, _ := authMiddleware.generateAccessToken(jwt.MapClaims{
+	userToken, _, _ := authMiddleware.generateAccessToken(context.Background(), jwt.MapClaims{
 		"identity": testAdmin,
 	})
 
@@ -1129,7 +1174,7 @@ func TestTokenFromCookieString(t *testing.T) {
 
 	r := gofight.New()
 
-	userToken, _, _ := authMiddleware.generateAccessToken(jwt.MapClaims{
+	userToken, _, _ := authMiddleware.generateAccessToken(context.Background(), jwt.MapClaims{
 		"identity": testAdmin,
 	})
 
@@ -1435,7 +1480,7 @@ func TestCheckTokenString(t *testing.T) {
 
 	r := gofight.New()
 
-	userToken, _, _ := authMiddleware.generateAccessToken(jwt.MapClaims{
+	userToken, _, _ := authMiddleware.generateAccessToken(context.Background(), jwt.MapClaims{
 		"identity": testAdmin,
 	})
 
@@ -1609,7 +1654,7 @@ func TestTokenGeneratorWithRevocation(t *testing.T) {
 	// Verify old refresh token exists in store
 	storedData, err := authMiddleware.validateRefreshToken(ctx, oldTokenPair.RefreshToken)
 	assert.NoError(t, err)
-	assert.Equal(t, userData, storedData)
+	assert.Equal(t, userData, storedData.UserData)
 
 	// Generate new token pair with revocation
 	newTokenPair, err := authMiddleware.TokenGeneratorWithRevocation(
@@ -1630,7 +1675,7 @@ func TestTokenGeneratorWithRevocation(t *testing.T) {
 	// Verify new refresh token works
 	storedData, err = authMiddleware.validateRefreshToken(ctx, newTokenPair.RefreshToken)
 	assert.NoError(t, err)
-	assert.Equal(t, userData, storedData)
+	assert.Equal(t, userData, storedData.UserData)
 
 	// Test revoking already revoked token (should not fail)
 	anotherTokenPair, err := authMiddleware.TokenGeneratorWithRevocation(
@@ -1696,7 +1741,7 @@ func TestWWWAuthenticateHeader(t *testing.T) {
 		{
 			name:           "default realm with invalid token",
 			realm:          "test zone",
-			expectedHeader: `Bearer realm="test zone"`,
+			expectedHeader: `Bearer realm="test zone", error="invalid_token", error_description="token is malformed: token contains an invalid number of segments"`,
 			authHeader:     "Bearer invalid_token",
 			endpoint:       "/auth/hello",
 			setupRequest: func(r *gofight.RequestConfig) {
@@ -1718,7 +1763,7 @@ func TestWWWAuthenticateHeader(t *testing.T) {
 		{
 			name:           "realm with special characters",
 			realm:          `test-zone_123`,
-			expectedHeader: `Bearer realm="test-zone_123"`,
+			expectedHeader: `Bearer realm="test-zone_123", error="invalid_token", error_description="token is malformed: token contains an invalid number of segments"`,
 			authHeader:     "Bearer invalid",
 			endpoint:       "/auth/hello",
 			setupRequest: func(r *gofight.RequestConfig) {
@@ -1730,7 +1775,7 @@ func TestWWWAuthenticateHeader(t *testing.T) {
 		{
 			name:           "expired token",
 			realm:          "test zone",
-			expectedHeader: `Bearer realm="test zone"`,
+			expectedHeader: `Bearer realm="test zone", error="invalid_token", error_description="token is expired"`,
 			endpoint:       "/auth/hello",
 			setupRequest: func(r *gofight.RequestConfig) {
 				// Create an expired token
@@ -1748,7 +1793,7 @@ func TestWWWAuthenticateHeader(t *testing.T) {
 		{
 			name:           "malformed token",
 			realm:          "api realm",
-			expectedHeader: `Bearer realm="api realm"`,
+			expectedHeader: `Bearer realm="api realm", error="invalid_token", error_description="token is malformed: token contains an invalid number of segments"`,
 			endpoint:       "/auth/hello",
 			setupRequest: func(r *gofight.RequestConfig) {
 				r.SetHeader(gofight.H{
@@ -1759,7 +1804,7 @@ func TestWWWAuthenticateHeader(t *testing.T) {
 		{
 			name:           "missing Bearer prefix",
 			realm:          "test zone",
-			expectedHeader: `Bearer realm="test zone"`,
+			expectedHeader: `Bearer realm="test zone", error="invalid_request", error_description="auth header is invalid"`,
 			endpoint:       "/auth/hello",
 			setupRequest: func(r *gofight.RequestConfig) {
 				r.SetHeader(gofight.H{
@@ -1821,7 +1866,11 @@ func TestWWWAuthenticateHeaderOnRefresh(t *testing.T) {
 		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
 			assert.Equal(t, http.StatusUnauthorized, r.Code)
 			//nolint:staticcheck
-			assert.Equal(t, `Bearer realm="refresh realm"`, r.HeaderMap.Get("WWW-Authenticate"))
+			assert.Equal(
+				t,
+				`Bearer realm="refresh realm", error="invalid_token", error_description="invalid or expired refresh token"`,
+				r.HeaderMap.Get("WWW-Authenticate"),
+			)
 		})
 }
 
@@ -1911,7 +1960,7 @@ func TestWWWAuthenticateHeaderWithDifferentRealms(t *testing.T) {
 					assert.Equal(t, http.StatusUnauthorized, r.Code)
 					assert.Equal(
 						t,
-						fmt.Sprintf(`Bearer realm="%s"`, expectedRealm),
+						fmt.Sprintf(`Bearer realm="%s", error="invalid_token", error_description="token is malformed: token contains an invalid number of segments"`, expectedRealm),
 						r.HeaderMap.Get("WWW-Authenticate"), //nolint:staticcheck
 					)
 				})
@@ -0,0 +1,230 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // RFC 6238 default, HMAC-SHA1 is not affected by SHA-1 collisions
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var _ MFAVerifier = &TOTPVerifier{}
+
+// ErrInvalidTOTPSecret indicates the TOTP shared secret is empty or not valid base32
+var ErrInvalidTOTPSecret = errors.New("invalid totp secret")
+
+// ErrInvalidTOTPConfig indicates a TOTPVerifier with an unusable Digits, Period or Skew
+var ErrInvalidTOTPConfig = errors.New("invalid totp configuration")
+
+// TOTPVerifier is an RFC 6238 time-based one-time password MFAVerifier,
+// compatible with common authenticator apps.
+type TOTPVerifier struct {
+	// SecretFunc returns the raw shared secret of the user identified by data.
+	// Use DecodeTOTPSecret for secrets stored in base32 form. Required.
+	SecretFunc func(c *gin.Context, data any) ([]byte, error)
+
+	// Digits is the length of the generated codes, from 6 to 8. Optional, defaults to 6.
+	Digits int
+
+	// Period is the time step of the generator, a whole number of seconds.
+	// Optional, defaults to 30 seconds.
+	Period time.Duration
+
+	// Skew is the number of time steps accepted before and after the current one,
+	// to tolerate clock drift. Optional, defaults to 1; it cannot be negative.
+	Skew int
+
+	// Algorithm is the HMAC hash: SHA1, SHA256 or SHA512. Optional, defaults to SHA1.
+	Algorithm string
+
+	// TimeFunc provides the current time. Optional, defaults to time.Now.
+	TimeFunc func() time.Time
+
+	// AcceptStepFunc records the time step of a valid code of the user identified by data,
+	// and reports whether it is newer than the last step accepted for that user, so that a
+	// code cannot be used twice (RFC 6238 section 5.2). Optional, defaults to a record in
+	// memory, which only covers one instance: use a shared store, e.g. Redis, when several
+	// instances verify codes.
+	AcceptStepFunc func(c *gin.Context, data any, step uint64) (bool, error)
+
+	mu sync.Mutex
+	// lastSteps holds the last accepted step by secret digest, within the skew window
+	lastSteps map[[sha256.Size]byte]uint64
+}
+
+// Validate checks Digits, Period and Skew, and returns an error wrapping
+// ErrInvalidTOTPConfig when one of them is out of range. MiddlewareInit validates the
+// TOTPVerifier set as MFAVerifier.
+func (v *TOTPVerifier) Validate() error {
+	if v.Digits != 0 && (v.Digits < 6 || v.Digits > 8) {
+		return fmt.Errorf("%w: digits must be between 6 and 8", ErrInvalidTOTPConfig)
+	}
+	if v.Period != 0 && (v.Period < time.Second || v.Period%time.Second != 0) {
+		return fmt.Errorf("%w: period must be a whole number of seconds", ErrInvalidTOTPConfig)
+	}
+	if v.Skew < 0 {
+		return fmt.Errorf("%w: skew cannot be negative", ErrInvalidTOTPConfig)
+	}
+	return nil
+}
+
+// Verify checks code against the TOTP values around the current time.
+func (v *TOTPVerifier) Verify(c *gin.Context, data any, code string) (bool, error) {
+	if err := v.Validate(); err != nil {
+		return false, err
+	}
+	if v.SecretFunc == nil {
+		return false, ErrInvalidTOTPSecret
+	}
+
+	secret, err := v.SecretFunc(c, data)
+	if err != nil {
+		return false, err
+	}
+	if len(secret) == 0 {
+		return false, ErrInvalidTOTPSecret
+	}
+
+	digits := v.digits()
+	code = strings.TrimSpace(code)
+	if len(code) != digits {
+		return false, nil
+	}
+
+	now := time.Now
+	if v.TimeFunc != nil {
+		now = v.TimeFunc
+	}
+
+	period := v.period()
+	skew := v.Skew
+	if skew == 0 {
+		skew = 1
+	}
+
+	var step uint64
+	valid := false
+	at := now()
+	for i := -skew; i <= skew; i++ {
+		t := at.Add(time.Duration(i) * period)
+		expected := GenerateTOTP(secret, t, digits, period, v.Algorithm)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			step, valid = totpStep(t, period), true
+		}
+	}
+	if !valid {
+		return false, nil
+	}
+
+	if v.AcceptStepFunc != nil {
+		return v.AcceptStepFunc(c, data, step)
+	}
+	return v.acceptStep(secret, step, totpStep(at.Add(-time.Duration(skew)*period), period)), nil
+}
+
+// acceptStep records step as the last one accepted for secret, unless a step at least as
+// recent was accepted before. Records older than oldest can no longer match and are dropped.
+func (v *TOTPVerifier) acceptStep(secret []byte, step, oldest uint64) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.lastSteps == nil {
+		v.lastSteps = make(map[[sha256.Size]byte]uint64)
+	}
+	for digest, last := range v.lastSteps {
+		if last < oldest {
+			delete(v.lastSteps, digest)
+		}
+	}
+
+	digest := sha256.Sum256(secret)
+	if last, ok := v.lastSteps[digest]; ok && step <= last {
+		return false
+	}
+	v.lastSteps[digest] = step
+	return true
+}
+
+func (v *TOTPVerifier) digits() int {
+	if v.Digits == 0 {
+		return 6
+	}
+	return v.Digits
+}
+
+func (v *TOTPVerifier) period() time.Duration {
+	if v.Period == 0 {
+		return 30 * time.Second
+	}
+	return v.Period
+}
+
+// GenerateTOTP computes the RFC 6238 code of secret at time t.
+// algorithm is SHA1, SHA256 or SHA512; an empty value selects SHA1. digits must be at
+// most 9, and period at least one second.
+func GenerateTOTP(secret []byte, t time.Time, digits int, period time.Duration, algorithm string) string {
+	counter := totpStep(t, period)
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(totpHash(algorithm), secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation (RFC 4226 section 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range digits {
+		mod *= 10
+	}
+
+	code := make([]byte, digits)
+	value %= mod
+	for i := digits - 1; i >= 0; i-- {
+		code[i] = byte('0' + value%10)
+		value /= 10
+	}
+
+	return string(code)
+}
+
+// totpStep returns the RFC 6238 time step counter of t.
+func totpStep(t time.Time, period time.Duration) uint64 {
+	return uint64(t.Unix() / int64(period/time.Second))
+}
+
+func totpHash(algorithm string) func() hash.Hash {
+	switch strings.ToUpper(algorithm) {
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	default:
+		return sha1.New
+	}
+}
+
+// DecodeTOTPSecret decodes a base32 secret as shown by authenticator apps,
+// ignoring case, spaces and missing padding.
+func DecodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidTOTPSecret
+	}
+	return key, nil
+}
@@ -0,0 +1,99 @@
+package jwt
+
+import (
+	"context"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Span names created through Tracer
+const (
+	// SpanParseToken covers parsing and signature verification of an access token
+	SpanParseToken = "gin_jwt.parse_token"
+	// SpanKeyFunc covers the key lookup of a custom KeyFunc
+	SpanKeyFunc = "gin_jwt.key_func"
+	// SpanSignToken covers signing of an access or mfa_pending token
+	SpanSignToken = "gin_jwt.sign_token"
+	// SpanTokenGenerator covers TokenGenerator, including signing and storing the refresh token
+	SpanTokenGenerator = "gin_jwt.token_generator"
+	// SpanStoreSet covers RefreshTokenStore.Set
+	SpanStoreSet = "gin_jwt.store.set"
+	// SpanStoreGet covers RefreshTokenStore.Get
+	SpanStoreGet = "gin_jwt.store.get"
+	// SpanStoreDelete covers RefreshTokenStore.Delete
+	SpanStoreDelete = "gin_jwt.store.delete"
+	// SpanStoreCount covers RefreshTokenStore.Count
+	SpanStoreCount = "gin_jwt.store.count"
+	// SpanStoreConsume covers core.ConsumeStore.Consume
+	SpanStoreConsume = "gin_jwt.store.consume"
+	// SpanStoreSessions covers core.SessionStore.Sessions
+	SpanStoreSessions = "gin_jwt.store.sessions"
+	// SpanStoreWatermark covers core.WatermarkStore.Watermark and SetWatermark
+	SpanStoreWatermark = "gin_jwt.store.watermark"
+)
+
+// Span attribute keys. Token values are never recorded.
+const (
+	SpanAttrAlgorithm = "gin_jwt.algorithm"
+	SpanAttrStore     = "gin_jwt.store"
+	SpanAttrReason    = "gin_jwt.reason"
+)
+
+// Tracer starts spans around the expensive steps of the middleware.
+// It mirrors the OpenTelemetry trace.Tracer API, so an adapter around
+// an OpenTelemetry tracer only needs to wrap the returned span.
+type Tracer interface {
+	// Start creates a span as a child of any span in ctx and returns a context holding it
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is the subset of the OpenTelemetry trace.Span API used by the middleware.
+type Span interface {
+	// SetAttribute annotates the span
+	SetAttribute(key, value string)
+
+	// RecordError marks the span as failed with err
+	RecordError(err error)
+
+	// End completes the span
+	End()
+}
+
+// noopSpan is returned when no Tracer is configured.
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, string) {}
+func (noopSpan) RecordError(error)           {}
+func (noopSpan) End()                        {}
+
+// startSpan starts a span named name when a Tracer is configured.
+func (mw *GinJWTMiddleware) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if mw.Tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return mw.Tracer.Start(ctx, name)
+}
+
+// endSpan records the reason of err, if any, and ends span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.SetAttribute(SpanAttrReason, errorReason(err))
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// startStoreSpan starts a store span annotated with the kind of store.
+func (mw *GinJWTMiddleware) startStoreSpan(ctx context.Context, name string) (context.Context, Span) {
+	ctx, span := mw.startSpan(ctx, name)
+	span.SetAttribute(SpanAttrStore, storeType(mw.RefreshTokenStore))
+	return ctx, span
+}
+
+// tracedKeyFunc calls KeyFunc inside a span.
+func (mw *GinJWTMiddleware) tracedKeyFunc(ctx context.Context, t *jwt.Token) (any, error) {
+	_, span := mw.startSpan(ctx, SpanKeyFunc)
+	key, err := mw.KeyFunc(t)
+	endSpan(span, err)
+	return key, err
+}
@@ -0,0 +1,293 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+type requestMarker struct{}
+
+type recordedSpan struct {
+	name       string
+	parent     string
+	marked     bool
+	attributes map[string]string
+	err        error
+	ended      bool
+}
+
+type spanKey struct{}
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *spanRecorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &recordedSpan{
+		name:       name,
+		marked:     ctx.Value(requestMarker{}) != nil,
+		attributes: map[string]string{},
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.parent = parent.name
+	}
+
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+
+	return context.WithValue(ctx, spanKey{}, span), &spanHandle{recorder: r, span: span}
+}
+
+func (r *spanRecorder) find(name string) []*recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var spans []*recordedSpan
+	for _, span := range r.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func (r *spanRecorder) reset() {
+	r.mu.Lock()
+	r.spans = nil
+	r.mu.Unlock()
+}
+
+type spanHandle struct {
+	recorder *spanRecorder
+	span     *recordedSpan
+}
+
+func (h *spanHandle) SetAttribute(key, value string) {
+	h.recorder.mu.Lock()
+	h.span.attributes[key] = value
+	h.recorder.mu.Unlock()
+}
+
+func (h *spanHandle) RecordError(err error) {
+	h.recorder.mu.Lock()
+	h.span.err = err
+	h.recorder.mu.Unlock()
+}
+
+func (h *spanHandle) End() {
+	h.recorder.mu.Lock()
+	h.span.ended = true
+	h.recorder.mu.Unlock()
+}
+
+func tracingHandler(auth *GinJWTMiddleware) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestMarker{}, true))
+	})
+	r.POST("/login", auth.LoginHandler)
+	r.POST("/refresh", auth.RefreshHandler)
+	group := r.Group("/auth")
+	group.Use(auth.MiddlewareFunc())
+	group.GET("/hello", helloHandler)
+	return r
+}
+
+func TestTracingSpans(t *testing.T) {
+	recorder := &spanRecorder{}
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: validAuthenticator,
+		Tracer:        recorder,
+	})
+	require.NoError(t, err)
+
+	handler := tracingHandler(authMiddleware)
+	r := gofight.New()
+
+	var accessToken, refreshToken string
+	r.POST("/login").
+		SetJSON(gofight.D{"username": testAdmin, "password": testPassword}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			accessToken = gjson.Get(r.Body.String(), "access_token").String()
+			refreshToken = gjson.Get(r.Body.String(), "refresh_token").String()
+		})
+
+	generator := recorder.find(SpanTokenGenerator)
+	require.Len(t, generator, 1)
+	assert.True(t, generator[0].marked)
+	assert.True(t, generator[0].ended)
+
+	sign := recorder.find(SpanSignToken)
+	require.Len(t, sign, 1)
+	assert.Equal(t, SpanTokenGenerator, sign[0].parent)
+	assert.Equal(t, "HS256", sign[0].attributes[SpanAttrAlgorithm])
+
+	set := recorder.find(SpanStoreSet)
+	require.Len(t, set, 1)
+	assert.Equal(t, SpanTokenGenerator, set[0].parent)
+	assert.Equal(t, "memory", set[0].attributes[SpanAttrStore])
+
+	r.GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + accessToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	parse := recorder.find(SpanParseToken)
+	require.Len(t, parse, 1)
+	assert.True(t, parse[0].marked)
+	assert.Equal(t, "HS256", parse[0].attributes[SpanAttrAlgorithm])
+	assert.NoError(t, parse[0].err)
+
+	r.POST("/refresh").
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+	r.POST("/refresh").
+		SetJSON(gofight.D{"refresh_token": refreshToken}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+
+	get := recorder.find(SpanStoreGet)
+	require.Len(t, get, 2)
+	assert.True(t, get[0].marked)
+	assert.NoError(t, get[0].err)
+	assert.Error(t, get[1].err)
+	assert.Equal(t, ReasonInvalidRefreshToken, get[1].attributes[SpanAttrReason])
+
+	// The in-memory store redeems refresh tokens atomically
+	consume := recorder.find(SpanStoreConsume)
+	require.Len(t, consume, 1)
+	assert.True(t, consume[0].marked)
+	assert.Empty(t, recorder.find(SpanStoreDelete))
+
+	// No span may carry token material
+	for _, span := range recorder.spans {
+		assert.True(t, span.ended, span.name)
+		for k, v := range span.attributes {
+			for _, token := range []string{accessToken, refreshToken} {
+				assert.NotContains(t, v, token, "%s %s", span.name, k)
+			}
+		}
+		if span.err != nil {
+			assert.NotContains(t, span.err.Error(), refreshToken, span.name)
+		}
+	}
+}
+
+func TestTracingParseFailure(t *testing.T) {
+	recorder := &spanRecorder{}
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: validAuthenticator,
+		Tracer:        recorder,
+	})
+	require.NoError(t, err)
+
+	handler := tracingHandler(authMiddleware)
+	r := gofight.New()
+
+	r.GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + makeTokenString("HS384", testAdmin)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+
+	parse := recorder.find(SpanParseToken)
+	require.Len(t, parse, 1)
+	assert.Equal(t, ReasonInvalidAlgorithm, parse[0].attributes[SpanAttrReason])
+	assert.ErrorIs(t, parse[0].err, ErrInvalidSigningAlgorithm)
+
+	recorder.reset()
+	r.GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + strings.Repeat("x", 10)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+
+	parse = recorder.find(SpanParseToken)
+	require.Len(t, parse, 1)
+	assert.Equal(t, ReasonMalformed, parse[0].attributes[SpanAttrReason])
+	assert.NotContains(t, parse[0].attributes, SpanAttrAlgorithm)
+}
+
+func TestTracingKeyFunc(t *testing.T) {
+	recorder := &spanRecorder{}
+	errUnknownKey := errors.New("unknown key")
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: validAuthenticator,
+		Tracer:        recorder,
+		KeyFunc: func(token *jwt.Token) (any, error) {
+			if token.Header["kid"] == "unknown" {
+				return nil, errUnknownKey
+			}
+			return key, nil
+		},
+	})
+	require.NoError(t, err)
+
+	handler := tracingHandler(authMiddleware)
+	r := gofight.New()
+
+	r.GET("/auth/hello").
+		SetHeader(gofight.H{"Authorization": "Bearer " + makeTokenString("HS256", testAdmin)}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+		})
+
+	keyFunc := recorder.find(SpanKeyFunc)
+	require.Len(t, keyFunc, 1)
+	assert.Equal(t, SpanParseToken, keyFunc[0].parent)
+	assert.True(t, keyFunc[0].marked)
+	assert.NoError(t, keyFunc[0].err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"identity": testAdmin})
+	token.Header["kid"] = "unknown"
+	tokenString, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	recorder.reset()
+	_, err = authMiddleware.ParseTokenString(tokenString)
+	require.Error(t, err)
+
+	keyFunc = recorder.find(SpanKeyFunc)
+	require.Len(t, keyFunc, 1)
+	assert.ErrorIs(t, keyFunc[0].err, errUnknownKey)
+	assert.Equal(t, SpanParseToken, keyFunc[0].parent)
+}
+
+func TestTracingDisabled(t *testing.T) {
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Authenticator: validAuthenticator,
+	})
+	require.NoError(t, err)
+
+	token, err := authMiddleware.TokenGenerator(context.Background(), testAdmin)
+	require.NoError(t, err)
+
+	_, err = authMiddleware.ParseTokenString(token.AccessToken)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,197 @@
+package jwt
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// refreshReuseWindow is how long the token pair of a transparent refresh is handed to other
+// requests that still carry the old refresh cookie, e.g. requests a browser sent in parallel.
+const refreshReuseWindow = 10 * time.Second
+
+// refreshResult is the outcome of a transparent refresh.
+type refreshResult struct {
+	token       *core.Token
+	fingerprint string
+	userData    any
+	// replayed is set when token is the pair of a rotation within RefreshTokenGracePeriod
+	replayed bool
+}
+
+// refreshCall is a transparent refresh in flight, or recently completed.
+type refreshCall struct {
+	done    chan struct{}
+	result  *refreshResult
+	err     error
+	expires time.Time
+}
+
+// refreshGroup de-duplicates transparent refreshes of the same refresh token,
+// so that concurrent requests do not race to rotate it.
+type refreshGroup struct {
+	mu    sync.Mutex
+	calls map[string]*refreshCall
+}
+
+func newRefreshGroup() *refreshGroup {
+	return &refreshGroup{calls: make(map[string]*refreshCall)}
+}
+
+// do runs fn once for key. Callers arriving while it runs, or within refreshReuseWindow after
+// it succeeded, get the same result. leader reports whether fn ran for this caller.
+func (g *refreshGroup) do(
+	key string,
+	now time.Time,
+	fn func() (*refreshResult, error),
+) (result *refreshResult, leader bool, err error) {
+	g.mu.Lock()
+	for k, call := range g.calls {
+		if !call.expires.IsZero() && now.After(call.expires) {
+			delete(g.calls, k)
+		}
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.result, false, call.err
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.result, call.err = fn()
+
+	g.mu.Lock()
+	if call.err != nil {
+		delete(g.calls, key)
+	} else {
+		call.expires = now.Add(refreshReuseWindow)
+	}
+	g.mu.Unlock()
+	close(call.done)
+
+	return call.result, true, call.err
+}
+
+// initializeTransparentRefresh checks the transparent refresh settings.
+func (mw *GinJWTMiddleware) initializeTransparentRefresh() error {
+	if !mw.EnableTransparentRefresh {
+		return nil
+	}
+	if !mw.SendCookie {
+		return ErrTransparentRefreshWithoutCookie
+	}
+
+	mw.refreshCalls = newRefreshGroup()
+	return nil
+}
+
+// refreshableClaims returns the claims of the expired access token of c when it can be
+// refreshed transparently: the request carries a refresh cookie and the token is not DPoP-bound.
+func (mw *GinJWTMiddleware) refreshableClaims(c *gin.Context) jwt.MapClaims {
+	if refreshToken, _ := c.Cookie(mw.refreshTokenCookiePolicy().Name); refreshToken == "" {
+		return nil
+	}
+
+	token, err := mw.ParseToken(c)
+	if token == nil || !errors.Is(err, jwt.ErrTokenExpired) {
+		return nil
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || confirmationThumbprint(claims) != "" {
+		return nil
+	}
+	return claims
+}
+
+// transparentRefresh rotates the refresh cookie of c, sets the new cookies and returns the
+// claims of the new access token.
+func (mw *GinJWTMiddleware) transparentRefresh(c *gin.Context) (jwt.MapClaims, error) {
+	refreshToken, _ := c.Cookie(mw.refreshTokenCookiePolicy().Name)
+	result, leader, err := mw.refreshCalls.do(refreshToken, mw.TimeFunc(),
+		func() (*refreshResult, error) {
+			return mw.rotateRefreshCookie(c, refreshToken)
+		})
+	if err != nil {
+		if leader {
+			mw.emit(c, EventRefreshFailure, nil, err)
+			mw.countOutcome(MetricRefreshes, OutcomeFailure, err)
+		}
+		return nil, err
+	}
+
+	if leader && !result.replayed {
+		mw.emit(c, EventRefreshTokenRevoked, result.userData, nil)
+		mw.emit(c, EventTokenIssued, result.userData, nil)
+	}
+	if leader {
+		mw.emit(c, EventRefreshSuccess, result.userData, nil)
+		mw.countOutcome(MetricRefreshes, OutcomeSuccess, nil)
+	}
+
+	mw.SetCookie(c, result.token.AccessToken)
+	mw.SetRefreshTokenCookie(c, result.token.RefreshToken)
+	if result.fingerprint != "" {
+		mw.setFingerprintCookie(c, result.fingerprint)
+	}
+
+	token, err := mw.parseTokenString(c.Request.Context(), result.token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims type")
+	}
+
+	c.Set(tokenContextKey, result.token.AccessToken)
+	return claims, nil
+}
+
+// rotateRefreshCookie exchanges refreshToken for a new token pair, like RefreshHandler.
+func (mw *GinJWTMiddleware) rotateRefreshCookie(
+	c *gin.Context,
+	refreshToken string,
+) (*refreshResult, error) {
+	ctx := c.Request.Context()
+	data, err := mw.validateRefreshToken(ctx, refreshToken)
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		if tokenPair := mw.rotatedTokenPair(ctx, refreshToken); tokenPair != nil {
+			return &refreshResult{token: tokenPair, replayed: true}, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A DPoP-bound refresh token requires a proof, only RefreshHandler can take it
+	if mw.EnableDPoP {
+		boundJKT, err := mw.refreshTokenBinding(ctx, refreshToken)
+		if err != nil {
+			return nil, err
+		}
+		if boundJKT != "" {
+			return nil, ErrDPoPRequired
+		}
+	}
+
+	ctx = mw.refreshContext(ctx, c, data)
+	ctx, fingerprint, err := mw.fingerprintContext(mw.certificateContext(ctx, c))
+	if err != nil {
+		return nil, err
+	}
+	tokenPair, replayed, err := mw.exchangeRefreshToken(ctx, data.UserData, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if replayed {
+		return &refreshResult{token: tokenPair, replayed: true}, nil
+	}
+
+	return &refreshResult{token: tokenPair, fingerprint: fingerprint, userData: data.UserData}, nil
+}
@@ -0,0 +1,187 @@
+package jwt
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gofight/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTransparentRefreshMiddleware(t *testing.T, now *time.Time) *gin.Engine {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:                    "test zone",
+		Key:                      key,
+		Timeout:                  time.Hour,
+		Authenticator:            validAuthenticator,
+		TimeFunc:                 func() time.Time { return *now },
+		TokenLookup:              "cookie:jwt",
+		SendCookie:               true,
+		EnableTransparentRefresh: true,
+	})
+	require.NoError(t, err)
+	return ginHandler(authMiddleware)
+}
+
+// responseCookies returns the unescaped values of the cookies set by r.
+func responseCookies(t *testing.T, r gofight.HTTPResponse) map[string]string {
+	t.Helper()
+
+	cookies := make(map[string]string)
+	for _, name := range []string{"jwt", "refresh_token"} {
+		if cookie := findCookie(r, name); cookie != nil {
+			value, err := url.QueryUnescape(cookie.Value)
+			require.NoError(t, err)
+			cookies[name] = value
+		}
+	}
+	return cookies
+}
+
+func TestTransparentRefresh(t *testing.T) {
+	login := time.Now()
+	now := login
+	handler := newTransparentRefreshMiddleware(t, &now)
+	cookies := responseCookies(t, testLogin(t, handler, testAdmin, nil))
+	require.Len(t, cookies, 2)
+
+	now = login.Add(2 * time.Hour)
+	var refreshed map[string]string
+	gofight.New().GET("/auth/hello").
+		SetCookie(cookies).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			require.Equal(t, http.StatusOK, r.Code)
+			refreshed = responseCookies(t, r)
+		})
+	require.Len(t, refreshed, 2)
+	assert.NotEqual(t, cookies["jwt"], refreshed["jwt"])
+	assert.NotEqual(t, cookies["refresh_token"], refreshed["refresh_token"])
+
+	gofight.New().GET("/auth/hello").
+		SetCookie(refreshed).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusOK, r.Code)
+			assert.Empty(t, responseCookies(t, r))
+		})
+
+	// The old refresh token was rotated
+	now = now.Add(refreshReuseWindow + time.Second)
+	gofight.New().GET("/auth/hello").
+		SetCookie(cookies).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+		})
+}
+
+func TestTransparentRefreshWithoutRefreshCookie(t *testing.T) {
+	login := time.Now()
+	now := login
+	handler := newTransparentRefreshMiddleware(t, &now)
+	cookies := responseCookies(t, testLogin(t, handler, testAdmin, nil))
+
+	now = login.Add(2 * time.Hour)
+	gofight.New().GET("/auth/hello").
+		SetCookie(gofight.H{"jwt": cookies["jwt"]}).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Empty(t, responseCookies(t, r))
+		})
+}
+
+func TestTransparentRefreshConcurrent(t *testing.T) {
+	login := time.Now()
+	now := login
+	handler := newTransparentRefreshMiddleware(t, &now)
+	cookies := responseCookies(t, testLogin(t, handler, testAdmin, nil))
+
+	now = login.Add(2 * time.Hour)
+
+	const requests = 8
+	refreshTokens := make([]string, requests)
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Go(func() {
+			gofight.New().GET("/auth/hello").
+				SetCookie(cookies).
+				Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+					assert.Equal(t, http.StatusOK, r.Code)
+					refreshTokens[i] = responseCookies(t, r)["refresh_token"]
+				})
+		})
+	}
+	wg.Wait()
+
+	for _, refreshToken := range refreshTokens {
+		assert.NotEmpty(t, refreshToken)
+		assert.Equal(t, refreshTokens[0], refreshToken)
+	}
+}
+
+func TestTransparentRefreshFingerprint(t *testing.T) {
+	login := time.Now()
+	now := login
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:                    "test zone",
+		Key:                      key,
+		Timeout:                  time.Hour,
+		Authenticator:            validAuthenticator,
+		TimeFunc:                 func() time.Time { return now },
+		TokenLookup:              "cookie:jwt",
+		SendCookie:               true,
+		EnableTransparentRefresh: true,
+		EnableFingerprint:        true,
+		RefreshTokenGracePeriod:  time.Minute,
+	})
+	require.NoError(t, err)
+	handler := ginHandler(authMiddleware)
+
+	r := testLogin(t, handler, testAdmin, nil)
+	cookies := responseCookies(t, r)
+	cookies[DefaultFingerprintCookieName] = findCookie(r, DefaultFingerprintCookieName).Value
+
+	// The leader and the requests sharing its refresh get the new fingerprint
+	now = login.Add(2 * time.Hour)
+	for range 2 {
+		var refreshed map[string]string
+		gofight.New().GET("/auth/hello").
+			SetCookie(cookies).
+			Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+				require.Equal(t, http.StatusOK, r.Code)
+				refreshed = responseCookies(t, r)
+				fingerprint := findCookie(r, DefaultFingerprintCookieName)
+				require.NotNil(t, fingerprint)
+				refreshed[DefaultFingerprintCookieName] = fingerprint.Value
+			})
+		gofight.New().GET("/auth/hello").
+			SetCookie(refreshed).
+			Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+				assert.Equal(t, http.StatusOK, r.Code)
+			})
+	}
+
+	// A replay within the grace period cannot set the fingerprint cookie, and is refused
+	now = now.Add(refreshReuseWindow + time.Second)
+	gofight.New().GET("/auth/hello").
+		SetCookie(cookies).
+		Run(handler, func(r gofight.HTTPResponse, rq gofight.HTTPRequest) {
+			assert.Equal(t, http.StatusUnauthorized, r.Code)
+			assert.Empty(t, responseCookies(t, r))
+		})
+}
+
+func TestTransparentRefreshRequiresCookie(t *testing.T) {
+	_, err := New(&GinJWTMiddleware{
+		Realm:                    "test zone",
+		Key:                      key,
+		Authenticator:            validAuthenticator,
+		EnableTransparentRefresh: true,
+	})
+	assert.ErrorIs(t, err, ErrTransparentRefreshWithoutCookie)
+}
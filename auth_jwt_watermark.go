@@ -0,0 +1,161 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// watermarkStore returns RefreshTokenStore as a core.WatermarkStore, when it implements it.
+func (mw *GinJWTMiddleware) watermarkStore() (core.WatermarkStore, bool) {
+	store, ok := mw.RefreshTokenStore.(core.WatermarkStore)
+	return store, ok
+}
+
+// initializeRevocationWatermark sets the watermark defaults and checks that RefreshTokenStore
+// keeps the watermarks, and the creation time of refresh tokens they are compared with.
+func (mw *GinJWTMiddleware) initializeRevocationWatermark() error {
+	if mw.TokensRevokedResponse == nil {
+		mw.TokensRevokedResponse = func(c *gin.Context, subject string, watermark time.Time) {
+			c.JSON(http.StatusOK, gin.H{
+				keyCode:          http.StatusOK,
+				"subject":        subject,
+				"revoked_before": watermark.Format(time.RFC3339),
+			})
+		}
+	}
+
+	if !mw.EnableRevocationWatermark {
+		return nil
+	}
+	if _, ok := mw.watermarkStore(); !ok {
+		return ErrRevocationWatermarkNotSupported
+	}
+	if _, ok := mw.dataStore(); !ok {
+		return ErrRevocationWatermarkNotSupported
+	}
+	return nil
+}
+
+// RevokeTokensIssuedBefore revokes the access and refresh tokens of subject issued before
+// watermark, or the tokens of every user when subject is empty, e.g. after a key compromise.
+// The tokens are refused as soon as the watermark is stored, without rotating Key; tokens
+// issued after the second of the watermark, such as the ones of a new login, are not
+// affected. It needs EnableRevocationWatermark.
+func (mw *GinJWTMiddleware) RevokeTokensIssuedBefore(
+	ctx context.Context,
+	subject string,
+	watermark time.Time,
+) error {
+	store, ok := mw.watermarkStore()
+	if !mw.EnableRevocationWatermark || !ok {
+		return ErrRevocationWatermarkNotSupported
+	}
+
+	if err := mw.storeSetWatermark(ctx, store, subject, watermark); err != nil {
+		return err
+	}
+	mw.logger().Warn("tokens revoked by watermark",
+		"subject", subject,
+		"revoked_before", watermark,
+	)
+	return nil
+}
+
+// checkWatermark returns ErrTokenRevoked when a token of subject issued at issuedAt is not
+// newer than the revocation watermark. Times are compared to the second, the precision of the
+// iat claims, so tokens issued in the second of the watermark are revoked too.
+func (mw *GinJWTMiddleware) checkWatermark(
+	ctx context.Context,
+	subject string,
+	issuedAt time.Time,
+) error {
+	store, _ := mw.watermarkStore()
+	watermark, err := mw.storeWatermark(ctx, store, subject)
+	if err != nil {
+		mw.logger().Warn("failed to read revocation watermark",
+			logKeyStore, storeType(mw.RefreshTokenStore),
+			logKeyErrorKind, errorKindStore,
+			logKeyError, err,
+		)
+		return ErrRevocationCheckFailed
+	}
+
+	if watermark.IsZero() {
+		return nil
+	}
+	if !issuedAt.Truncate(time.Second).After(watermark.Truncate(time.Second)) {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// checkAccessWatermark checks an access token against the revocation watermark of its user,
+// read from its claims. The token counts as issued at the login of its session, its orig_iat
+// claim, so that sliding sessions renewed after the watermark are revoked too.
+func (mw *GinJWTMiddleware) checkAccessWatermark(ctx context.Context, claims jwt.MapClaims) error {
+	var issuedAt time.Time
+	if origIat, ok := claims["orig_iat"].(float64); ok {
+		issuedAt = time.Unix(int64(origIat), 0)
+	} else if iat, ok := claims["iat"].(float64); ok {
+		issuedAt = time.Unix(int64(iat), 0)
+	}
+	return mw.checkWatermark(ctx, mw.tokenSubject(claims), issuedAt)
+}
+
+// checkRefreshWatermark checks a refresh token against the revocation watermark of its user.
+func (mw *GinJWTMiddleware) checkRefreshWatermark(
+	ctx context.Context,
+	data *core.RefreshTokenData,
+) error {
+	subject := data.Subject
+	if subject == "" {
+		subject = mw.SubjectFunc(data.UserData)
+	}
+	return mw.checkWatermark(ctx, subject, data.Created)
+}
+
+// AdminRevokeTokensHandler revokes every token issued so far to the user named by the
+// SubjectParam route parameter, and replies through TokensRevokedResponse. The caller must be
+// allowed by SessionAdminAuthorizer.
+func (mw *GinJWTMiddleware) AdminRevokeTokensHandler(c *gin.Context) {
+	subject, ok := mw.subjectParam(c)
+	if !ok {
+		return
+	}
+	mw.revokeTokens(c, subject)
+}
+
+// AdminRevokeAllTokensHandler revokes every token issued so far to every user, and replies
+// through TokensRevokedResponse. The caller must be allowed by SessionAdminAuthorizer, and
+// has to log in again.
+func (mw *GinJWTMiddleware) AdminRevokeAllTokensHandler(c *gin.Context) {
+	mw.revokeTokens(c, "")
+}
+
+// revokeTokens sets the revocation watermark of subject to now, and emits an
+// EventTokensRevoked event for the audit trail.
+func (mw *GinJWTMiddleware) revokeTokens(c *gin.Context, subject string) {
+	if !mw.authorizeSessionAdmin(c) {
+		return
+	}
+
+	watermark := mw.TimeFunc()
+	err := mw.RevokeTokensIssuedBefore(c.Request.Context(), subject, watermark)
+	switch {
+	case errors.Is(err, ErrRevocationWatermarkNotSupported):
+		mw.unauthorized(c, PhaseSessions, http.StatusNotImplemented, err)
+		return
+	case err != nil:
+		mw.sessionStoreFailed(c, err)
+		return
+	}
+
+	mw.emitRevocation(c, mw.IdentityHandler(c), subject)
+	mw.TokensRevokedResponse(c, subject, watermark)
+}
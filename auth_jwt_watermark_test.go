@@ -0,0 +1,227 @@
+package jwt
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/store"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newWatermarkMiddleware(t *testing.T, now *time.Time, events *[]*Event) *GinJWTMiddleware {
+	t.Helper()
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm:         "test zone",
+		Key:           key,
+		Timeout:       time.Hour,
+		Authenticator: testUserAuthenticator,
+		PayloadFunc: func(data any) jwt.MapClaims {
+			return jwt.MapClaims{IdentityKey: data}
+		},
+		EnableRevocationWatermark: true,
+		SessionAdminAuthorizer: func(c *gin.Context, data any) bool {
+			return data == testAdmin
+		},
+		ProblemDetails: true,
+		TimeFunc: func() time.Time {
+			return *now
+		},
+		EventHandler: EventHandlerFunc(func(ctx context.Context, event *Event) {
+			*events = append(*events, event)
+		}),
+	})
+	require.NoError(t, err)
+	return authMiddleware
+}
+
+func watermarkHandler(authMiddleware *GinJWTMiddleware) *gin.Engine {
+	r := gin.New()
+	r.POST("/login", authMiddleware.LoginHandler)
+	r.POST("/refresh", authMiddleware.RefreshHandler)
+	auth := r.Group("/auth", authMiddleware.MiddlewareFunc())
+	auth.GET("/hello", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"text": "Hello World."})
+	})
+	auth.DELETE("/admin/tokens", authMiddleware.AdminRevokeAllTokensHandler)
+	auth.DELETE("/admin/users/:subject/tokens", authMiddleware.AdminRevokeTokensHandler)
+	return r
+}
+
+func TestRevokeAllTokens(t *testing.T) {
+	now := time.Now()
+	var events []*Event
+	handler := watermarkHandler(newWatermarkMiddleware(t, &now, &events))
+
+	alice, aliceRefreshToken := loginTokens(t, handler, "alice", nil)
+	code, _ := sessionRequest(handler, http.MethodGet, "/auth/hello", alice)
+	require.Equal(t, http.StatusOK, code)
+
+	now = now.Add(2 * time.Second)
+	admin, _ := loginTokens(t, handler, testAdmin, nil)
+	events = nil
+	code, body := sessionRequest(handler, http.MethodDelete, "/auth/admin/tokens", admin)
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, gjson.Get(body, "subject").String())
+
+	require.Len(t, events, 1)
+	assert.Equal(t, EventTokensRevoked, events[0].Type)
+	assert.Equal(t, testAdmin, events[0].Identity)
+	assert.Empty(t, events[0].Subject)
+
+	// Tokens issued before the watermark are refused
+	now = now.Add(2 * time.Second)
+	code, body = sessionRequest(handler, http.MethodGet, "/auth/hello", alice)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, ReasonRevoked, gjson.Get(body, "code").String())
+
+	code, _, errorCode := lifetimeRefresh(handler, aliceRefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, ReasonRevoked, errorCode)
+
+	// A new login is not affected
+	alice, aliceRefreshToken = loginTokens(t, handler, "alice", nil)
+	code, _ = sessionRequest(handler, http.MethodGet, "/auth/hello", alice)
+	assert.Equal(t, http.StatusOK, code)
+	code, _, _ = lifetimeRefresh(handler, aliceRefreshToken)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	now := time.Now()
+	var events []*Event
+	handler := watermarkHandler(newWatermarkMiddleware(t, &now, &events))
+
+	alice, _ := loginTokens(t, handler, "alice", nil)
+	bob, bobRefreshToken := loginTokens(t, handler, "bob", nil)
+	admin, _ := loginTokens(t, handler, testAdmin, nil)
+
+	// Only callers allowed by SessionAdminAuthorizer
+	now = now.Add(2 * time.Second)
+	code, _ := sessionRequest(handler, http.MethodDelete, "/auth/admin/users/bob/tokens", alice)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	events = nil
+	code, body := sessionRequest(handler, http.MethodDelete, "/auth/admin/users/bob/tokens", admin)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "bob", gjson.Get(body, "subject").String())
+	require.Len(t, events, 1)
+	assert.Equal(t, "bob", events[0].Subject)
+
+	code, _ = sessionRequest(handler, http.MethodGet, "/auth/hello", bob)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _, _ = lifetimeRefresh(handler, bobRefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = sessionRequest(handler, http.MethodGet, "/auth/hello", alice)
+	assert.Equal(t, http.StatusOK, code, "other users are not affected")
+	code, _ = sessionRequest(handler, http.MethodGet, "/auth/hello", admin)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestRevokeTokensMissingSubject(t *testing.T) {
+	now := time.Now()
+	var events []*Event
+	handler := watermarkHandler(newWatermarkMiddleware(t, &now, &events))
+
+	admin, _ := loginTokens(t, handler, testAdmin, nil)
+	events = nil
+	code, body := sessionRequest(handler, http.MethodDelete, "/auth/admin/users//tokens", admin)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, ReasonMissingSubject, gjson.Get(body, "code").String())
+	assert.Empty(t, events)
+}
+
+func TestRevokeTokensIssuedBefore(t *testing.T) {
+	now := time.Now()
+	var events []*Event
+	authMiddleware := newWatermarkMiddleware(t, &now, &events)
+	handler := watermarkHandler(authMiddleware)
+
+	alice, _ := loginTokens(t, handler, "alice", nil)
+	require.NoError(t, authMiddleware.RevokeTokensIssuedBefore(
+		context.Background(), "alice", now.Add(-time.Minute),
+	))
+	code, _ := sessionRequest(handler, http.MethodGet, "/auth/hello", alice)
+	assert.Equal(t, http.StatusOK, code, "a token issued after the watermark is kept")
+
+	require.NoError(t, authMiddleware.RevokeTokensIssuedBefore(
+		context.Background(), "alice", now.Add(time.Minute),
+	))
+	code, _ = sessionRequest(handler, http.MethodGet, "/auth/hello", alice)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestRevokeTokensSameSecond(t *testing.T) {
+	now := time.Now().Truncate(time.Second).Add(100 * time.Millisecond)
+	var events []*Event
+	handler := watermarkHandler(newWatermarkMiddleware(t, &now, &events))
+
+	admin, _ := loginTokens(t, handler, testAdmin, nil)
+	alice, aliceRefreshToken := loginTokens(t, handler, "alice", nil)
+
+	// Revoked later within the second the tokens were issued in
+	now = now.Add(500 * time.Millisecond)
+	code, _ := sessionRequest(handler, http.MethodDelete, "/auth/admin/users/alice/tokens", admin)
+	require.Equal(t, http.StatusOK, code)
+
+	code, body := sessionRequest(handler, http.MethodGet, "/auth/hello", alice)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, ReasonRevoked, gjson.Get(body, "code").String())
+	code, _, errorCode := lifetimeRefresh(handler, aliceRefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, ReasonRevoked, errorCode)
+
+	// Tokens of the next second are not affected
+	now = now.Add(time.Second)
+	alice, _ = loginTokens(t, handler, "alice", nil)
+	code, _ = sessionRequest(handler, http.MethodGet, "/auth/hello", alice)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestAccessWatermarkSubjectFromClaims(t *testing.T) {
+	now := time.Now()
+	var events []*Event
+	authMiddleware := newWatermarkMiddleware(t, &now, &events)
+	handler := watermarkHandler(authMiddleware)
+
+	var calls int
+	authMiddleware.SubjectFunc = func(data any) string {
+		calls++
+		return data.(string)
+	}
+	alice, _ := loginTokens(t, handler, "alice", nil)
+	calls = 0
+
+	require.NoError(t, authMiddleware.RevokeTokensIssuedBefore(
+		context.Background(), "alice", now.Add(time.Second),
+	))
+	code, body := sessionRequest(handler, http.MethodGet, "/auth/hello", alice)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, ReasonRevoked, gjson.Get(body, "code").String())
+	assert.Zero(t, calls, "requests read the subject from the token")
+}
+
+func TestRevocationWatermarkNotSupported(t *testing.T) {
+	_, err := New(&GinJWTMiddleware{
+		Realm:                     "test zone",
+		Key:                       key,
+		RefreshTokenStore:         plainTokenStore{store.NewInMemoryRefreshTokenStore()},
+		EnableRevocationWatermark: true,
+	})
+	assert.ErrorIs(t, err, ErrRevocationWatermarkNotSupported)
+
+	authMiddleware, err := New(&GinJWTMiddleware{
+		Realm: "test zone",
+		Key:   key,
+	})
+	require.NoError(t, err)
+	err = authMiddleware.RevokeTokensIssuedBefore(context.Background(), "", time.Now())
+	assert.ErrorIs(t, err, ErrRevocationWatermarkNotSupported)
+}
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// LoginAttempt holds the failed-login state tracked for a single key,
+// such as a username or a client IP address
+type LoginAttempt struct {
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// IsLocked checks if the key is locked out at the given time
+func (a *LoginAttempt) IsLocked(now time.Time) bool {
+	return now.Before(a.LockedUntil)
+}
+
+// LoginAttemptStore defines the interface for tracking failed login attempts
+type LoginAttemptStore interface {
+	// Get returns the attempt state of key
+	// Returns a zero LoginAttempt if nothing is recorded for key
+	Get(ctx context.Context, key string) (*LoginAttempt, error)
+
+	// AddFailure atomically increments the failure counter of key and returns the new count
+	// The counter is forgotten once window has elapsed without another failure
+	AddFailure(ctx context.Context, key string, window time.Duration) (int, error)
+
+	// Lock locks key out until the given time
+	Lock(ctx context.Context, key string, until time.Time) error
+
+	// Reset clears the failure counter and lockout of key
+	// Should not error if nothing is recorded for key
+	Reset(ctx context.Context, key string) error
+}
@@ -0,0 +1,14 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// ReplayStore records single-use identifiers, such as the jti of DPoP proofs,
+// so that a replayed value can be detected
+type ReplayStore interface {
+	// Use atomically records key until expiry
+	// Returns false if key is already recorded and has not expired
+	Use(ctx context.Context, key string, expiry time.Time) (bool, error)
+}
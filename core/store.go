@@ -15,6 +15,16 @@ var (
 	ErrRefreshTokenExpired = errors.New("refresh token expired")
 )
 
+// Kinds of the entries kept in a token store that are not refresh tokens
+const (
+	// KindMFAPending marks the user data of a login waiting for its second factor
+	KindMFAPending = "mfa_pending"
+	// KindDPoPBinding marks the DPoP key thumbprint a refresh token is bound to
+	KindDPoPBinding = "dpop_binding"
+	// KindRevokedSession marks a session whose access tokens are refused until they expire
+	KindRevokedSession = "revoked_session"
+)
+
 // TokenStore defines the interface for storing and retrieving refresh tokens
 type TokenStore interface {
 	// Set stores a refresh token with associated user data and expiration
@@ -38,11 +48,129 @@ type TokenStore interface {
 	Count(ctx context.Context) (int, error)
 }
 
+// DataStore is implemented by token stores that keep the complete RefreshTokenData of a
+// refresh token, so that the session it belongs to can be carried across rotations
+type DataStore interface {
+	// SetData stores a refresh token with data, which expires at data.Expiry
+	// Created defaults to the current time when zero
+	SetData(ctx context.Context, token string, data *RefreshTokenData) error
+
+	// GetData retrieves the data stored with a refresh token
+	// Returns ErrRefreshTokenNotFound if token doesn't exist, is expired, or was rotated
+	GetData(ctx context.Context, token string) (*RefreshTokenData, error)
+}
+
+// SessionStore is implemented by token stores that index refresh tokens by subject,
+// so that the sessions of a user can be listed and limited
+// Only refresh tokens stored with SetData and a Subject are indexed
+type SessionStore interface {
+	// Sessions returns the valid refresh tokens of subject, oldest session first
+	// Rotated tokens kept for their grace period are not listed
+	Sessions(ctx context.Context, subject string) ([]Session, error)
+}
+
+// Session is a refresh token listed by SessionStore
+type Session struct {
+	Token string
+	Data  *RefreshTokenData
+}
+
+// WatermarkStore is implemented by token stores that keep revocation watermarks: the tokens
+// of a subject issued before its watermark, or the tokens of everyone issued before the
+// global watermark, are revoked
+type WatermarkStore interface {
+	// SetWatermark sets the watermark of subject, or the global watermark when subject is empty
+	SetWatermark(ctx context.Context, subject string, watermark time.Time) error
+	// Watermark returns the later of the global watermark and the watermark of subject,
+	// or the zero time when neither is set
+	Watermark(ctx context.Context, subject string) (time.Time, error)
+}
+
+// ConsumeStore is implemented by token stores that can redeem a refresh token atomically,
+// so that concurrent requests cannot both exchange the same refresh token
+type ConsumeStore interface {
+	// Consume retrieves the user data of a refresh token and deletes it in one operation
+	// Returns ErrRefreshTokenNotFound if token doesn't exist, is expired,
+	// or was consumed by another caller first
+	Consume(ctx context.Context, token string) (any, error)
+}
+
+// RotationStore is implemented by token stores that remember the successor of a rotated
+// refresh token for a grace period, so that a refresh repeated by a concurrent request
+// gets the same token pair instead of failing
+type RotationStore interface {
+	// Rotate marks token as replaced by successor
+	// Get then treats token as not found, while Rotated returns successor until graceExpiry
+	// Returns ErrRefreshTokenNotFound if token doesn't exist or is expired
+	Rotate(ctx context.Context, token string, successor *Token, graceExpiry time.Time) error
+
+	// Rotated returns the token pair that replaced token
+	// Returns ErrRefreshTokenNotFound if token was not rotated or its grace period is over
+	Rotated(ctx context.Context, token string) (*Token, error)
+}
+
 // RefreshTokenData holds the data stored with each refresh token
 type RefreshTokenData struct {
 	UserData any       `json:"user_data"`
 	Expiry   time.Time `json:"expiry"`
 	Created  time.Time `json:"created"`
+
+	// SessionStart is the time of the login the refresh token descends from,
+	// kept by every token that replaces it
+	SessionStart time.Time `json:"session_start,omitzero"`
+
+	// SessionID identifies the login the refresh token descends from,
+	// kept by every token that replaces it
+	SessionID string `json:"session_id,omitempty"`
+
+	// Subject identifies the user of the refresh token, for stores indexing sessions by user
+	Subject string `json:"subject,omitempty"`
+
+	// Metadata describes the device of the session, when the middleware records it
+	Metadata *SessionMetadata `json:"metadata,omitempty"`
+
+	// Timeout is the refresh token lifetime chosen at login, kept by the tokens replacing it
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// SessionCookie reports that the refresh token is kept in a browser-session cookie
+	SessionCookie bool `json:"session_cookie,omitempty"`
+
+	// RotatedTo is the token pair that replaced a rotated refresh token
+	RotatedTo *Token `json:"rotated_to,omitempty"`
+
+	// Kind is empty for refresh tokens, and marks the other entries sharing the store,
+	// such as KindMFAPending, which must never be exchanged as refresh tokens
+	Kind string `json:"kind,omitempty"`
+}
+
+// SessionMetadata describes the device a refresh token was issued to
+type SessionMetadata struct {
+	UserAgent string `json:"user_agent,omitempty"`
+	ClientIP  string `json:"client_ip,omitempty"`
+	// DeviceName is a name supplied by the client, e.g. "Work laptop"
+	DeviceName string `json:"device_name,omitempty"`
+	// LastUsed is the time of the login or of the last refresh
+	LastUsed time.Time `json:"last_used,omitzero"`
+	// RefreshCount is the number of refreshes since the login
+	RefreshCount int `json:"refresh_count,omitempty"`
+	// Extra holds application-specific values, e.g. a location
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+// Clone returns a deep copy of the metadata
+func (m *SessionMetadata) Clone() *SessionMetadata {
+	if m == nil {
+		return nil
+	}
+
+	clone := *m
+	if m.Extra != nil {
+		clone.Extra = make(map[string]string, len(m.Extra))
+		for key, value := range m.Extra {
+			clone.Extra[key] = value
+		}
+	}
+	return &clone
 }
 
 // IsExpired checks if the token data has expired
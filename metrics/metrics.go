@@ -0,0 +1,304 @@
+// Package metrics provides a dependency-free metrics registry for gin-jwt,
+// exported through expvar and the Prometheus text exposition format
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram upper bounds in seconds, matching the Prometheus client defaults
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type counter struct {
+	labels map[string]string
+	value  uint64
+}
+
+type histogram struct {
+	labels map[string]string
+	counts []uint64 // cumulative per bucket is computed on export
+	sum    float64
+	count  uint64
+}
+
+// Registry collects counters, histograms and gauges in memory
+// It is safe for concurrent use
+type Registry struct {
+	buckets []float64
+
+	mu         sync.Mutex
+	counters   map[string]map[string]*counter
+	histograms map[string]map[string]*histogram
+	gauges     map[string]func() float64
+}
+
+// NewRegistry creates a new registry using DefaultBuckets for histograms
+func NewRegistry() *Registry {
+	return NewRegistryWithBuckets(DefaultBuckets)
+}
+
+// NewRegistryWithBuckets creates a new registry with custom histogram upper bounds in seconds
+func NewRegistryWithBuckets(buckets []float64) *Registry {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	return &Registry{
+		buckets:    sorted,
+		counters:   make(map[string]map[string]*counter),
+		histograms: make(map[string]map[string]*histogram),
+		gauges:     make(map[string]func() float64),
+	}
+}
+
+// IncCounter increments the counter name for the given labels
+func (r *Registry) IncCounter(name string, labels map[string]string) {
+	key := seriesKey(labels)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	series, ok := r.counters[name]
+	if !ok {
+		series = make(map[string]*counter)
+		r.counters[name] = series
+	}
+
+	c, ok := series[key]
+	if !ok {
+		c = &counter{labels: copyLabels(labels)}
+		series[key] = c
+	}
+	c.value++
+}
+
+// ObserveDuration records d in the histogram name for the given labels
+func (r *Registry) ObserveDuration(name string, d time.Duration, labels map[string]string) {
+	key := seriesKey(labels)
+	seconds := d.Seconds()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	series, ok := r.histograms[name]
+	if !ok {
+		series = make(map[string]*histogram)
+		r.histograms[name] = series
+	}
+
+	h, ok := series[key]
+	if !ok {
+		h = &histogram{labels: copyLabels(labels), counts: make([]uint64, len(r.buckets))}
+		series[key] = h
+	}
+
+	for i, bound := range r.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// RegisterGauge registers a gauge whose value is read from fn when metrics are collected
+func (r *Registry) RegisterGauge(name string, fn func() float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.gauges[name] = fn
+}
+
+// Counter returns the current value of a counter series, mostly useful in tests
+func (r *Registry) Counter(name string, labels map[string]string) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.counters[name][seriesKey(labels)]; ok {
+		return c.value
+	}
+	return 0
+}
+
+// HistogramCount returns the number of observations of a histogram series
+func (r *Registry) HistogramCount(name string, labels map[string]string) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if h, ok := r.histograms[name][seriesKey(labels)]; ok {
+		return h.count
+	}
+	return 0
+}
+
+// gaugeFuncs returns a copy of the gauges so they can be read without holding the lock,
+// as they may perform I/O such as counting tokens in Redis
+func (r *Registry) gaugeFuncs() map[string]func() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	gauges := make(map[string]func() float64, len(r.gauges))
+	for name, fn := range r.gauges {
+		gauges[name] = fn
+	}
+	return gauges
+}
+
+// WritePrometheus writes all metrics in the Prometheus text exposition format (version 0.0.4)
+func (r *Registry) WritePrometheus(w io.Writer) {
+	gauges := r.gaugeFuncs()
+	gaugeValues := make(map[string]float64, len(gauges))
+	for name, fn := range gauges {
+		gaugeValues[name] = fn()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, name := range sortedKeys(r.counters) {
+		fmt.Fprintf(w, "# TYPE %s counter\n", name)
+		series := r.counters[name]
+		for _, key := range sortedKeys(series) {
+			c := series[key]
+			fmt.Fprintf(w, "%s%s %d\n", name, formatLabels(c.labels, ""), c.value)
+		}
+	}
+
+	for _, name := range sortedKeys(r.histograms) {
+		fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+		series := r.histograms[name]
+		for _, key := range sortedKeys(series) {
+			h := series[key]
+			var cumulative uint64
+			for i, bound := range r.buckets {
+				cumulative += h.counts[i]
+				le := strconv.FormatFloat(bound, 'g', -1, 64)
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(h.labels, le), cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(h.labels, "+Inf"), h.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(h.labels, ""), formatFloat(h.sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(h.labels, ""), h.count)
+		}
+	}
+
+	for _, name := range sortedKeys(gaugeValues) {
+		fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(w, "%s %s\n", name, formatFloat(gaugeValues[name]))
+	}
+}
+
+// Handler returns an http.Handler serving the metrics in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+}
+
+// Snapshot returns all metrics as a JSON-friendly map, as published by expvar
+func (r *Registry) Snapshot() map[string]any {
+	gauges := r.gaugeFuncs()
+	snapshot := make(map[string]any)
+	for name, fn := range gauges {
+		snapshot[name] = fn()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, series := range r.counters {
+		values := make(map[string]uint64, len(series))
+		for key, c := range series {
+			values[key] = c.value
+		}
+		snapshot[name] = values
+	}
+
+	for name, series := range r.histograms {
+		values := make(map[string]any, len(series))
+		for key, h := range series {
+			values[key] = map[string]any{"count": h.count, "sum": h.sum}
+		}
+		snapshot[name] = values
+	}
+
+	return snapshot
+}
+
+// PublishExpvar publishes the registry under name in expvar, served at /debug/vars
+// It panics if name is already published, like expvar.Publish
+func (r *Registry) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return r.Snapshot()
+	}))
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
+
+// seriesKey builds a stable identifier of a label set, e.g. `outcome="success",reason="expired"`
+func seriesKey(labels map[string]string) string {
+	keys := sortedKeys(labels)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"=\""+escapeLabelValue(labels[k])+"\"")
+	}
+	return strings.Join(parts, ",")
+}
+
+// formatLabels renders labels in braces, appending le for histogram buckets
+func formatLabels(labels map[string]string, le string) string {
+	key := seriesKey(labels)
+	if le != "" {
+		if key != "" {
+			key += ","
+		}
+		key += "le=\"" + le + "\""
+	}
+	if key == "" {
+		return ""
+	}
+	return "{" + key + "}"
+}
+
+func escapeLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryCounter(t *testing.T) {
+	r := NewRegistry()
+
+	r.IncCounter("logins_total", map[string]string{"outcome": "success"})
+	r.IncCounter("logins_total", map[string]string{"outcome": "success"})
+	r.IncCounter("logins_total", map[string]string{"outcome": "failure", "reason": "invalid"})
+
+	assert.Equal(t, uint64(2), r.Counter("logins_total", map[string]string{"outcome": "success"}))
+	assert.Equal(
+		t,
+		uint64(1),
+		r.Counter("logins_total", map[string]string{"reason": "invalid", "outcome": "failure"}),
+	)
+	assert.Equal(t, uint64(0), r.Counter("logins_total", map[string]string{"outcome": "locked"}))
+}
+
+func TestRegistryPrometheusHandler(t *testing.T) {
+	r := NewRegistryWithBuckets([]float64{0.1, 0.01})
+
+	r.IncCounter("logins_total", map[string]string{"outcome": "success"})
+	r.ObserveDuration("store_seconds", 5*time.Millisecond, map[string]string{"operation": "get"})
+	r.ObserveDuration("store_seconds", 50*time.Millisecond, map[string]string{"operation": "get"})
+	r.ObserveDuration("store_seconds", time.Second, map[string]string{"operation": "get"})
+	r.RegisterGauge("tokens", func() float64 { return 42 })
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, strings.Join([]string{
+		`# TYPE logins_total counter`,
+		`logins_total{outcome="success"} 1`,
+		`# TYPE store_seconds histogram`,
+		`store_seconds_bucket{operation="get",le="0.01"} 1`,
+		`store_seconds_bucket{operation="get",le="0.1"} 2`,
+		`store_seconds_bucket{operation="get",le="+Inf"} 3`,
+		`store_seconds_sum{operation="get"} 1.055`,
+		`store_seconds_count{operation="get"} 3`,
+		`# TYPE tokens gauge`,
+		`tokens 42`,
+		``,
+	}, "\n"), w.Body.String())
+}
+
+func TestRegistryLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.IncCounter("errors_total", map[string]string{"reason": "a \"quoted\"\nvalue\\"})
+
+	var b strings.Builder
+	r.WritePrometheus(&b)
+	assert.Contains(t, b.String(), `errors_total{reason="a \"quoted\"\nvalue\\"} 1`)
+}
+
+// expvarRuns makes the published names unique, as expvar panics on a name published
+// twice and the test may run more than once with -count
+var expvarRuns atomic.Int64
+
+func TestRegistryPublishExpvar(t *testing.T) {
+	name := fmt.Sprintf("%s_%d", t.Name(), expvarRuns.Add(1))
+
+	r := NewRegistry()
+	r.IncCounter("logins_total", map[string]string{"outcome": "success"})
+	r.RegisterGauge("tokens", func() float64 { return 3 })
+	r.PublishExpvar(name)
+
+	v := expvar.Get(name)
+	require.NotNil(t, v)
+
+	var snapshot map[string]any
+	require.NoError(t, json.Unmarshal([]byte(v.String()), &snapshot))
+	assert.Equal(t, float64(3), snapshot["tokens"])
+	assert.Equal(t, map[string]any{`outcome="success"`: float64(1)}, snapshot["logins_total"])
+}
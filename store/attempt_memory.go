@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+)
+
+var _ core.LoginAttemptStore = &InMemoryLoginAttemptStore{}
+
+type memoryLoginAttempt struct {
+	failures    int
+	expiry      time.Time
+	lockedUntil time.Time
+}
+
+// InMemoryLoginAttemptStore provides a simple in-memory login attempt store
+// This implementation is thread-safe and suitable for single-instance applications
+type InMemoryLoginAttemptStore struct {
+	attempts map[string]*memoryLoginAttempt
+	mu       sync.Mutex
+}
+
+// NewInMemoryLoginAttemptStore creates a new in-memory login attempt store
+func NewInMemoryLoginAttemptStore() *InMemoryLoginAttemptStore {
+	return &InMemoryLoginAttemptStore{
+		attempts: make(map[string]*memoryLoginAttempt),
+	}
+}
+
+// entry returns the live entry of key, dropping it if both counter and lockout have expired
+// Callers must hold s.mu
+func (s *InMemoryLoginAttemptStore) entry(key string, now time.Time) *memoryLoginAttempt {
+	attempt, exists := s.attempts[key]
+	if !exists {
+		return nil
+	}
+
+	if now.After(attempt.expiry) {
+		attempt.failures = 0
+	}
+
+	if attempt.failures == 0 && !now.Before(attempt.lockedUntil) {
+		delete(s.attempts, key)
+		return nil
+	}
+
+	return attempt
+}
+
+// Get returns the attempt state of key
+func (s *InMemoryLoginAttemptStore) Get(ctx context.Context, key string) (*core.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt := s.entry(key, time.Now())
+	if attempt == nil {
+		return &core.LoginAttempt{}, nil
+	}
+
+	return &core.LoginAttempt{
+		Failures:    attempt.failures,
+		LockedUntil: attempt.lockedUntil,
+	}, nil
+}
+
+// AddFailure increments the failure counter of key and returns the new count
+func (s *InMemoryLoginAttemptStore) AddFailure(
+	ctx context.Context,
+	key string,
+	window time.Duration,
+) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	attempt := s.entry(key, now)
+	if attempt == nil {
+		attempt = &memoryLoginAttempt{}
+		s.attempts[key] = attempt
+	}
+
+	attempt.failures++
+	attempt.expiry = now.Add(window)
+
+	return attempt.failures, nil
+}
+
+// Lock locks key out until the given time
+func (s *InMemoryLoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt := s.entry(key, time.Now())
+	if attempt == nil {
+		attempt = &memoryLoginAttempt{}
+		s.attempts[key] = attempt
+	}
+
+	attempt.lockedUntil = until
+	return nil
+}
+
+// Reset clears the failure counter and lockout of key
+func (s *InMemoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
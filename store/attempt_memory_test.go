@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryLoginAttemptStore_AddFailure(t *testing.T) {
+	store := NewInMemoryLoginAttemptStore()
+	ctx := context.Background()
+
+	attempt, err := store.Get(ctx, "user:admin")
+	require.NoError(t, err)
+	assert.Equal(t, 0, attempt.Failures)
+	assert.True(t, attempt.LockedUntil.IsZero())
+
+	for i := 1; i <= 3; i++ {
+		failures, err := store.AddFailure(ctx, "user:admin", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, i, failures)
+	}
+
+	attempt, err = store.Get(ctx, "user:admin")
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempt.Failures)
+}
+
+func TestInMemoryLoginAttemptStore_WindowExpiry(t *testing.T) {
+	store := NewInMemoryLoginAttemptStore()
+	ctx := context.Background()
+
+	_, err := store.AddFailure(ctx, "ip:10.0.0.1", 10*time.Millisecond)
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+
+	failures, err := store.AddFailure(ctx, "ip:10.0.0.1", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures, "counter should restart after the window")
+}
+
+func TestInMemoryLoginAttemptStore_LockAndReset(t *testing.T) {
+	store := NewInMemoryLoginAttemptStore()
+	ctx := context.Background()
+	until := time.Now().Add(time.Minute)
+
+	require.NoError(t, store.Lock(ctx, "user:admin", until))
+
+	attempt, err := store.Get(ctx, "user:admin")
+	require.NoError(t, err)
+	assert.True(t, attempt.IsLocked(time.Now()))
+	assert.True(t, until.Equal(attempt.LockedUntil))
+
+	require.NoError(t, store.Reset(ctx, "user:admin"))
+	require.NoError(t, store.Reset(ctx, "user:unknown"))
+
+	attempt, err = store.Get(ctx, "user:admin")
+	require.NoError(t, err)
+	assert.False(t, attempt.IsLocked(time.Now()))
+}
+
+func TestInMemoryLoginAttemptStore_ConcurrentAccess(t *testing.T) {
+	store := NewInMemoryLoginAttemptStore()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = store.AddFailure(ctx, "user:admin", time.Minute)
+		}()
+	}
+	wg.Wait()
+
+	attempt, err := store.Get(ctx, "user:admin")
+	require.NoError(t, err)
+	assert.Equal(t, 50, attempt.Failures)
+}
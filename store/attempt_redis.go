@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/redis/rueidis"
+)
+
+var _ core.LoginAttemptStore = &RedisLoginAttemptStore{}
+
+// RedisLoginAttemptStore provides a Redis-based login attempt store shared by all instances
+type RedisLoginAttemptStore struct {
+	client rueidis.Client
+	prefix string
+}
+
+// NewRedisLoginAttemptStore creates a new Redis-based login attempt store
+// It uses the same connection settings as the refresh token store. Keys are written
+// under "<KeyPrefix>-attempts:" so they never show up in refresh token Count or Cleanup.
+func NewRedisLoginAttemptStore(config *RedisConfig) (*RedisLoginAttemptStore, error) {
+	if config == nil {
+		config = DefaultRedisConfig()
+	}
+
+	client, err := newRedisClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedisLoginAttemptStore{
+		client: client,
+		prefix: strings.TrimSuffix(config.KeyPrefix, ":") + "-attempts:",
+	}, nil
+}
+
+// Close closes the Redis client connection
+func (s *RedisLoginAttemptStore) Close() error {
+	s.client.Close()
+	return nil
+}
+
+func (s *RedisLoginAttemptStore) failuresKey(key string) string {
+	return s.prefix + key + ":failures"
+}
+
+func (s *RedisLoginAttemptStore) lockKey(key string) string {
+	return s.prefix + key + ":lock"
+}
+
+// Get returns the attempt state of key
+func (s *RedisLoginAttemptStore) Get(ctx context.Context, key string) (*core.LoginAttempt, error) {
+	cmd := s.client.B().Mget().Key(s.failuresKey(key), s.lockKey(key)).Build()
+	values, err := s.client.Do(ctx, cmd).ToArray()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login attempts from Redis: %w", err)
+	}
+
+	attempt := &core.LoginAttempt{}
+	if len(values) != 2 {
+		return attempt, nil
+	}
+
+	if failures, err := values[0].AsInt64(); err == nil {
+		attempt.Failures = int(failures)
+	} else if !rueidis.IsRedisNil(err) {
+		return nil, fmt.Errorf("failed to parse login failures: %w", err)
+	}
+
+	if lockedUntil, err := values[1].ToString(); err == nil {
+		ms, err := strconv.ParseInt(lockedUntil, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse login lockout: %w", err)
+		}
+		attempt.LockedUntil = time.UnixMilli(ms)
+	} else if !rueidis.IsRedisNil(err) {
+		return nil, fmt.Errorf("failed to parse login lockout: %w", err)
+	}
+
+	return attempt, nil
+}
+
+// AddFailure atomically increments the failure counter of key and returns the new count
+func (s *RedisLoginAttemptStore) AddFailure(
+	ctx context.Context,
+	key string,
+	window time.Duration,
+) (int, error) {
+	if window <= 0 {
+		return 0, errors.New("attempt window must be positive")
+	}
+
+	k := s.failuresKey(key)
+	results := s.client.DoMulti(ctx,
+		s.client.B().Incr().Key(k).Build(),
+		s.client.B().Pexpire().Key(k).Milliseconds(window.Milliseconds()).Build(),
+	)
+
+	failures, err := results[0].AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record login failure in Redis: %w", err)
+	}
+	if err := results[1].Error(); err != nil {
+		return 0, fmt.Errorf("failed to set login failure expiry in Redis: %w", err)
+	}
+
+	return int(failures), nil
+}
+
+// Lock locks key out until the given time
+func (s *RedisLoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	if !until.After(time.Now()) {
+		return nil
+	}
+
+	cmd := s.client.B().Set().
+		Key(s.lockKey(key)).
+		Value(strconv.FormatInt(until.UnixMilli(), 10)).
+		Pxat(until).
+		Build()
+	if err := s.client.Do(ctx, cmd).Error(); err != nil {
+		return fmt.Errorf("failed to store login lockout in Redis: %w", err)
+	}
+
+	return nil
+}
+
+// Reset clears the failure counter and lockout of key
+func (s *RedisLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	cmd := s.client.B().Del().Key(s.failuresKey(key), s.lockKey(key)).Build()
+	if err := s.client.Do(ctx, cmd).Error(); err != nil {
+		return fmt.Errorf("failed to reset login attempts in Redis: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisLoginAttemptStore_Integration(t *testing.T) {
+	host, port := setupRedisContainer(t)
+
+	config := &RedisConfig{
+		Addr:      fmt.Sprintf("%s:%s", host, port),
+		KeyPrefix: "test-jwt:",
+	}
+
+	attempts, err := NewRedisLoginAttemptStore(config)
+	require.NoError(t, err, "failed to create Redis login attempt store")
+	defer attempts.Close()
+
+	tokens, err := NewRedisRefreshTokenStore(config)
+	require.NoError(t, err, "failed to create Redis store")
+	defer tokens.Close()
+
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		failures, err := attempts.AddFailure(ctx, "user:admin", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, i, failures)
+	}
+
+	until := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+	require.NoError(t, attempts.Lock(ctx, "user:admin", until))
+
+	attempt, err := attempts.Get(ctx, "user:admin")
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempt.Failures)
+	assert.True(t, until.Equal(attempt.LockedUntil))
+
+	// Attempt keys must not be counted as refresh tokens
+	count, err := tokens.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	require.NoError(t, attempts.Reset(ctx, "user:admin"))
+	attempt, err = attempts.Get(ctx, "user:admin")
+	require.NoError(t, err)
+	assert.Equal(t, 0, attempt.Failures)
+	assert.True(t, attempt.LockedUntil.IsZero())
+}
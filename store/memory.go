@@ -9,20 +9,33 @@ import (
 	"github.com/appleboy/gin-jwt/v3/core"
 )
 
-var _ core.TokenStore = &InMemoryRefreshTokenStore{}
+var (
+	_ core.TokenStore     = &InMemoryRefreshTokenStore{}
+	_ core.DataStore      = &InMemoryRefreshTokenStore{}
+	_ core.SessionStore   = &InMemoryRefreshTokenStore{}
+	_ core.ConsumeStore   = &InMemoryRefreshTokenStore{}
+	_ core.RotationStore  = &InMemoryRefreshTokenStore{}
+	_ core.WatermarkStore = &InMemoryRefreshTokenStore{}
+)
 
 // InMemoryRefreshTokenStore provides a simple in-memory refresh token store
 // This implementation is thread-safe and suitable for single-instance applications
 // For distributed systems, consider using Redis or database-based implementations
 type InMemoryRefreshTokenStore struct {
 	tokens map[string]*core.RefreshTokenData
-	mu     sync.RWMutex
+	// subjects indexes the tokens by RefreshTokenData.Subject
+	subjects map[string]map[string]struct{}
+	// watermarks holds the revocation watermarks by subject, "" for the global one
+	watermarks map[string]time.Time
+	mu         sync.RWMutex
 }
 
 // NewInMemoryRefreshTokenStore creates a new in-memory refresh token store
 func NewInMemoryRefreshTokenStore() *InMemoryRefreshTokenStore {
 	return &InMemoryRefreshTokenStore{
-		tokens: make(map[string]*core.RefreshTokenData),
+		tokens:     make(map[string]*core.RefreshTokenData),
+		subjects:   make(map[string]map[string]struct{}),
+		watermarks: make(map[string]time.Time),
 	}
 }
 
@@ -32,25 +45,129 @@ func (s *InMemoryRefreshTokenStore) Set(
 	token string,
 	userData any,
 	expiry time.Time,
+) error {
+	return s.SetData(ctx, token, &core.RefreshTokenData{
+		UserData: userData,
+		Expiry:   expiry,
+	})
+}
+
+// SetData stores a refresh token with its complete data
+func (s *InMemoryRefreshTokenStore) SetData(
+	ctx context.Context,
+	token string,
+	data *core.RefreshTokenData,
 ) error {
 	if token == "" {
 		return errors.New("token cannot be empty")
 	}
 
+	stored := copyData(data)
+	if stored.Created.IsZero() {
+		stored.Created = time.Now()
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.tokens[token] = &core.RefreshTokenData{
-		UserData: userData,
-		Expiry:   expiry,
-		Created:  time.Now(),
+	s.remove(token)
+	s.tokens[token] = stored
+	if stored.Subject != "" {
+		if s.subjects[stored.Subject] == nil {
+			s.subjects[stored.Subject] = make(map[string]struct{})
+		}
+		s.subjects[stored.Subject][token] = struct{}{}
+	}
+	return nil
+}
+
+// remove deletes a token and its index entry, the caller must hold the lock
+func (s *InMemoryRefreshTokenStore) remove(token string) {
+	data, exists := s.tokens[token]
+	if !exists {
+		return
+	}
+
+	delete(s.tokens, token)
+	if tokens := s.subjects[data.Subject]; tokens != nil {
+		delete(tokens, token)
+		if len(tokens) == 0 {
+			delete(s.subjects, data.Subject)
+		}
 	}
+}
+
+// SetWatermark sets the revocation watermark of subject, or the global one when subject is empty
+func (s *InMemoryRefreshTokenStore) SetWatermark(
+	ctx context.Context,
+	subject string,
+	watermark time.Time,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
+	s.watermarks[subject] = watermark
 	return nil
 }
 
+// Watermark returns the later of the global revocation watermark and the one of subject
+func (s *InMemoryRefreshTokenStore) Watermark(
+	ctx context.Context,
+	subject string,
+) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	watermark := s.watermarks[""]
+	if subjectWatermark := s.watermarks[subject]; subjectWatermark.After(watermark) {
+		watermark = subjectWatermark
+	}
+	return watermark, nil
+}
+
+// Sessions returns the valid refresh tokens of subject, oldest session first
+func (s *InMemoryRefreshTokenStore) Sessions(
+	ctx context.Context,
+	subject string,
+) ([]core.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make([]core.Session, 0, len(s.subjects[subject]))
+	for token := range s.subjects[subject] {
+		data := s.tokens[token]
+		if data == nil || data.RotatedTo != nil || data.IsExpired() {
+			continue
+		}
+		stored := copyData(data)
+		sessions = append(sessions, core.Session{Token: token, Data: stored})
+	}
+
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+// copyData returns a copy of data that does not share its metadata
+func copyData(data *core.RefreshTokenData) *core.RefreshTokenData {
+	stored := *data
+	stored.Metadata = data.Metadata.Clone()
+	return &stored
+}
+
 // Get retrieves user data associated with a refresh token
 func (s *InMemoryRefreshTokenStore) Get(ctx context.Context, token string) (any, error) {
+	data, err := s.GetData(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return data.UserData, nil
+}
+
+// GetData retrieves the complete data of a refresh token
+func (s *InMemoryRefreshTokenStore) GetData(
+	ctx context.Context,
+	token string,
+) (*core.RefreshTokenData, error) {
 	if token == "" {
 		return nil, ErrRefreshTokenNotFound
 	}
@@ -59,21 +176,81 @@ func (s *InMemoryRefreshTokenStore) Get(ctx context.Context, token string) (any,
 	data, exists := s.tokens[token]
 	s.mu.RUnlock()
 
-	if !exists {
+	if !exists || data.RotatedTo != nil {
 		return nil, core.ErrRefreshTokenNotFound
 	}
 
 	if data.IsExpired() {
-		// Clean up expired token
+		// Clean up expired token, unless a concurrent Set replaced it since the read
 		s.mu.Lock()
-		delete(s.tokens, token)
+		if s.tokens[token] == data {
+			s.remove(token)
+		}
 		s.mu.Unlock()
 		return nil, core.ErrRefreshTokenNotFound
 	}
 
+	stored := copyData(data)
+	return stored, nil
+}
+
+// Consume retrieves and deletes a refresh token under the store lock
+func (s *InMemoryRefreshTokenStore) Consume(ctx context.Context, token string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.tokens[token]
+	if !exists || data.RotatedTo != nil {
+		return nil, core.ErrRefreshTokenNotFound
+	}
+
+	s.remove(token)
+	if data.IsExpired() {
+		return nil, core.ErrRefreshTokenNotFound
+	}
 	return data.UserData, nil
 }
 
+// Rotate marks a refresh token as replaced by successor until graceExpiry
+func (s *InMemoryRefreshTokenStore) Rotate(
+	ctx context.Context,
+	token string,
+	successor *core.Token,
+	graceExpiry time.Time,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.tokens[token]
+	if !exists || data.RotatedTo != nil || data.IsExpired() {
+		return core.ErrRefreshTokenNotFound
+	}
+
+	s.remove(token)
+	s.tokens[token] = &core.RefreshTokenData{
+		Expiry:    graceExpiry,
+		Created:   data.Created,
+		RotatedTo: successor,
+	}
+	return nil
+}
+
+// Rotated returns the token pair that replaced a refresh token within its grace period
+func (s *InMemoryRefreshTokenStore) Rotated(
+	ctx context.Context,
+	token string,
+) (*core.Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, exists := s.tokens[token]
+	if !exists || data.RotatedTo == nil || data.IsExpired() {
+		return nil, core.ErrRefreshTokenNotFound
+	}
+
+	return data.RotatedTo, nil
+}
+
 // Delete removes a refresh token from storage
 func (s *InMemoryRefreshTokenStore) Delete(ctx context.Context, token string) error {
 	if token == "" {
@@ -83,7 +260,7 @@ func (s *InMemoryRefreshTokenStore) Delete(ctx context.Context, token string) er
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	delete(s.tokens, token)
+	s.remove(token)
 	return nil
 }
 
@@ -97,7 +274,7 @@ func (s *InMemoryRefreshTokenStore) Cleanup(ctx context.Context) (int, error) {
 
 	for token, data := range s.tokens {
 		if now.After(data.Expiry) {
-			delete(s.tokens, token)
+			s.remove(token)
 			cleaned++
 		}
 	}
@@ -106,11 +283,18 @@ func (s *InMemoryRefreshTokenStore) Cleanup(ctx context.Context) (int, error) {
 }
 
 // Count returns the total number of active refresh tokens
+// Rotated tokens kept for their grace period and entries of another Kind are not counted
 func (s *InMemoryRefreshTokenStore) Count(ctx context.Context) (int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return len(s.tokens), nil
+	var count int
+	for _, data := range s.tokens {
+		if data.RotatedTo == nil && data.Kind == "" {
+			count++
+		}
+	}
+	return count, nil
 }
 
 // GetAll returns all active tokens (for debugging/monitoring purposes)
@@ -123,12 +307,9 @@ func (s *InMemoryRefreshTokenStore) GetAll() map[string]*core.RefreshTokenData {
 	// Create a copy to prevent external modifications
 	result := make(map[string]*core.RefreshTokenData)
 	for token, data := range s.tokens {
-		if !data.IsExpired() {
-			result[token] = &core.RefreshTokenData{
-				UserData: data.UserData,
-				Expiry:   data.Expiry,
-				Created:  data.Created,
-			}
+		if !data.IsExpired() && data.RotatedTo == nil && data.Kind == "" {
+			stored := copyData(data)
+			result[token] = stored
 		}
 	}
 
@@ -142,4 +323,5 @@ func (s *InMemoryRefreshTokenStore) Clear() {
 	defer s.mu.Unlock()
 
 	s.tokens = make(map[string]*core.RefreshTokenData)
+	s.subjects = make(map[string]map[string]struct{})
 }
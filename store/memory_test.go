@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/appleboy/gin-jwt/v3/core"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -388,6 +389,253 @@ func TestInMemoryRefreshTokenStore_ConcurrentAccess(t *testing.T) {
 	}
 }
 
+func TestInMemoryRefreshTokenStore_GetExpiredConcurrentSet(t *testing.T) {
+	store := NewInMemoryRefreshTokenStore()
+	ctx := context.Background()
+	user := &User{ID: "123"}
+
+	// The cleanup of an expired token must not delete a token Set in the meantime
+	for i := 0; i < 1000; i++ {
+		token := fmt.Sprintf("token%d", i)
+		_ = store.Set(ctx, token, user, time.Now().Add(-time.Hour))
+
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			_, _ = store.GetData(ctx, token)
+		})
+		wg.Go(func() {
+			_ = store.Set(ctx, token, user, time.Now().Add(time.Hour))
+		})
+		wg.Wait()
+
+		if _, err := store.Get(ctx, token); err != nil {
+			t.Fatalf("Token %s set after the expired one was deleted: %v", token, err)
+		}
+	}
+}
+
+func TestInMemoryRefreshTokenStore_Data(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryRefreshTokenStore()
+	sessionStart := time.Now().Add(-time.Hour)
+
+	metadata := &core.SessionMetadata{
+		UserAgent: "test-agent",
+		Extra:     map[string]string{"location": "Taipei"},
+	}
+	assert.NoError(t, store.SetData(ctx, "token123", &RefreshTokenData{
+		UserData:     "user",
+		Expiry:       time.Now().Add(time.Hour),
+		SessionStart: sessionStart,
+		Metadata:     metadata,
+	}))
+
+	data, err := store.GetData(ctx, "token123")
+	assert.NoError(t, err)
+	assert.Equal(t, "user", data.UserData)
+	assert.Equal(t, sessionStart, data.SessionStart)
+	assert.False(t, data.Created.IsZero(), "Created defaults to the current time")
+
+	userData, err := store.Get(ctx, "token123")
+	assert.NoError(t, err)
+	assert.Equal(t, "user", userData)
+
+	// The stored and returned data are copies
+	metadata.Extra["location"] = "Tainan"
+	data.UserData = "changed"
+	data.Metadata.UserAgent = "changed"
+	data, err = store.GetData(ctx, "token123")
+	assert.NoError(t, err)
+	assert.Equal(t, "user", data.UserData)
+	assert.Equal(t, "test-agent", data.Metadata.UserAgent)
+	assert.Equal(t, "Taipei", data.Metadata.Extra["location"])
+
+	_, err = store.GetData(ctx, "missing")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	assert.NoError(t, store.Rotate(ctx, "token123", &core.Token{}, time.Now().Add(time.Minute)))
+	_, err = store.GetData(ctx, "token123")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+}
+
+func TestInMemoryRefreshTokenStore_Watermark(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryRefreshTokenStore()
+	now := time.Now()
+
+	watermark, err := store.Watermark(ctx, "user")
+	assert.NoError(t, err)
+	assert.True(t, watermark.IsZero())
+
+	assert.NoError(t, store.SetWatermark(ctx, "user", now.Add(-time.Hour)))
+	watermark, err = store.Watermark(ctx, "user")
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(-time.Hour), watermark)
+
+	// The later of the global and subject watermarks applies
+	assert.NoError(t, store.SetWatermark(ctx, "", now))
+	watermark, err = store.Watermark(ctx, "user")
+	assert.NoError(t, err)
+	assert.Equal(t, now, watermark)
+	watermark, err = store.Watermark(ctx, "other")
+	assert.NoError(t, err)
+	assert.Equal(t, now, watermark)
+}
+
+func TestInMemoryRefreshTokenStore_Sessions(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryRefreshTokenStore()
+	now := time.Now()
+
+	for i, token := range []string{"newest", "middle", "oldest", "consumed", "rotated"} {
+		assert.NoError(t, store.SetData(ctx, token, &RefreshTokenData{
+			UserData:     token,
+			Expiry:       now.Add(time.Hour),
+			SessionStart: now.Add(-time.Duration(i) * time.Minute),
+			Subject:      "alice",
+		}))
+	}
+	assert.NoError(t, store.SetData(ctx, "newest", &RefreshTokenData{
+		Expiry:       now.Add(time.Hour),
+		SessionStart: now,
+		Subject:      "alice",
+	}))
+	assert.NoError(t, store.SetData(ctx, "expired", &RefreshTokenData{
+		Expiry:  now.Add(-time.Hour),
+		Subject: "alice",
+	}))
+	assert.NoError(t, store.Set(ctx, "unindexed", "alice", now.Add(time.Hour)))
+	assert.NoError(t, store.SetData(ctx, "bob", &RefreshTokenData{
+		Expiry:  now.Add(time.Hour),
+		Subject: "bob",
+	}))
+
+	_, err := store.Consume(ctx, "consumed")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Rotate(ctx, "rotated", &core.Token{}, now.Add(time.Minute)))
+	assert.NoError(t, store.Delete(ctx, "middle"))
+	assert.NoError(t, store.SetData(ctx, "middle", &RefreshTokenData{
+		Expiry:       now.Add(time.Hour),
+		SessionStart: now.Add(-time.Minute),
+		Subject:      "alice",
+	}))
+
+	sessions, err := store.Sessions(ctx, "alice")
+	assert.NoError(t, err)
+	tokens := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		tokens = append(tokens, session.Token)
+	}
+	assert.Equal(t, []string{"oldest", "middle", "newest"}, tokens)
+
+	sessions, err = store.Sessions(ctx, "nobody")
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	store.Clear()
+	sessions, err = store.Sessions(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestInMemoryRefreshTokenStore_Consume(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryRefreshTokenStore()
+	user := &User{ID: "123", Username: "testuser"}
+
+	assert.NoError(t, store.Set(ctx, "token123", user, time.Now().Add(time.Hour)))
+
+	data, err := store.Consume(ctx, "token123")
+	assert.NoError(t, err)
+	assert.Equal(t, user, data)
+
+	_, err = store.Consume(ctx, "token123")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound, "a token can only be consumed once")
+	_, err = store.Get(ctx, "token123")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	assert.NoError(t, store.Set(ctx, "expired", user, time.Now().Add(-time.Hour)))
+	_, err = store.Consume(ctx, "expired")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+}
+
+func TestInMemoryRefreshTokenStore_ConsumeConcurrent(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryRefreshTokenStore()
+	assert.NoError(t, store.Set(ctx, "token123", "user", time.Now().Add(time.Hour)))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var redeemed int
+	for range 50 {
+		wg.Go(func() {
+			if _, err := store.Consume(ctx, "token123"); err == nil {
+				mu.Lock()
+				redeemed++
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, redeemed)
+}
+
+func TestInMemoryRefreshTokenStore_CountSkipsOtherKinds(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryRefreshTokenStore()
+	expiry := time.Now().Add(time.Hour)
+
+	assert.NoError(t, store.Set(ctx, "token", &User{ID: "123"}, expiry))
+	assert.NoError(t, store.SetData(ctx, "mfa_pending:jti", &core.RefreshTokenData{
+		UserData: &User{ID: "123"},
+		Expiry:   expiry,
+		Kind:     core.KindMFAPending,
+	}))
+
+	count, err := store.Count(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count, "entries of another kind are not refresh tokens")
+	assert.Len(t, store.GetAll(), 1)
+}
+
+func TestInMemoryRefreshTokenStore_Rotate(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryRefreshTokenStore()
+	user := &User{ID: "123", Username: "testuser"}
+	successor := &core.Token{AccessToken: "access", RefreshToken: "new-token"}
+
+	assert.NoError(t, store.Set(ctx, "old-token", user, time.Now().Add(time.Hour)))
+
+	_, err := store.Rotated(ctx, "old-token")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound, "token was not rotated yet")
+
+	assert.NoError(t, store.Rotate(ctx, "old-token", successor, time.Now().Add(time.Minute)))
+
+	_, err = store.Get(ctx, "old-token")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound, "rotated token must not be usable")
+
+	rotated, err := store.Rotated(ctx, "old-token")
+	assert.NoError(t, err)
+	assert.Equal(t, successor, rotated)
+
+	count, _ := store.Count(ctx)
+	assert.Equal(t, 0, count, "rotated tokens are not counted")
+	assert.Empty(t, store.GetAll())
+
+	// A token can only be rotated once
+	err = store.Rotate(ctx, "old-token", successor, time.Now().Add(time.Minute))
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+	err = store.Rotate(ctx, "unknown-token", successor, time.Now().Add(time.Minute))
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+
+	// The successor is forgotten after the grace period
+	assert.NoError(t, store.Set(ctx, "expiring-token", user, time.Now().Add(time.Hour)))
+	assert.NoError(t, store.Rotate(ctx, "expiring-token", successor, time.Now().Add(-time.Second)))
+	_, err = store.Rotated(ctx, "expiring-token")
+	assert.ErrorIs(t, err, ErrRefreshTokenNotFound)
+}
+
 func TestRefreshTokenData_IsExpired(t *testing.T) {
 	// Test non-expired token
 	data := &RefreshTokenData{
@@ -6,13 +6,43 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strconv"
 	"time"
 
 	"github.com/appleboy/gin-jwt/v3/core"
 	"github.com/redis/rueidis"
 )
 
-var _ core.TokenStore = &RedisRefreshTokenStore{}
+var (
+	_ core.TokenStore     = &RedisRefreshTokenStore{}
+	_ core.DataStore      = &RedisRefreshTokenStore{}
+	_ core.SessionStore   = &RedisRefreshTokenStore{}
+	_ core.ConsumeStore   = &RedisRefreshTokenStore{}
+	_ core.RotationStore  = &RedisRefreshTokenStore{}
+	_ core.WatermarkStore = &RedisRefreshTokenStore{}
+)
+
+// consumeScript returns and deletes a refresh token entry, unless it was rotated
+var consumeScript = rueidis.NewLuaScript(`
+local data = redis.call('GET', KEYS[1])
+if not data or cjson.decode(data).rotated_to then
+  return false
+end
+redis.call('DEL', KEYS[1])
+return data
+`)
+
+// rotateScript replaces a refresh token entry with its rotated form, unless it is gone
+// or was rotated already
+var rotateScript = rueidis.NewLuaScript(`
+local data = redis.call('GET', KEYS[1])
+if not data or cjson.decode(data).rotated_to then
+  return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PXAT', ARGV[2])
+return 1
+`)
 
 // RedisRefreshTokenStore provides a Redis-based refresh token store with client-side caching
 type RedisRefreshTokenStore struct {
@@ -20,6 +50,7 @@ type RedisRefreshTokenStore struct {
 	prefix   string
 	ctx      context.Context
 	cacheTTL time.Duration
+	logger   *slog.Logger
 }
 
 // RedisConfig holds the configuration for Redis store
@@ -43,6 +74,9 @@ type RedisConfig struct {
 
 	// Key prefix for Redis keys
 	KeyPrefix string // Prefix for all Redis keys (default: "gin-jwt:")
+
+	// Logger for background failures, never receives token values (default: slog.Default())
+	Logger *slog.Logger
 }
 
 // DefaultRedisConfig returns a default Redis configuration
@@ -60,12 +94,8 @@ func DefaultRedisConfig() *RedisConfig {
 	}
 }
 
-// NewRedisRefreshTokenStore creates a new Redis-based refresh token store with client-side caching
-func NewRedisRefreshTokenStore(config *RedisConfig) (*RedisRefreshTokenStore, error) {
-	if config == nil {
-		config = DefaultRedisConfig()
-	}
-
+// newRedisClient creates a Redis client from config and checks the connection
+func newRedisClient(config *RedisConfig) (rueidis.Client, error) {
 	// Build Redis client options
 	clientOpt := rueidis.ClientOption{
 		InitAddress: []string{config.Addr},
@@ -90,17 +120,40 @@ func NewRedisRefreshTokenStore(config *RedisConfig) (*RedisRefreshTokenStore, er
 	}
 
 	// Test connection
-	ctx := context.Background()
-	if err := client.Do(ctx, client.B().Ping().Build()).Error(); err != nil {
+	if err := client.Do(context.Background(), client.B().Ping().Build()).Error(); err != nil {
 		client.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
+	return client, nil
+}
+
+// redisLogger returns the logger of config annotated with the store type
+func redisLogger(config *RedisConfig) *slog.Logger {
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With("store", string(RedisStore))
+}
+
+// NewRedisRefreshTokenStore creates a new Redis-based refresh token store with client-side caching
+func NewRedisRefreshTokenStore(config *RedisConfig) (*RedisRefreshTokenStore, error) {
+	if config == nil {
+		config = DefaultRedisConfig()
+	}
+
+	client, err := newRedisClient(config)
+	if err != nil {
+		return nil, err
+	}
+
 	return &RedisRefreshTokenStore{
 		client:   client,
 		prefix:   config.KeyPrefix,
-		ctx:      ctx,
+		ctx:      context.Background(),
 		cacheTTL: config.CacheTTL,
+		logger:   redisLogger(config),
 	}, nil
 }
 
@@ -115,31 +168,47 @@ func (s *RedisRefreshTokenStore) buildKey(token string) string {
 	return s.prefix + token
 }
 
+// subjectKey returns the key of the sorted set indexing the tokens of a subject
+func (s *RedisRefreshTokenStore) subjectKey(subject string) string {
+	return s.prefix + "subject:" + subject
+}
+
 // Set stores a refresh token with associated user data and expiration
 func (s *RedisRefreshTokenStore) Set(
 	ctx context.Context,
 	token string,
 	userData any,
 	expiry time.Time,
+) error {
+	return s.SetData(ctx, token, &core.RefreshTokenData{
+		UserData: userData,
+		Expiry:   expiry,
+	})
+}
+
+// SetData stores a refresh token with its complete data
+func (s *RedisRefreshTokenStore) SetData(
+	ctx context.Context,
+	token string,
+	tokenData *core.RefreshTokenData,
 ) error {
 	if token == "" {
 		return errors.New("token cannot be empty")
 	}
 
-	tokenData := &core.RefreshTokenData{
-		UserData: userData,
-		Expiry:   expiry,
-		Created:  time.Now(),
+	stored := *tokenData
+	if stored.Created.IsZero() {
+		stored.Created = time.Now()
 	}
 
 	// Serialize token data to JSON
-	data, err := json.Marshal(tokenData)
+	data, err := json.Marshal(&stored)
 	if err != nil {
 		return fmt.Errorf("failed to marshal token data: %w", err)
 	}
 
 	key := s.buildKey(token)
-	ttl := time.Until(expiry)
+	ttl := time.Until(stored.Expiry)
 
 	// If TTL is negative or zero, the token has already expired
 	if ttl <= 0 {
@@ -152,9 +221,141 @@ func (s *RedisRefreshTokenStore) Set(
 		return fmt.Errorf("failed to store token in Redis: %w", err)
 	}
 
+	if stored.Subject != "" {
+		return s.indexToken(ctx, token, &stored)
+	}
+	return nil
+}
+
+// indexToken adds a token to the index of its subject, which lives as long as its
+// longest-lived token. Entries of deleted tokens are pruned by Sessions.
+func (s *RedisRefreshTokenStore) indexToken(
+	ctx context.Context,
+	token string,
+	tokenData *core.RefreshTokenData,
+) error {
+	key := s.subjectKey(tokenData.Subject)
+	score := float64(sessionStart(tokenData).UnixMilli())
+	expiry := tokenData.Expiry.UnixMilli()
+
+	for _, result := range s.client.DoMulti(ctx,
+		s.client.B().Zadd().Key(key).ScoreMember().ScoreMember(score, token).Build(),
+		s.client.B().Pexpireat().Key(key).MillisecondsTimestamp(expiry).Nx().Build(),
+		s.client.B().Pexpireat().Key(key).MillisecondsTimestamp(expiry).Gt().Build(),
+	) {
+		if err := result.Error(); err != nil {
+			return fmt.Errorf("failed to index token in Redis: %w", err)
+		}
+	}
+	return nil
+}
+
+// watermarksKey returns the key of the hash holding the revocation watermarks by subject,
+// with the global one in the empty field
+func (s *RedisRefreshTokenStore) watermarksKey() string {
+	return s.prefix + "watermarks"
+}
+
+// SetWatermark stores the revocation watermark of subject, or the global one when subject is
+// empty, in Unix milliseconds. Watermarks do not expire.
+func (s *RedisRefreshTokenStore) SetWatermark(
+	ctx context.Context,
+	subject string,
+	watermark time.Time,
+) error {
+	cmd := s.client.B().Hset().Key(s.watermarksKey()).FieldValue().
+		FieldValue(subject, strconv.FormatInt(watermark.UnixMilli(), 10)).Build()
+	if err := s.client.Do(ctx, cmd).Error(); err != nil {
+		return fmt.Errorf("failed to store watermark in Redis: %w", err)
+	}
 	return nil
 }
 
+// Watermark returns the later of the global revocation watermark and the one of subject.
+// It is read on every request, so it benefits from client-side caching.
+func (s *RedisRefreshTokenStore) Watermark(
+	ctx context.Context,
+	subject string,
+) (time.Time, error) {
+	cmd := s.client.B().Hmget().Key(s.watermarksKey()).Field("", subject).Cache()
+	values, err := s.client.DoCache(ctx, cmd, s.cacheTTL).ToArray()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get watermark from Redis: %w", err)
+	}
+
+	var watermark time.Time
+	for _, value := range values {
+		millis, err := value.AsInt64()
+		if rueidis.IsRedisNil(err) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse watermark: %w", err)
+		}
+		if t := time.UnixMilli(millis); t.After(watermark) {
+			watermark = t
+		}
+	}
+	return watermark, nil
+}
+
+// Sessions returns the valid refresh tokens of subject, oldest session first
+func (s *RedisRefreshTokenStore) Sessions(
+	ctx context.Context,
+	subject string,
+) ([]core.Session, error) {
+	key := s.subjectKey(subject)
+	tokens, err := s.client.Do(ctx, s.client.B().Zrange().Key(key).Min("0").Max("-1").Build()).
+		AsStrSlice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions from Redis: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	cmds := make(rueidis.Commands, 0, len(tokens))
+	for _, token := range tokens {
+		cmds = append(cmds, s.client.B().Get().Key(s.buildKey(token)).Build())
+	}
+
+	var sessions []core.Session
+	var stale []string
+	for i, result := range s.client.DoMulti(ctx, cmds...) {
+		data, err := result.ToString()
+		if rueidis.IsRedisNil(err) {
+			stale = append(stale, tokens[i])
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token from Redis: %w", err)
+		}
+
+		var tokenData core.RefreshTokenData
+		if err := json.Unmarshal([]byte(data), &tokenData); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal token data: %w", err)
+		}
+		if tokenData.RotatedTo != nil || tokenData.IsExpired() {
+			stale = append(stale, tokens[i])
+			continue
+		}
+		sessions = append(sessions, core.Session{Token: tokens[i], Data: &tokenData})
+	}
+
+	if len(stale) > 0 {
+		cmd := s.client.B().Zrem().Key(key).Member(stale...).Build()
+		if err := s.client.Do(ctx, cmd).Error(); err != nil {
+			s.logger.Warn("failed to prune session index",
+				"error_kind", "store",
+				"error", err,
+			)
+		}
+	}
+
+	sortSessions(sessions)
+	return sessions, nil
+}
+
 // Get retrieves user data associated with a refresh token
 // This method benefits from client-side caching for frequently accessed tokens
 func (s *RedisRefreshTokenStore) Get(ctx context.Context, token string) (any, error) {
@@ -185,6 +386,11 @@ func (s *RedisRefreshTokenStore) Get(ctx context.Context, token string) (any, er
 		return nil, fmt.Errorf("failed to unmarshal token data: %w", err)
 	}
 
+	// A rotated token is only kept for Rotated
+	if tokenData.RotatedTo != nil {
+		return nil, core.ErrRefreshTokenNotFound
+	}
+
 	// Check if token has expired
 	if tokenData.IsExpired() {
 		// Clean up expired token asynchronously; detach from the request's
@@ -193,7 +399,12 @@ func (s *RedisRefreshTokenStore) Get(ctx context.Context, token string) (any, er
 		cleanupCtx := context.WithoutCancel(ctx)
 		go func() {
 			deleteCmd := s.client.B().Del().Key(key).Build()
-			s.client.Do(cleanupCtx, deleteCmd)
+			if err := s.client.Do(cleanupCtx, deleteCmd).Error(); err != nil {
+				s.logger.Warn("failed to delete expired refresh token",
+					"error_kind", "store",
+					"error", err,
+				)
+			}
 		}()
 		return nil, core.ErrRefreshTokenExpired
 	}
@@ -201,6 +412,131 @@ func (s *RedisRefreshTokenStore) Get(ctx context.Context, token string) (any, er
 	return tokenData.UserData, nil
 }
 
+// GetData retrieves the complete data of a refresh token, bypassing the client-side cache
+func (s *RedisRefreshTokenStore) GetData(
+	ctx context.Context,
+	token string,
+) (*core.RefreshTokenData, error) {
+	if token == "" {
+		return nil, core.ErrRefreshTokenNotFound
+	}
+
+	tokenData, err := s.getData(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if tokenData.RotatedTo != nil || tokenData.IsExpired() {
+		return nil, core.ErrRefreshTokenNotFound
+	}
+	return tokenData, nil
+}
+
+// getData reads the stored entry of a token, bypassing the client-side cache
+func (s *RedisRefreshTokenStore) getData(
+	ctx context.Context,
+	token string,
+) (*core.RefreshTokenData, error) {
+	result := s.client.Do(ctx, s.client.B().Get().Key(s.buildKey(token)).Build())
+	if rueidis.IsRedisNil(result.Error()) {
+		return nil, core.ErrRefreshTokenNotFound
+	}
+	data, err := result.ToString()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token from Redis: %w", err)
+	}
+
+	var tokenData core.RefreshTokenData
+	if err := json.Unmarshal([]byte(data), &tokenData); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token data: %w", err)
+	}
+	return &tokenData, nil
+}
+
+// Consume returns the user data of a refresh token and deletes it in a Lua script,
+// so that only one caller can redeem it
+func (s *RedisRefreshTokenStore) Consume(ctx context.Context, token string) (any, error) {
+	if token == "" {
+		return nil, core.ErrRefreshTokenNotFound
+	}
+
+	result := consumeScript.Exec(ctx, s.client, []string{s.buildKey(token)}, nil)
+	if rueidis.IsRedisNil(result.Error()) {
+		return nil, core.ErrRefreshTokenNotFound
+	}
+	data, err := result.ToString()
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume token in Redis: %w", err)
+	}
+
+	var tokenData core.RefreshTokenData
+	if err := json.Unmarshal([]byte(data), &tokenData); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token data: %w", err)
+	}
+	if tokenData.IsExpired() {
+		return nil, core.ErrRefreshTokenNotFound
+	}
+
+	return tokenData.UserData, nil
+}
+
+// Rotate replaces the entry of a refresh token with its successor until graceExpiry
+// The entry is only overwritten, in a Lua script, if it still exists and was not rotated
+func (s *RedisRefreshTokenStore) Rotate(
+	ctx context.Context,
+	token string,
+	successor *core.Token,
+	graceExpiry time.Time,
+) error {
+	if token == "" {
+		return core.ErrRefreshTokenNotFound
+	}
+
+	tokenData, err := s.getData(ctx, token)
+	if err != nil {
+		return err
+	}
+	if tokenData.RotatedTo != nil || tokenData.IsExpired() {
+		return core.ErrRefreshTokenNotFound
+	}
+
+	data, err := json.Marshal(&core.RefreshTokenData{
+		Expiry:    graceExpiry,
+		Created:   tokenData.Created,
+		RotatedTo: successor,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal token data: %w", err)
+	}
+
+	rotated, err := rotateScript.Exec(ctx, s.client, []string{s.buildKey(token)},
+		[]string{string(data), strconv.FormatInt(graceExpiry.UnixMilli(), 10)}).AsInt64()
+	if err != nil {
+		return fmt.Errorf("failed to rotate token in Redis: %w", err)
+	}
+	if rotated == 0 {
+		return core.ErrRefreshTokenNotFound
+	}
+
+	return nil
+}
+
+// Rotated returns the token pair that replaced a refresh token within its grace period
+func (s *RedisRefreshTokenStore) Rotated(ctx context.Context, token string) (*core.Token, error) {
+	if token == "" {
+		return nil, core.ErrRefreshTokenNotFound
+	}
+
+	tokenData, err := s.getData(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if tokenData.RotatedTo == nil || tokenData.IsExpired() {
+		return nil, core.ErrRefreshTokenNotFound
+	}
+
+	return tokenData.RotatedTo, nil
+}
+
 // Delete removes a refresh token from storage
 func (s *RedisRefreshTokenStore) Delete(ctx context.Context, token string) error {
 	if token == "" {
@@ -225,8 +561,8 @@ func (s *RedisRefreshTokenStore) Cleanup(ctx context.Context) (int, error) {
 	var cursor uint64
 
 	for {
-		// Scan for keys with our prefix
-		cmd := s.client.B().Scan().Cursor(cursor).Match(pattern).Count(100).Build()
+		// Scan for keys with our prefix, skipping the subject indexes and watermarks
+		cmd := s.client.B().Scan().Cursor(cursor).Match(pattern).Count(100).Type("string").Build()
 		result := s.client.Do(ctx, cmd)
 
 		if result.Error() != nil {
@@ -259,6 +595,10 @@ func (s *RedisRefreshTokenStore) Cleanup(ctx context.Context) (int, error) {
 
 			var tokenData core.RefreshTokenData
 			if err := json.Unmarshal([]byte(data), &tokenData); err != nil {
+				s.logger.Debug("skipping undecodable entry during cleanup",
+					"error_kind", "decode",
+					"error", err,
+				)
 				continue // Skip on error
 			}
 
@@ -279,14 +619,16 @@ func (s *RedisRefreshTokenStore) Cleanup(ctx context.Context) (int, error) {
 	return cleaned, nil
 }
 
-// Count returns the total number of active refresh tokens
+// Count returns the total number of active refresh tokens. Like the in-memory store, it skips
+// tokens rotated within their grace period and the records of other kinds, such as pending
+// MFA logins.
 func (s *RedisRefreshTokenStore) Count(ctx context.Context) (int, error) {
 	pattern := s.buildKey("*")
 	var count int
 	var cursor uint64
 
 	for {
-		cmd := s.client.B().Scan().Cursor(cursor).Match(pattern).Count(100).Build()
+		cmd := s.client.B().Scan().Cursor(cursor).Match(pattern).Count(100).Type("string").Build()
 		result := s.client.Do(ctx, cmd)
 
 		if result.Error() != nil {
@@ -298,7 +640,29 @@ func (s *RedisRefreshTokenStore) Count(ctx context.Context) (int, error) {
 			return 0, fmt.Errorf("failed to parse scan result: %w", err)
 		}
 
-		count += len(scanResult.Elements)
+		cmds := make(rueidis.Commands, 0, len(scanResult.Elements))
+		for _, key := range scanResult.Elements {
+			cmds = append(cmds, s.client.B().Get().Key(key).Build())
+		}
+		for _, getResult := range s.client.DoMulti(ctx, cmds...) {
+			data, err := getResult.ToString()
+			if rueidis.IsRedisNil(err) {
+				// Key expired or deleted since the scan
+				continue
+			}
+			if err != nil {
+				return 0, fmt.Errorf("failed to get token from Redis: %w", err)
+			}
+
+			var tokenData core.RefreshTokenData
+			if err := json.Unmarshal([]byte(data), &tokenData); err != nil {
+				continue // Not a refresh token
+			}
+			if tokenData.RotatedTo == nil && tokenData.Kind == "" {
+				count++
+			}
+		}
+
 		cursor = scanResult.Cursor
 
 		if cursor == 0 {
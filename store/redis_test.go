@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -78,6 +79,196 @@ func TestRedisRefreshTokenStore_Integration(t *testing.T) {
 	t.Run("ClientSideCache", func(t *testing.T) {
 		testClientSideCache(t, store)
 	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		testRotation(t, store)
+	})
+
+	t.Run("Consume", func(t *testing.T) {
+		testConsume(t, store)
+	})
+
+	t.Run("Data", func(t *testing.T) {
+		testData(t, store)
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		testSessions(t, store)
+	})
+
+	t.Run("Watermark", func(t *testing.T) {
+		testWatermark(t, store)
+	})
+}
+
+func testWatermark(t *testing.T, store *RedisRefreshTokenStore) {
+	ctx := context.Background()
+	global := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	subject := global.Add(30 * time.Minute)
+
+	watermark, err := store.Watermark(ctx, "watermark-user")
+	require.NoError(t, err)
+	assert.True(t, watermark.IsZero())
+	count, err := store.Count(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, store.SetWatermark(ctx, "", global))
+	require.NoError(t, store.SetWatermark(ctx, "watermark-user", subject))
+
+	watermark, err = store.Watermark(ctx, "watermark-user")
+	require.NoError(t, err)
+	assert.True(t, subject.Equal(watermark), "the later watermark applies")
+	watermark, err = store.Watermark(ctx, "other-user")
+	require.NoError(t, err)
+	assert.True(t, global.Equal(watermark))
+
+	// The watermarks are not counted as tokens
+	newCount, err := store.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, count, newCount)
+
+	// Clean up test data
+	require.NoError(t, store.client.Do(ctx,
+		store.client.B().Del().Key(store.watermarksKey()).Build()).Error())
+}
+
+func testSessions(t *testing.T, store *RedisRefreshTokenStore) {
+	ctx := context.Background()
+	subject := "sessions-user"
+	now := time.Now()
+
+	for i, token := range []string{"sessions-newest", "sessions-oldest", "sessions-deleted"} {
+		require.NoError(t, store.SetData(ctx, token, &core.RefreshTokenData{
+			UserData:     token,
+			Expiry:       now.Add(time.Hour),
+			SessionStart: now.Add(-time.Duration(i) * time.Minute),
+			Subject:      subject,
+		}))
+	}
+	require.NoError(t, store.Delete(ctx, "sessions-deleted"))
+
+	sessions, err := store.Sessions(ctx, subject)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "sessions-oldest", sessions[0].Token)
+	assert.Equal(t, "sessions-newest", sessions[1].Token)
+	assert.Equal(t, "sessions-oldest", sessions[0].Data.UserData)
+
+	// The deleted token was pruned from the index, which is not counted as a token
+	members, err := store.client.Do(ctx,
+		store.client.B().Zcard().Key(store.subjectKey(subject)).Build()).AsInt64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), members)
+
+	// Clean up test data
+	_ = store.Delete(ctx, "sessions-newest")
+	_ = store.Delete(ctx, "sessions-oldest")
+	_ = store.client.Do(ctx, store.client.B().Del().Key(store.subjectKey(subject)).Build())
+}
+
+func testData(t *testing.T, store *RedisRefreshTokenStore) {
+	ctx := context.Background()
+	token := "test-token-data"
+	sessionStart := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	require.NoError(t, store.SetData(ctx, token, &core.RefreshTokenData{
+		UserData:     "data-user",
+		Expiry:       time.Now().Add(time.Hour),
+		SessionStart: sessionStart,
+		Metadata: &core.SessionMetadata{
+			UserAgent:    "test-agent",
+			ClientIP:     "192.0.2.1",
+			RefreshCount: 3,
+		},
+	}))
+
+	data, err := store.GetData(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "data-user", data.UserData)
+	assert.True(t, sessionStart.Equal(data.SessionStart))
+	assert.False(t, data.Created.IsZero())
+	require.NotNil(t, data.Metadata)
+	assert.Equal(t, "test-agent", data.Metadata.UserAgent)
+	assert.Equal(t, "192.0.2.1", data.Metadata.ClientIP)
+	assert.Equal(t, 3, data.Metadata.RefreshCount)
+
+	userData, err := store.Get(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "data-user", userData)
+
+	// A rotated token has no data
+	require.NoError(t, store.Rotate(ctx, token, &core.Token{}, time.Now().Add(time.Minute)))
+	_, err = store.GetData(ctx, token)
+	assert.ErrorIs(t, err, core.ErrRefreshTokenNotFound)
+
+	// Clean up test data
+	_ = store.Delete(ctx, token)
+}
+
+func testConsume(t *testing.T, store *RedisRefreshTokenStore) {
+	ctx := context.Background()
+	token := "test-token-consume"
+	userData := "consume-data"
+
+	require.NoError(t, store.Set(ctx, token, userData, time.Now().Add(time.Hour)))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var redeemed []any
+	for range 20 {
+		wg.Go(func() {
+			data, err := store.Consume(ctx, token)
+			if err == nil {
+				mu.Lock()
+				redeemed = append(redeemed, data)
+				mu.Unlock()
+			} else {
+				assert.ErrorIs(t, err, core.ErrRefreshTokenNotFound)
+			}
+		})
+	}
+	wg.Wait()
+
+	assert.Equal(t, []any{userData}, redeemed, "a token can only be consumed once")
+
+	// A rotated token cannot be consumed
+	rotated := "test-token-consume-rotated"
+	require.NoError(t, store.Set(ctx, rotated, userData, time.Now().Add(time.Hour)))
+	require.NoError(t, store.Rotate(ctx, rotated, &core.Token{}, time.Now().Add(time.Minute)))
+	_, err := store.Consume(ctx, rotated)
+	assert.ErrorIs(t, err, core.ErrRefreshTokenNotFound)
+
+	// Clean up test data
+	_ = store.client.Do(ctx, store.client.B().Del().Key(store.buildKey(rotated)).Build())
+}
+
+func testRotation(t *testing.T, store *RedisRefreshTokenStore) {
+	ctx := context.Background()
+	token := "test-token-rotation"
+	successor := &core.Token{AccessToken: "access", TokenType: "Bearer", RefreshToken: "new-token"}
+
+	require.NoError(t, store.Set(ctx, token, "rotation-data", time.Now().Add(time.Hour)))
+	// Populate the client-side cache
+	_, err := store.Get(ctx, token)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Rotate(ctx, token, successor, time.Now().Add(time.Minute)))
+
+	_, err = store.Get(ctx, token)
+	assert.ErrorIs(t, err, core.ErrRefreshTokenNotFound, "rotated token must not be usable")
+
+	rotated, err := store.Rotated(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, successor, rotated)
+
+	err = store.Rotate(ctx, token, successor, time.Now().Add(time.Minute))
+	assert.ErrorIs(t, err, core.ErrRefreshTokenNotFound, "a token can only be rotated once")
+
+	_, err = store.Rotated(ctx, "test-token-not-rotated")
+	assert.ErrorIs(t, err, core.ErrRefreshTokenNotFound)
+
+	// Clean up test data
+	_ = store.client.Do(ctx, store.client.B().Del().Key(store.buildKey(token)).Build())
 }
 
 func testBasicOperations(t *testing.T, store *RedisRefreshTokenStore) {
@@ -216,6 +407,19 @@ func testCount(t *testing.T, store *RedisRefreshTokenStore) {
 	assert.NoError(t, err, "Count should not return error")
 	assert.GreaterOrEqual(t, newCount, initialCount+len(keys), "Count should include new tokens")
 
+	// Rotated tokens and records of other kinds are not counted
+	successor := &core.Token{AccessToken: "access", RefreshToken: "count-token-4"}
+	assert.NoError(t, store.Rotate(ctx, keys[0], successor, time.Now().Add(time.Minute)))
+	assert.NoError(t, store.SetData(ctx, "mfa_pending:count", &core.RefreshTokenData{
+		UserData: userData,
+		Expiry:   expiry,
+		Kind:     core.KindMFAPending,
+	}))
+	rotatedCount, err := store.Count(ctx)
+	assert.NoError(t, err, "Count should not return error")
+	assert.Equal(t, newCount-1, rotatedCount, "Count should skip rotated tokens and other kinds")
+	_ = store.Delete(ctx, "mfa_pending:count")
+
 	// Clean up test data
 	for _, token := range keys {
 		err := store.Delete(ctx, token)
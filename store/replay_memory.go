@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+)
+
+var _ core.ReplayStore = &InMemoryReplayStore{}
+
+// InMemoryReplayStore provides a simple in-memory replay store
+// This implementation is thread-safe and suitable for single-instance applications
+type InMemoryReplayStore struct {
+	keys    map[string]time.Time
+	mu      sync.Mutex
+	nextGC  time.Time
+	gcEvery time.Duration
+}
+
+// NewInMemoryReplayStore creates a new in-memory replay store
+func NewInMemoryReplayStore() *InMemoryReplayStore {
+	return &InMemoryReplayStore{
+		keys:    make(map[string]time.Time),
+		gcEvery: time.Minute,
+	}
+}
+
+// Use records key until expiry, returning false if it is already recorded
+func (s *InMemoryReplayStore) Use(ctx context.Context, key string, expiry time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.After(s.nextGC) {
+		for k, exp := range s.keys {
+			if now.After(exp) {
+				delete(s.keys, k)
+			}
+		}
+		s.nextGC = now.Add(s.gcEvery)
+	}
+
+	if exp, exists := s.keys[key]; exists && !now.After(exp) {
+		return false, nil
+	}
+
+	s.keys[key] = expiry
+	return true, nil
+}
+
+// Len returns the number of recorded keys, including expired ones not yet removed
+func (s *InMemoryReplayStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.keys)
+}
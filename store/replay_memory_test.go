@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryReplayStore_Use(t *testing.T) {
+	store := NewInMemoryReplayStore()
+	ctx := context.Background()
+
+	first, err := store.Use(ctx, "jti-1", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, first)
+
+	again, err := store.Use(ctx, "jti-1", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, again)
+
+	other, err := store.Use(ctx, "jti-2", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, other)
+}
+
+func TestInMemoryReplayStore_Expiry(t *testing.T) {
+	store := NewInMemoryReplayStore()
+	store.gcEvery = 0
+	ctx := context.Background()
+
+	_, err := store.Use(ctx, "jti", time.Now().Add(10*time.Millisecond))
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+
+	reused, err := store.Use(ctx, "jti", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestInMemoryReplayStore_Concurrent(t *testing.T) {
+	store := NewInMemoryReplayStore()
+	ctx := context.Background()
+
+	var accepted atomic.Int32
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := store.Use(ctx, "jti", time.Now().Add(time.Minute)); ok {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), accepted.Load())
+}
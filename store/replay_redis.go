@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v3/core"
+	"github.com/redis/rueidis"
+)
+
+var _ core.ReplayStore = &RedisReplayStore{}
+
+// RedisReplayStore provides a Redis-based replay store shared by all instances
+type RedisReplayStore struct {
+	client rueidis.Client
+	prefix string
+}
+
+// NewRedisReplayStore creates a new Redis-based replay store
+// It uses the same connection settings as the refresh token store. Keys are written
+// under "<KeyPrefix>-replay:" so they never show up in refresh token Count or Cleanup.
+func NewRedisReplayStore(config *RedisConfig) (*RedisReplayStore, error) {
+	if config == nil {
+		config = DefaultRedisConfig()
+	}
+
+	client, err := newRedisClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedisReplayStore{
+		client: client,
+		prefix: strings.TrimSuffix(config.KeyPrefix, ":") + "-replay:",
+	}, nil
+}
+
+// Close closes the Redis client connection
+func (s *RedisReplayStore) Close() error {
+	s.client.Close()
+	return nil
+}
+
+// Use records key until expiry with SET NX, returning false if it is already recorded
+func (s *RedisReplayStore) Use(ctx context.Context, key string, expiry time.Time) (bool, error) {
+	if !expiry.After(time.Now()) {
+		return true, nil
+	}
+
+	cmd := s.client.B().Set().Key(s.prefix + key).Value("1").Nx().Pxat(expiry).Build()
+	err := s.client.Do(ctx, cmd).Error()
+	if rueidis.IsRedisNil(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record replay key in Redis: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisReplayStore_Integration(t *testing.T) {
+	host, port := setupRedisContainer(t)
+
+	config := &RedisConfig{
+		Addr:      fmt.Sprintf("%s:%s", host, port),
+		KeyPrefix: "test-jwt:",
+	}
+
+	replay, err := NewRedisReplayStore(config)
+	require.NoError(t, err, "failed to create Redis replay store")
+	defer replay.Close()
+
+	tokens, err := NewRedisRefreshTokenStore(config)
+	require.NoError(t, err, "failed to create Redis store")
+	defer tokens.Close()
+
+	ctx := context.Background()
+
+	first, err := replay.Use(ctx, "jti", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, first)
+
+	again, err := replay.Use(ctx, "jti", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, again)
+
+	// Replay keys must not be counted as refresh tokens
+	count, err := tokens.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	_, err = replay.Use(ctx, "short", time.Now().Add(50*time.Millisecond))
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	reused, err := replay.Use(ctx, "short", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, reused)
+}
@@ -2,6 +2,9 @@
 package store
 
 import (
+	"sort"
+	"time"
+
 	"github.com/appleboy/gin-jwt/v3/core"
 )
 
@@ -17,6 +20,21 @@ var (
 	ErrRefreshTokenExpired  = core.ErrRefreshTokenExpired
 )
 
+// sortSessions orders sessions by login time, oldest first
+func sortSessions(sessions []core.Session) {
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessionStart(sessions[i].Data).Before(sessionStart(sessions[j].Data))
+	})
+}
+
+// sessionStart returns the login time of a refresh token, or its creation time
+func sessionStart(data *core.RefreshTokenData) time.Time {
+	if data.SessionStart.IsZero() {
+		return data.Created
+	}
+	return data.SessionStart
+}
+
 // Default creates a default memory-based token store
 // This is the recommended way to create a store with sensible defaults
 func Default() core.TokenStore {